@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/pkg/client"
+	"github.com/Nastez/shortener/utils"
+)
+
+func shorten(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("shorten", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	mode := fs.String("redirect-mode", "", "redirect mode: 301, 302, 307, 308 or interstitial")
+	maxAge := fs.Int("cache-max-age", -1, "seconds to cache the redirect, server policy if negative")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+
+	req := models.Request{RedirectMode: *mode}
+	if *maxAge >= 0 {
+		req.CacheMaxAge = maxAge
+	}
+
+	rows := make([][]string, 0, fs.NArg())
+	results := make([]shortenResult, 0, fs.NArg())
+	for _, original := range fs.Args() {
+		req.URL = original
+		short, err := e.client.Shorten(ctx, req)
+		status := "created"
+		if errors.Is(err, client.ErrConflict) {
+			status = "exists"
+		} else if err != nil {
+			return err
+		}
+
+		rows = append(rows, []string{original, short, status})
+		results = append(results, shortenResult{OriginalURL: original, ShortURL: short, Status: status})
+	}
+
+	return e.out.print(results, []string{"ORIGINAL URL", "SHORT URL", "STATUS"}, rows)
+}
+
+// shortenResult — результат команды shorten для вывода в JSON
+type shortenResult struct {
+	OriginalURL string `json:"original_url"`
+	ShortURL    string `json:"short_url"`
+	Status      string `json:"status"`
+}
+
+func batch(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("f", "-", "input file, - for stdin")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	in := e.stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	payload, err := readBatch(in)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.ShortenBatch(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	originals := make(map[string]string, len(payload))
+	for _, item := range payload {
+		originals[item.CorrelationID] = item.OriginalURL
+	}
+
+	rows := make([][]string, 0, len(resp))
+	for _, item := range resp {
+		rows = append(rows, []string{item.CorrelationID, originals[item.CorrelationID], item.ShortURL})
+	}
+
+	return e.out.print(resp, []string{"CORRELATION ID", "ORIGINAL URL", "SHORT URL"}, rows)
+}
+
+// readBatch читает JSON-массив элементов пакета или список URL по одному в строке.
+// Сервер использует идентификатор корреляции как идентификатор ссылки, поэтому для
+// списка URL идентификаторы генерируются случайно.
+func readBatch(r io.Reader) (models.PayloadBatch, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload models.PayloadBatch
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err = json.Unmarshal(trimmed, &payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		original := strings.TrimSpace(scanner.Text())
+		if original == "" {
+			continue
+		}
+		payload = append(payload, models.RequestBatch{CorrelationID: utils.GenerateID(), OriginalURL: original})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(payload) == 0 {
+		return nil, errors.New("batch is empty")
+	}
+
+	return payload, nil
+}
+
+func resolve(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	type result struct {
+		ID          string `json:"id"`
+		OriginalURL string `json:"original_url,omitempty"`
+		Error       string `json:"error,omitempty"`
+	}
+
+	rows := make([][]string, 0, len(args))
+	results := make([]result, 0, len(args))
+	for _, arg := range args {
+		id := linkID(arg)
+		original, err := e.client.Resolve(ctx, id)
+		switch {
+		case errors.Is(err, client.ErrDeleted), errors.Is(err, client.ErrNotFound):
+			rows = append(rows, []string{id, err.Error()})
+			results = append(results, result{ID: id, Error: err.Error()})
+		case err != nil:
+			return err
+		default:
+			rows = append(rows, []string{id, original})
+			results = append(results, result{ID: id, OriginalURL: original})
+		}
+	}
+
+	return e.out.print(results, []string{"ID", "ORIGINAL URL"}, rows)
+}
+
+func list(ctx context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	urls, err := e.client.UserURLs(ctx)
+	if err != nil {
+		return err
+	}
+	if urls == nil {
+		urls = []models.UserURL{}
+	}
+
+	rows := make([][]string, 0, len(urls))
+	for _, u := range urls {
+		rows = append(rows, []string{u.ShortURL, u.OriginalURL})
+	}
+
+	return e.out.print(urls, []string{"SHORT URL", "ORIGINAL URL"}, rows)
+}
+
+func remove(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	ids := make([]string, 0, len(args))
+	for _, arg := range args {
+		ids = append(ids, linkID(arg))
+	}
+
+	if err := e.client.DeleteURLs(ctx, ids); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, []string{id, "deletion accepted"})
+	}
+
+	return e.out.print(map[string][]string{"accepted": ids}, []string{"ID", "STATUS"}, rows)
+}
+
+// stats сводит ссылки пользователя по доменам назначения
+func stats(ctx context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	urls, err := e.client.UserURLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	type hostStats struct {
+		Host  string `json:"host"`
+		Links int    `json:"links"`
+	}
+
+	counts := make(map[string]int)
+	for _, u := range urls {
+		host := u.OriginalURL
+		if parsed, err := url.Parse(u.OriginalURL); err == nil && parsed.Host != "" {
+			host = parsed.Host
+		}
+		counts[host]++
+	}
+
+	hosts := make([]hostStats, 0, len(counts))
+	for host, n := range counts {
+		hosts = append(hosts, hostStats{Host: host, Links: n})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Links != hosts[j].Links {
+			return hosts[i].Links > hosts[j].Links
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	rows := [][]string{{"(total)", strconv.Itoa(len(urls))}}
+	for _, h := range hosts {
+		rows = append(rows, []string{h.Host, strconv.Itoa(h.Links)})
+	}
+
+	return e.out.print(struct {
+		Total int         `json:"total"`
+		Hosts []hostStats `json:"hosts"`
+	}{Total: len(urls), Hosts: hosts}, []string{"HOST", "LINKS"}, rows)
+}
+
+// linkID принимает идентификатор или полную короткую ссылку и возвращает идентификатор
+func linkID(arg string) string {
+	if u, err := url.Parse(arg); err == nil && u.Scheme != "" && u.Host != "" {
+		return path.Base(u.Path)
+	}
+
+	return arg
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileJar — хранилище cookie, которое сохраняет cookie в файл между запусками.
+// В файле cookie сгруппированы по хосту сервера.
+type fileJar struct {
+	mu    sync.Mutex
+	jar   *cookiejar.Jar
+	path  string
+	hosts map[string][]*http.Cookie
+}
+
+func newFileJar(path string) (*fileJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &fileJar{jar: jar, path: path, hosts: make(map[string][]*http.Cookie)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &j.hosts); err != nil {
+		return nil, err
+	}
+
+	for host, cookies := range j.hosts {
+		jar.SetCookies(&url.URL{Scheme: "http", Host: host, Path: "/"}, cookies)
+	}
+
+	return j, nil
+}
+
+func (j *fileJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.jar.SetCookies(u, cookies)
+
+	stored := j.jar.Cookies(&url.URL{Scheme: "http", Host: u.Host, Path: "/"})
+	j.hosts[u.Host] = stored
+
+	// при ошибке записи cookie останутся только в памяти до конца запуска
+	_ = j.save()
+}
+
+func (j *fileJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *fileJar) save() error {
+	data, err := json.Marshal(j.hosts)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(j.path, data, 0o600)
+}
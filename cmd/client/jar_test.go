@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileJar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shortener", "cookies.json")
+	server := &url.URL{Scheme: "http", Host: "localhost:8080", Path: "/api/shorten"}
+	other := &url.URL{Scheme: "http", Host: "sho.rt", Path: "/"}
+
+	jar, err := newFileJar(path)
+	require.NoError(t, err, "missing file is an empty jar")
+	assert.Empty(t, jar.Cookies(server))
+
+	jar.SetCookies(server, []*http.Cookie{{Name: "token", Value: "first", Path: "/"}})
+	jar.SetCookies(other, []*http.Cookie{{Name: "token", Value: "other", Path: "/"}})
+	jar.SetCookies(server, []*http.Cookie{{Name: "token", Value: "second", Path: "/"}})
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// новый запуск читает cookie из файла, каждую для своего хоста
+	reloaded, err := newFileJar(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url  *url.URL
+		want string
+	}{
+		{url: &url.URL{Scheme: "http", Host: "localhost:8080", Path: "/api/user/urls"}, want: "second"},
+		{url: other, want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url.Host, func(t *testing.T) {
+			cookies := reloaded.Cookies(tt.url)
+			require.Len(t, cookies, 1)
+			assert.Equal(t, tt.want, cookies[0].Value)
+		})
+	}
+
+	t.Run("corrupted file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+		_, err := newFileJar(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestRunPersistsCookie(t *testing.T) {
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("token")
+		if err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "user-1", Path: "/"})
+			tokens = append(tokens, "")
+		} else {
+			tokens = append(tokens, cookie.Value)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	args := []string{"-endpoint", srv.URL, "-cookies", filepath.Join(t.TempDir(), "cookies.json"), "list"}
+	for range 2 {
+		require.NoError(t, run(context.Background(), args, nil, io.Discard, io.Discard))
+	}
+
+	assert.Equal(t, []string{"", "user-1"}, tokens, "second run sends the cookie issued to the first")
+}
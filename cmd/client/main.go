@@ -1,55 +1,147 @@
+// Команда client — консольный клиент сервиса сокращения URL.
+//
+//	client [флаги] <команда> [аргументы]
+//
+// Команды: shorten, batch, resolve, list, delete, stats.
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/Nastez/shortener/pkg/client"
 )
 
+// command — подкоманда клиента
+type command struct {
+	usage string
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"shorten": {usage: "shorten [-redirect-mode mode] [-cache-max-age seconds] URL...", run: shorten},
+	"batch":   {usage: "batch [-f file]    URL per line or JSON array of batch items, stdin by default", run: batch},
+	"resolve": {usage: "resolve ID|SHORT_URL...", run: resolve},
+	"list":    {usage: "list", run: list},
+	"delete":  {usage: "delete ID|SHORT_URL...", run: remove},
+	"stats":   {usage: "stats              summary of the current user's links", run: stats},
+}
+
+// env — общее окружение подкоманд
+type env struct {
+	client *client.Client
+	out    *printer
+	stdin  io.Reader
+}
+
+// errUsage означает неверный вызов команды
+var errUsage = errors.New("usage")
+
 func main() {
-	endpoint := "http://localhost:8080/"
-	// контейнер данных для запроса
-	data := url.Values{}
-	// приглашение в консоли
-	fmt.Println("Введите длинный URL")
-	// открываем потоковое чтение из консоли
-	reader := bufio.NewReader(os.Stdin)
-	// читаем строку из консоли
-	long, err := reader.ReadString('\n')
-	if err != nil {
-		panic(err)
-	}
-	long = strings.TrimSuffix(long, "\n")
-	// заполняем контейнер данными
-	data.Set("url", long)
-	// добавляем HTTP-клиент
-	client := &http.Client{}
-	// пишем запрос
-	// запрос методом POST должен, помимо заголовков, содержать тело
-	// тело должно быть источником потокового чтения io.Reader
-	request, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		stop()
+		os.Exit(exitCode(err))
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	endpoint := fs.String("endpoint", envOr("SHORTENER_ENDPOINT", "http://localhost:8080"), "shortener server address, env SHORTENER_ENDPOINT")
+	output := fs.String("o", "table", "output format: table or json")
+	useGzip := fs.Bool("gzip", false, "compress requests and responses with gzip")
+	retries := fs.Int("retries", 3, "attempts for requests failing with network errors or 429/502/503/504")
+	cookies := fs.String("cookies", defaultCookieFile(), "file to persist the auth cookie, empty to disable")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: client [flags] <command> [args]")
+		fmt.Fprintln(stderr, "\ncommands:")
+		for _, name := range []string{"shorten", "batch", "resolve", "list", "delete", "stats"} {
+			fmt.Fprintln(stderr, "  "+commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+
+	out, err := newPrinter(stdout, *output)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	// в заголовках запроса указываем кодировку
-	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	// отправляем запрос и получаем ответ
-	response, err := client.Do(request)
+
+	policy := client.DefaultRetryPolicy
+	policy.MaxAttempts = *retries
+	opts := []client.Option{client.WithGzip(*useGzip), client.WithRetry(policy)}
+	if *cookies != "" {
+		jar, err := newFileJar(*cookies)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, client.WithCookieJar(jar))
+	}
+
+	c, err := client.New(*endpoint, opts...)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	// выводим код ответа
-	fmt.Println("Статус-код ", response.Status)
-	defer response.Body.Close()
-	// читаем поток из тела ответа
-	body, err := io.ReadAll(response.Body)
+
+	err = cmd.run(ctx, &env{client: c, out: out, stdin: stdin}, fs.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(stderr, "usage: client", cmd.usage)
+	}
+
+	return err
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+
+	return 1
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+
+	return fallback
+}
+
+// defaultCookieFile — файл cookie в каталоге конфигурации пользователя
+func defaultCookieFile() string {
+	dir, err := os.UserConfigDir()
 	if err != nil {
-		panic(err)
+		return ""
 	}
-	// и печатаем его
-	fmt.Println(string(body))
+
+	return filepath.Join(dir, "shortener", "cookies.json")
 }
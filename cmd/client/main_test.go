@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/app/models"
+)
+
+func TestReadBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "url per line",
+			input: "https://yoga.org\n\n  https://pilates.org  \n",
+			want:  []string{"https://yoga.org", "https://pilates.org"},
+		},
+		{
+			name:  "json array",
+			input: ` [{"correlation_id":"a","original_url":"https://yoga.org"}]`,
+			want:  []string{"https://yoga.org"},
+		},
+		{
+			name:    "invalid json array",
+			input:   `[{"correlation_id":`,
+			wantErr: true,
+		},
+		{
+			name:    "empty input",
+			input:   "\n \n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := readBatch(strings.NewReader(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			originals := make([]string, 0, len(payload))
+			ids := make(map[string]bool, len(payload))
+			for _, item := range payload {
+				originals = append(originals, item.OriginalURL)
+				assert.NotEmpty(t, item.CorrelationID)
+				ids[item.CorrelationID] = true
+			}
+			assert.Equal(t, tt.want, originals)
+			assert.Len(t, ids, len(payload), "correlation ids are unique")
+		})
+	}
+}
+
+func TestLinkID(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{arg: "abc", want: "abc"},
+		{arg: "http://localhost:8080/abc", want: "abc"},
+		{arg: "https://sho.rt/nested/abc", want: "abc"},
+		{arg: "localhost:8080/abc", want: "localhost:8080/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			assert.Equal(t, tt.want, linkID(tt.arg))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		var req models.Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		status := http.StatusCreated
+		if req.URL == "https://exists.org" {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.Response{Result: "http://short/abc"})
+	})
+	mux.HandleFunc("POST /api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
+		var payload models.PayloadBatch
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		resp := make(models.ResponseBodyBatch, 0, len(payload))
+		for _, item := range payload {
+			resp = append(resp, models.ResponseBatch{CorrelationID: item.CorrelationID, ShortURL: "http://short/" + item.CorrelationID})
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Location", "https://yoga.org")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("GET /api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.UserURL{
+			{ShortURL: "http://short/a", OriginalURL: "https://yoga.org/1"},
+			{ShortURL: "http://short/b", OriginalURL: "https://yoga.org/2"},
+			{ShortURL: "http://short/c", OriginalURL: "https://pilates.org"},
+		})
+	})
+	mux.HandleFunc("DELETE /api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+		var ids models.DeleteRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ids))
+		assert.Equal(t, models.DeleteRequest{"abc", "def"}, ids)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	batchFile := filepath.Join(t.TempDir(), "batch.json")
+	require.NoError(t, os.WriteFile(batchFile, []byte(`[{"correlation_id":"x1","original_url":"https://yoga.org"}]`), 0o600))
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantErr    error
+		wantOut    []string
+		wantStderr string
+	}{
+		{
+			name:       "no command",
+			wantErr:    errUsage,
+			wantStderr: "usage: client [flags] <command> [args]",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"rename"},
+			wantErr:    errUsage,
+			wantStderr: `unknown command "rename"`,
+		},
+		{
+			name:       "command usage",
+			args:       []string{"shorten"},
+			wantErr:    errUsage,
+			wantStderr: "usage: client shorten",
+		},
+		{
+			name:    "shorten",
+			args:    []string{"shorten", "https://yoga.org", "https://exists.org"},
+			wantOut: []string{"https://yoga.org    http://short/abc  created", "https://exists.org  http://short/abc  exists"},
+		},
+		{
+			name:    "shorten json",
+			args:    []string{"-o", "json", "shorten", "https://yoga.org"},
+			wantOut: []string{`"short_url": "http://short/abc"`, `"status": "created"`},
+		},
+		{
+			name:    "batch from stdin",
+			args:    []string{"batch"},
+			stdin:   `[{"correlation_id":"x0","original_url":"https://pilates.org"}]`,
+			wantOut: []string{"x0              https://pilates.org  http://short/x0"},
+		},
+		{
+			name:    "batch from file",
+			args:    []string{"batch", "-f", batchFile},
+			wantOut: []string{"x1              https://yoga.org  http://short/x1"},
+		},
+		{
+			name:    "resolve",
+			args:    []string{"resolve", "http://short/abc", "missing"},
+			wantOut: []string{"abc      https://yoga.org", "missing  url not found"},
+		},
+		{
+			name:    "list",
+			args:    []string{"list"},
+			wantOut: []string{"http://short/c  https://pilates.org"},
+		},
+		{
+			name:    "delete",
+			args:    []string{"delete", "abc", "http://short/def"},
+			wantOut: []string{"abc  deletion accepted", "def  deletion accepted"},
+		},
+		{
+			name:    "stats",
+			args:    []string{"stats"},
+			wantOut: []string{"(total)      3", "yoga.org     2", "pilates.org  1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-endpoint", srv.URL, "-cookies", "", "-retries", "1"}, tt.args...)
+			var stdout, stderr bytes.Buffer
+
+			err := run(context.Background(), args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, stderr.String(), tt.wantStderr)
+				return
+			}
+			require.NoError(t, err)
+			for _, line := range tt.wantOut {
+				assert.Contains(t, stdout.String(), line)
+			}
+		})
+	}
+
+	t.Run("unknown output format", func(t *testing.T) {
+		err := run(context.Background(), []string{"-endpoint", srv.URL, "-o", "xml", "list"}, nil, io.Discard, io.Discard)
+		assert.ErrorContains(t, err, "unknown output format")
+	})
+}
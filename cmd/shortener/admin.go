@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/logger"
+	"github.com/Nastez/shortener/internal/services"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+const (
+	// defaultAdminPageSize и maxAdminPageSize — размер страницы поиска по умолчанию и наибольший
+	defaultAdminPageSize = 100
+	maxAdminPageSize     = 1000
+)
+
+// AdminSearch ищет ссылки всех пользователей по хосту назначения, владельцу и состоянию
+func (a *app) AdminSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+
+		filter := store.URLFilter{
+			Host:   query.Get("host"),
+			UserID: query.Get("user_id"),
+			Limit:  defaultAdminPageSize,
+		}
+
+		if raw := query.Get("disabled"); raw != "" {
+			disabled, err := strconv.ParseBool(raw)
+			if err != nil {
+				http.Error(w, "disabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			filter.Disabled = &disabled
+		}
+
+		if raw := query.Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxAdminPageSize {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAdminPageSize), http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		after, err := services.DecodeCursor(query.Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.After = after
+
+		page, err := services.SearchURLs(req.Context(), a.domains, a.store, filter)
+		if err != nil {
+			logger.Log.Info("cannot search urls", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// AdminAudit возвращает журнал аудита за полуинтервал времени [from, to) с отбором по ссылке, автору и действию
+func (a *app) AdminAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if a.auditLog == nil {
+			http.Error(w, "audit log is not supported by the storage", http.StatusNotImplemented)
+			return
+		}
+
+		query := req.URL.Query()
+
+		q := audit.Query{
+			URLID:  query.Get("id"),
+			Actor:  query.Get("actor"),
+			Action: query.Get("action"),
+			Limit:  defaultAdminPageSize,
+		}
+		if query.Has("namespace") {
+			namespace := query.Get("namespace")
+			q.Namespace = &namespace
+		}
+
+		for _, bound := range []struct {
+			name string
+			t    *time.Time
+		}{
+			{name: "from", t: &q.From},
+			{name: "to", t: &q.To},
+		} {
+			raw := query.Get(bound.name)
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				http.Error(w, bound.name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*bound.t = t
+		}
+
+		if raw := query.Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxAdminPageSize {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAdminPageSize), http.StatusBadRequest)
+				return
+			}
+			q.Limit = limit
+		}
+
+		if raw := query.Get("cursor"); raw != "" {
+			after, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || after < 0 {
+				http.Error(w, services.ErrInvalidCursor.Error(), http.StatusBadRequest)
+				return
+			}
+			q.AfterID = after
+		}
+
+		page, err := services.QueryAudit(req.Context(), a.auditLog, q)
+		if err != nil {
+			logger.Log.Info("cannot query audit log", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// AdminSetDisabled отключает или включает ссылку {id} из пространства имён ?namespace=
+func (a *app) AdminSetDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var action models.AdminAction
+		if !decodeOptional(w, req, &action) {
+			return
+		}
+
+		link := models.LinkRef{Namespace: req.URL.Query().Get("namespace"), ID: chi.URLParam(req, "id")}
+		found, _, err := services.SetDisabled(req.Context(), a.store, []models.LinkRef{link}, disabled, action.Reason)
+		if err != nil {
+			logger.Log.Info("cannot change url state", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(found) == 0 {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AdminBulkDisable отключает несколько ссылок одним запросом
+func (a *app) AdminBulkDisable() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request models.AdminBulkDisable
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if a.maxBatchItems > 0 && len(request.URLs) > a.maxBatchItems {
+			http.Error(w, fmt.Sprintf("batch must contain at most %d items", a.maxBatchItems), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		found, notFound, err := services.SetDisabled(req.Context(), a.store, request.URLs, true, request.Reason)
+		if err != nil {
+			logger.Log.Info("cannot disable urls", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, models.AdminBulkResult{Disabled: found, NotFound: notFound})
+	}
+}
+
+// AdminReassign передаёт ссылку {id} из пространства имён ?namespace= другому пользователю
+func (a *app) AdminReassign() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request models.AdminReassign
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if request.UserID == "" {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+
+		link := models.LinkRef{Namespace: req.URL.Query().Get("namespace"), ID: chi.URLParam(req, "id")}
+		err := services.ReassignURL(req.Context(), a.store, link, request.UserID, request.Reason)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Log.Info("cannot reassign url", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeOptional разбирает необязательное JSON-тело; при ошибке отвечает 400 и возвращает false
+func decodeOptional(w http.ResponseWriter, req *http.Request, v any) bool {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log.Debug("error encoding response", zap.Error(err))
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,13 +12,27 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/Nastez/shortener/config"
 	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/interstitial"
+	"github.com/Nastez/shortener/internal/limits"
 	"github.com/Nastez/shortener/internal/logger"
+	"github.com/Nastez/shortener/internal/qr"
+	"github.com/Nastez/shortener/internal/rules"
+	"github.com/Nastez/shortener/internal/split"
 	"github.com/Nastez/shortener/internal/store"
+	"github.com/Nastez/shortener/internal/store/audited"
+	"github.com/Nastez/shortener/internal/utm"
 )
 
 // app инкапсулирует в себя все зависимости и логику приложения
@@ -24,6 +40,30 @@ type app struct {
 	store                     store.Store
 	baseAddr                  string
 	databaseConnectionAddress string
+	authenticator             *auth.Authenticator
+	// domains — короткие домены; ссылки создаются и ищутся в пространстве имён домена из заголовка Host
+	domains *domains.Registry
+	// settings — параметры, которые можно поменять без перезапуска; указатель, чтобы копии app видели изменения
+	settings *atomic.Pointer[settings]
+	// bodyLimits — лимиты тела запросов по маршрутам, maxBatchItems — лимит элементов пакета
+	bodyLimits    limits.Config
+	maxBatchItems int
+	// auditLog — журнал аудита ссылок, nil, если хранилище его не ведёт
+	auditLog audit.Log
+	// countries — база GeoIP для правил по стране, nil — такие правила не срабатывают
+	countries rules.Countries
+	// ruleCache — скомпилированные правила ссылок; правила проверяются при сохранении,
+	// а переход только сопоставляет запрос с ними
+	ruleCache *rules.Cache
+}
+
+// settings — перезагружаемые параметры обработчиков, заменяются целиком
+type settings struct {
+	qrLevel             qr.Level
+	redirectMode        store.RedirectMode
+	redirectCacheMaxAge int
+	// utmTemplates — шаблоны UTM-меток, добавляемых к ссылкам при создании
+	utmTemplates map[string]string
 }
 
 // newApp принимает на вход внешние зависимости приложения и возвращает новый объект app
@@ -36,7 +76,66 @@ func newApp(s store.Store, baseAddr string, databaseConnectionAddress string) (*
 		return nil, errors.New("baseAddr is empty")
 	}
 
-	return &app{store: s, baseAddr: baseAddr, databaseConnectionAddress: databaseConnectionAddress}, nil
+	registry, err := domains.New(baseAddr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &app{
+		store:                     s,
+		baseAddr:                  baseAddr,
+		databaseConnectionAddress: databaseConnectionAddress,
+		authenticator:             auth.New(""),
+		domains:                   registry,
+		settings:                  &atomic.Pointer[settings]{},
+		bodyLimits:                limits.Defaults(),
+		maxBatchItems:             limits.DefaultMaxBatchItems,
+		ruleCache:                 rules.NewCache(rules.DefaultCacheSize),
+	}
+	if log, ok := s.(audit.Log); ok {
+		// изменения ссылок записываются в журнал аудита того же хранилища
+		a.store = audited.New(s, log)
+		a.auditLog = log
+	}
+	a.settings.Store(&settings{
+		qrLevel:             qr.DefaultLevel,
+		redirectMode:        store.RedirectTemporary,
+		redirectCacheMaxAge: store.DefaultCacheMaxAge,
+	})
+
+	return a, nil
+}
+
+// applySettings проверяет перезагружаемые параметры и атомарно применяет их целиком
+func (a *app) applySettings(r config.Reloadable) error {
+	qrLevel, err := qr.ParseLevel(r.QRLevel)
+	if err != nil {
+		return err
+	}
+
+	redirectMode, err := store.ParseRedirectMode(r.RedirectStatus)
+	if err != nil || redirectMode == store.RedirectDefault {
+		return store.ErrInvalidRedirectMode
+	}
+
+	for name, template := range r.UTMTemplates {
+		if err = utm.ValidateTemplate(template); err != nil {
+			return fmt.Errorf("utm template %q: %w", name, err)
+		}
+	}
+
+	if err = logger.SetLevel(r.LogLevel); err != nil {
+		return err
+	}
+
+	a.settings.Store(&settings{
+		qrLevel:             qrLevel,
+		redirectMode:        redirectMode,
+		redirectCacheMaxAge: r.RedirectMaxAge,
+		utmTemplates:        r.UTMTemplates,
+	})
+
+	return nil
 }
 
 // GetPing проверяет соединение с базой данных
@@ -91,8 +190,33 @@ func (a *app) ShortenerHandler() http.HandlerFunc {
 			return
 		}
 
-		originalURL := request.URL
-		oldShortURL, shortURL, err := services.SaveURL(ctx, a.baseAddr, a.store, originalURL)
+		opts, err := services.NewLinkOptions(request.RedirectMode, request.CacheMaxAge)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.QueryMode, err = store.ParseQueryMode(request.QueryPassthrough); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.Destinations, err = services.NewDestinations(request.Destinations); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.Rules, err = services.NewRules(request.Rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		domain := a.domains.Resolve(req.Host)
+		originalURL, err := services.ApplyUTMTemplate(request.URL, request.UTMTemplate, a.settings.Load().utmTemplates, domain)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := auth.UserIDFromContext(ctx)
+		oldShortURL, shortURL, err := services.SaveURL(ctx, domain, a.store, originalURL, userID, opts)
 		// наличие неспецифичной ошибки
 		if err != nil && !errors.Is(err, store.ErrConflict) {
 			logger.Log.Debug("cannot save urls in the store", zap.Error(err))
@@ -102,12 +226,13 @@ func (a *app) ShortenerHandler() http.HandlerFunc {
 
 		var resp models.Response
 
+		if errors.Is(err, store.ErrConflict) && oldShortURL == "" {
+			// сгенерированный идентификатор уже занят другой ссылкой
+			http.Error(w, "short id is already taken", http.StatusConflict)
+			return
+		}
 		if errors.Is(err, store.ErrConflict) {
 			// ошибка специфична
-			if oldShortURL == "" {
-				logger.Log.Warn("oldShortURL is empty")
-			}
-
 			// заполняем модель ответа
 			resp = models.Response{
 				Result: oldShortURL,
@@ -150,34 +275,125 @@ func (a *app) GetHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		urlID := chi.URLParam(req, "id")
+
+		// суффикс "+" или параметр preview=1 показывают страницу предпросмотра для любой ссылки
+		preview := req.URL.Query().Get("preview") == "1"
+		if strings.HasSuffix(urlID, "+") {
+			urlID = strings.TrimSuffix(urlID, "+")
+			preview = true
+		}
+
 		if urlID == "" {
 			http.Error(w, "urlID is missed", http.StatusBadRequest)
 			return
 		}
+		// одинаковый идентификатор может существовать на разных доменах
+		domain := a.domains.Resolve(req.Host)
 
 		if req.Method != http.MethodGet {
 			http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		originalURL, err := a.store.Get(ctx, urlID)
+		link, err := a.store.Get(ctx, domain.Namespace, urlID)
+		if errors.Is(err, store.ErrDeleted) {
+			// URL удалён пользователем
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
-			fmt.Println(err)
-			logger.Log.Debug("cannot get originalURL", zap.String("originalURL", originalURL), zap.Error(err))
+			logger.Log.Debug("cannot get originalURL", zap.String("urlID", urlID), zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		fmt.Println("originalURL", originalURL)
+		mode := link.RedirectMode
+		if mode == store.RedirectDefault {
+			mode = a.settings.Load().redirectMode
+		}
+		if preview {
+			mode = store.RedirectInterstitial
+		}
 
-		// устанавливаем заголовок Location
-		w.Header().Set("Location", originalURL)
-		fmt.Println("test originalURL", originalURL)
-		// устанавливаем код 307
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		destination := link.OriginalURL
+		cacheMaxAge, defaultMaxAge := link.CacheMaxAge, a.settings.Load().redirectCacheMaxAge
+		if target, ok := a.matchRule(req, link); ok {
+			destination = target
+		} else if len(link.Destinations) > 0 {
+			destination = a.chooseDestination(w, req, link, !preview)
+		}
+		if link.QueryMode != store.QueryDrop {
+			// параметры перехода, кроме служебного preview, переносятся в адрес назначения
+			query := req.URL.Query()
+			query.Del("preview")
+			destination = utm.Merge(destination, query.Encode(), link.QueryMode == store.QueryOverride)
+		}
+		if len(link.Rules) > 0 || len(link.Destinations) > 0 || link.Version > 1 {
+			// адрес зависит от клиента, а выбор варианта должен доходить до сервера,
+			// иначе переходы не попадут в счётчики; изменённая ссылка тоже не кэшируется,
+			// чтобы следующие правки и срок действия доходили до клиентов сразу
+			noStore := 0
+			cacheMaxAge = &noStore
+		}
+
+		if mode == store.RedirectInterstitial {
+			// вместо перенаправления показываем страницу с адресом назначения
+			err = interstitial.Render(w, interstitial.Page{
+				ShortURL:    domain.ShortURL(urlID),
+				Destination: destination,
+			})
+			if err != nil {
+				logger.Log.Info("error rendering interstitial page", zap.Error(err))
+			}
+			return
+		}
+
+		// устанавливаем заголовки Location и Cache-Control
+		w.Header().Set("Location", destination)
+		w.Header().Set("Cache-Control", mode.CacheControl(cacheMaxAge, defaultMaxAge))
+		// устанавливаем код перенаправления ссылки или сервера
+		w.WriteHeader(mode.StatusCode())
 	}
 }
 
+// matchRule возвращает адрес первого правила ссылки, совпавшего с запросом
+func (a *app) matchRule(req *http.Request, link store.URL) (string, bool) {
+	if len(link.Rules) == 0 {
+		return "", false
+	}
+
+	key := rules.Key{Namespace: link.Namespace, ID: link.GeneratedID, Version: link.Version}
+	engine, err := a.ruleCache.Engine(key, link.Rules, a.countries)
+	if err != nil {
+		// правила проверяются при сохранении, поэтому сломанные правила не мешают переходу
+		logger.Log.Info("cannot compile redirect rules", zap.String("urlID", link.GeneratedID), zap.Error(err))
+		return "", false
+	}
+
+	return engine.Match(rules.FromHTTP(req))
+}
+
+// chooseDestination выбирает вариант ссылки с несколькими адресами, закрепляет его за клиентом
+// в cookie и, если count, учитывает переход в счётчике варианта
+func (a *app) chooseDestination(w http.ResponseWriter, req *http.Request, link store.URL, count bool) string {
+	d := split.Choose(link.Destinations, split.Sticky(req, link.GeneratedID), split.ClientKey(req, link.Namespace, link.GeneratedID))
+	split.Remember(w, link.GeneratedID, d.Variant)
+
+	if count {
+		ref := store.URLRef{Namespace: link.Namespace, ID: link.GeneratedID}
+		if err := a.store.CountClick(req.Context(), ref, d.Variant); err != nil {
+			// переход важнее статистики: ошибка счётчика не мешает перенаправлению
+			logger.Log.Info("cannot count click", zap.String("urlID", link.GeneratedID), zap.String("variant", d.Variant), zap.Error(err))
+		}
+	}
+
+	return d.URL
+}
+
 func (a *app) PostHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
@@ -187,9 +403,12 @@ func (a *app) PostHandler() http.HandlerFunc {
 			return
 		}
 
+		defer req.Body.Close()
+
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
-			logger.Log.Info("can't read body")
+			logger.Log.Info("can't read body", zap.Error(err))
+			http.Error(w, "can't read body", http.StatusBadRequest)
 			return
 		}
 
@@ -199,12 +418,18 @@ func (a *app) PostHandler() http.HandlerFunc {
 			return
 		}
 
-		defer req.Body.Close()
-
 		if a == nil {
 			return
 		}
-		oldShortURL, shortURL, err := services.SaveURL(ctx, a.baseAddr, a.store, originalURL)
+		domain := a.domains.Resolve(req.Host)
+		originalURL, err = services.ApplyUTMTemplate(originalURL, "", a.settings.Load().utmTemplates, domain)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := auth.UserIDFromContext(ctx)
+		oldShortURL, shortURL, err := services.SaveURL(ctx, domain, a.store, originalURL, userID, services.LinkOptions{})
 
 		// наличие неспецифичной ошибки
 		if err != nil && !errors.Is(err, store.ErrConflict) {
@@ -212,6 +437,11 @@ func (a *app) PostHandler() http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if errors.Is(err, store.ErrConflict) && oldShortURL == "" {
+			// сгенерированный идентификатор уже занят другой ссылкой
+			http.Error(w, "short id is already taken", http.StatusConflict)
+			return
+		}
 		if errors.Is(err, store.ErrConflict) {
 			// ошибка специфична
 			// устанавливаем заголовок Content-Type
@@ -251,7 +481,48 @@ func (a *app) PostBatch() http.HandlerFunc {
 			return
 		}
 
-		responseBatch := services.SaveBatchURL(ctx, requestBatch, a.baseAddr, a.store)
+		if a.maxBatchItems > 0 && len(requestBatch) > a.maxBatchItems {
+			// устанавливаем код 413
+			http.Error(w, fmt.Sprintf("batch must contain at most %d items", a.maxBatchItems), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		domain := a.domains.Resolve(req.Host)
+		templates := a.settings.Load().utmTemplates
+		for i, request := range requestBatch {
+			if _, err := services.NewLinkOptions(request.RedirectMode, request.CacheMaxAge); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if _, err := store.ParseQueryMode(request.QueryPassthrough); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			originalURL, err := services.ApplyUTMTemplate(request.OriginalURL, request.UTMTemplate, templates, domain)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			requestBatch[i].OriginalURL = originalURL
+		}
+
+		userID, _ := auth.UserIDFromContext(ctx)
+		responseBatch, err := services.SaveBatchURL(ctx, requestBatch, domain, a.store, userID)
+		if errors.Is(err, services.ErrInvalidDestinations) || errors.Is(err, rules.ErrInvalidRule) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			// correlation_id служит идентификатором и должен быть свободен
+			http.Error(w, "correlation_id is already taken", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Log.Debug("cannot save batch in the store", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
 		// устанавливаем заголовок Content-Type
 		w.Header().Set("Content-Type", "application/json")
@@ -268,57 +539,161 @@ func (a *app) PostBatch() http.HandlerFunc {
 	}
 }
 
-func (a *app) PostBatch() http.HandlerFunc {
+// GetUserURLs возвращает все URL, сокращённые текущим пользователем
+func (a *app) GetUserURLs() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 
-		if req.Method != http.MethodPost {
-			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// десериализуем запрос в структуру модели
-		logger.Log.Info("decoding request")
-		var requestBatch models.PayloadBatch
+		userID, ok := auth.UserIDFromContext(ctx)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userURLs, err := services.GetUserURLs(ctx, a.domains, a.store, userID)
+		if err != nil {
+			logger.Log.Debug("cannot get user urls", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if len(userURLs) == 0 {
+			// у пользователя нет сокращённых URL
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(w)
+		if err = enc.Encode(userURLs); err != nil {
+			logger.Log.Info("error encoding response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// DeleteUserURLs удаляет URL текущего пользователя по списку идентификаторов
+func (a *app) DeleteUserURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if req.Method != http.MethodDelete {
+			http.Error(w, "Only DELETE requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := auth.UserIDFromContext(ctx)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var ids models.DeleteRequest
 		dec := json.NewDecoder(req.Body)
-		if err := dec.Decode(&requestBatch); err != nil {
+		if err := dec.Decode(&ids); err != nil {
 			logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := services.DeleteUserURLs(ctx, a.store, a.domains.Resolve(req.Host).Namespace, userID, ids); err != nil {
+			logger.Log.Debug("cannot delete user urls", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		var responseBatch models.ResponseBodyBatch
+		// устанавливаем код 202
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
 
-		for _, request := range requestBatch {
-			var response = models.ResponseBatch{
-				CorrelationID: request.CorrelationID,
-				ShortURL:      a.baseAddr + "/" + request.CorrelationID,
-			}
-			responseBatch = append(responseBatch, response)
+// QRHandler отдаёт QR-код с полным коротким URL.
+// Изображение детерминировано, поэтому отдаётся с сильным ETag и кэшируется клиентом.
+func (a *app) QRHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
-		if len(responseBatch) > 0 {
-			err := a.store.SaveBatch(ctx, requestBatch, responseBatch)
+		urlID := chi.URLParam(req, "id")
+		if urlID == "" {
+			http.Error(w, "urlID is missed", http.StatusBadRequest)
+			return
+		}
+		// одинаковый идентификатор может существовать на разных доменах
+		domain := a.domains.Resolve(req.Host)
+
+		size := qr.DefaultSize
+		if rawSize := req.URL.Query().Get("size"); rawSize != "" {
+			var err error
+			size, err = strconv.Atoi(rawSize)
 			if err != nil {
-				logger.Log.Info("can't save batch in store")
-				fmt.Println(err)
+				http.Error(w, "size must be a number", http.StatusBadRequest)
 				return
 			}
-		} else {
-			logger.Log.Info("responseBatch is empty")
 		}
+		format := req.URL.Query().Get("format")
 
-		// устанавливаем заголовок Content-Type
-		w.Header().Set("Content-Type", "application/json")
-		// устанавливаем код 201
-		w.WriteHeader(http.StatusCreated)
+		link, err := a.store.Get(ctx, domain.Namespace, urlID)
+		if errors.Is(err, store.ErrDeleted) {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if err != nil || link.OriginalURL == "" {
+			logger.Log.Debug("cannot get originalURL", zap.String("urlID", urlID), zap.Error(err))
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
 
-		// сериализуем ответ сервера
-		enc := json.NewEncoder(w)
-		if err := enc.Encode(responseBatch); err != nil {
-			logger.Log.Info("error encoding response", zap.Error(err))
+		image, contentType, err := qr.Encode(domain.ShortURL(urlID), a.settings.Load().qrLevel, format, size)
+		if errors.Is(err, qr.ErrInvalidSize) || errors.Is(err, qr.ErrUnknownFormat) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		logger.Log.Info("sending HTTP 201 response")
+		if err != nil {
+			logger.Log.Debug("cannot encode qr", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha256.Sum256(image)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		if etagMatch(req.Header.Get("If-None-Match"), etag) {
+			// устанавливаем код 304
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+		// устанавливаем код 200
+		w.WriteHeader(http.StatusOK)
+		w.Write(image)
 	}
 }
+
+// etagMatch проверяет, есть ли etag в списке If-None-Match. Для GET сравнение слабое
+// (RFC 9110, 13.1.2), поэтому префикс W/ не учитывается, а * совпадает с любым тегом.
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nastez/shortener/config"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/store"
+	"github.com/Nastez/shortener/utils"
+)
+
+// runCommand выполняет подкоманду администрирования:
+//
+//	shortener [флаги сервера] apikey issue [-user ID] [-name NAME] -scopes create,read-stats,delete,update,admin
+//	shortener [флаги сервера] apikey revoke KEY_ID
+//	shortener [флаги сервера] apikey list [-user ID]
+//
+// Флаги сервера выбирают хранилище так же, как при запуске сервера.
+func runCommand(ctx context.Context, cfg *config.Config, args []string, stdout io.Writer) error {
+	if args[0] != "apikey" {
+		return fmt.Errorf("unknown command %q, expected apikey", args[0])
+	}
+	if len(args) < 2 {
+		return errors.New("usage: apikey issue|revoke|list")
+	}
+
+	if cfg.Storage == store.BackendMemory {
+		return errors.New("memory storage does not keep api keys between runs, use -storage file or postgres")
+	}
+
+	s, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return apiKeyCommand(ctx, s, args[1], args[2:], stdout)
+}
+
+// apiKeyCommand выдаёт, отзывает и перечисляет ключи API
+func apiKeyCommand(ctx context.Context, keys store.KeyStore, name string, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("apikey "+name, flag.ContinueOnError)
+	fs.SetOutput(stdout)
+
+	switch name {
+	case "issue":
+		userID := fs.String("user", "", "owner of the key, a new user is created if empty")
+		keyName := fs.String("name", "", "description of the key, e.g. the client service name")
+		rawScopes := fs.String("scopes", "", "comma-separated scopes: "+strings.Join(auth.Scopes, ", "))
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		scopes, err := auth.ParseScopes(*rawScopes)
+		if err != nil {
+			return err
+		}
+		if *userID == "" {
+			*userID = utils.GenerateID()
+		}
+
+		token, key := auth.NewAPIKey(*userID, *keyName, scopes)
+		if err = keys.SaveKey(ctx, key); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "key %s issued for user %s with scopes %s\n", key.ID, key.UserID, strings.Join(key.Scopes, ","))
+		fmt.Fprintln(stdout, "token (shown only once, send as Authorization: Bearer):")
+		fmt.Fprintln(stdout, token)
+	case "revoke":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return errors.New("usage: apikey revoke KEY_ID...")
+		}
+
+		for _, id := range fs.Args() {
+			if err := keys.RevokeKey(ctx, id); err != nil {
+				return fmt.Errorf("can't revoke %s: %w", id, err)
+			}
+			fmt.Fprintf(stdout, "key %s revoked\n", id)
+		}
+	case "list":
+		userID := fs.String("user", "", "show only keys of the user")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		list, err := keys.ListKeys(ctx, *userID)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSER\tNAME\tSCOPES\tCREATED\tREVOKED")
+		for _, key := range list {
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.UserID, key.Name, strings.Join(key.Scopes, ","), key.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown apikey command %q, expected issue, revoke or list", name)
+	}
+
+	return nil
+}
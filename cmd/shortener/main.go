@@ -2,21 +2,29 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 
 	"github.com/Nastez/shortener/config"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/compress"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/geoip"
+	"github.com/Nastez/shortener/internal/grpcserver"
 	"github.com/Nastez/shortener/internal/logger"
-	"github.com/Nastez/shortener/internal/saver"
-	"github.com/Nastez/shortener/internal/storage"
-	"github.com/Nastez/shortener/internal/store/pg"
-	"github.com/Nastez/shortener/internal/storeconfig"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/Nastez/shortener/internal/openapi"
+	"github.com/Nastez/shortener/internal/store"
+
+	// регистрируем хранилища memory, file и postgres
+	_ "github.com/Nastez/shortener/internal/storage"
+	_ "github.com/Nastez/shortener/internal/store/pg"
 )
 
 func main() {
@@ -25,84 +33,181 @@ func main() {
 		log.Fatalln(err)
 	}
 
+	if err = logger.Initialize(cfg.LogLevel); err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(cfg.Args) > 0 {
+		// подкоманда администрирования работает с хранилищем напрямую, сервер не запускается
+		if err = runCommand(context.Background(), cfg, cfg.Args, os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	if err = run(cfg); err != nil {
 		panic(err)
 	}
 }
 
+// openStore открывает хранилище, выбранное конфигурацией
+func openStore(ctx context.Context, cfg *config.Config) (store.Backend, error) {
+	// хранилище выбирается по имени из реестра, каждое читает свою часть параметров
+	return store.Open(ctx, cfg.Storage, store.Options{
+		File: store.FileOptions{Path: cfg.FileStoragePath},
+		Postgres: store.PostgresOptions{
+			DSN: cfg.DatabaseConnectionAddress,
+			Pool: store.PoolOptions{
+				MaxOpenConns:    cfg.DBMaxOpenConns,
+				MaxIdleConns:    cfg.DBMaxIdleConns,
+				ConnMaxLifetime: cfg.DBConnMaxLifetime,
+				ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+			},
+		},
+	})
+}
+
 func run(cfg *config.Config) error {
-	r := chi.NewRouter()
-	if cfg.DatabaseConnectionAddress != "" {
-		// создаём соединение с СУБД PostgreSQL с помощью аргумента командной строки
-		conn, err := sql.Open("pgx", cfg.DatabaseConnectionAddress)
-		if err != nil {
-			return err
-		}
+	s, err := openStore(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
 
-		// создаём экземпляр приложения, передавая реализацию хранилища pg в качестве внешней зависимости
-		appInstance, err := newApp(pg.NewStore(conn), cfg.BaseURL, cfg.DatabaseConnectionAddress)
-		if err != nil {
-			return err
-		}
-		storeconfig.NewStoreConfig(conn).Bootstrap(context.Background())
+	appInstance, err := newApp(s, cfg.BaseURL, cfg.DatabaseConnectionAddress)
+	if err != nil {
+		return err
+	}
 
-		routes, err := ShortenerRoutes(cfg.BaseURL, *appInstance)
+	appInstance.authenticator = auth.New(cfg.SecretKey)
+	// ключи API хранятся в том же хранилище, что и ссылки
+	appInstance.authenticator.UseKeys(s)
+	if cfg.AuthMode == "jwt" {
+		err = appInstance.authenticator.UseJWT(auth.JWTOptions{
+			Algorithm:      cfg.JWTAlgorithm,
+			Secret:         cfg.JWTSecret,
+			Issuer:         cfg.JWTIssuer,
+			Audience:       cfg.JWTAudience,
+			JWKSFile:       cfg.JWTJWKSFile,
+			PrivateKeyFile: cfg.JWTPrivateKeyFile,
+			KeyID:          cfg.JWTKeyID,
+			TTL:            cfg.JWTTTL,
+		})
 		if err != nil {
 			return err
 		}
-
-		r.Mount("/", routes)
-	} else if cfg.DatabaseConnectionAddress == "" && cfg.FileName != "events.log" {
-		defer os.Remove(cfg.FileName)
-
-		err := saver.SaveFile(cfg.FileName)
+	}
+	if appInstance.domains, err = domains.New(cfg.BaseURL, cfg.Domains); err != nil {
+		return err
+	}
+	if cfg.GeoIPFile != "" {
+		db, err := geoip.Open(cfg.GeoIPFile)
 		if err != nil {
 			return err
 		}
+		appInstance.countries = db
+	}
+	appInstance.bodyLimits = cfg.BodyLimits()
+	appInstance.maxBatchItems = cfg.MaxBatchItems
+	if err = appInstance.applySettings(cfg.Reloadable()); err != nil {
+		return err
+	}
 
-		appInstance, err := newApp(storage.New(), cfg.BaseURL, cfg.DatabaseConnectionAddress)
-		if err != nil {
-			return err
-		}
+	// перечитываем конфигурацию по SIGHUP и при изменении файла конфигурации
+	go newReloader(cfg, config.New, appInstance.applySettings).watch(context.Background())
 
-		routes, err := ShortenerRoutes(cfg.BaseURL, *appInstance)
-		if err != nil {
+	if cfg.GRPCAddress != "" {
+		// gRPC-сервер использует то же хранилище, что и HTTP API
+		if err = serveGRPC(cfg.GRPCAddress, appInstance); err != nil {
 			return err
 		}
+	}
 
-		r.Mount("/", routes)
-	} else if cfg.DatabaseConnectionAddress == "" && cfg.FileName == "events.log" {
-		appInstance, err := newApp(storage.New(), cfg.BaseURL, cfg.DatabaseConnectionAddress)
-		if err != nil {
-			return err
-		}
+	r := chi.NewRouter()
+	routes, err := ShortenerRoutes(cfg.BaseURL, *appInstance)
+	if err != nil {
+		return err
+	}
 
-		routes, err := ShortenerRoutes(cfg.BaseURL, *appInstance)
-		if err != nil {
-			return err
-		}
+	r.Mount("/", routes)
 
-		r.Mount("/", routes)
+	return serve(cfg, r)
+}
 
-	} else {
-		logger.Log.Error("can't run app")
+// serveGRPC запускает gRPC-сервер в отдельной горутине
+func serveGRPC(addr string, appInstance *app) error {
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
 	}
 
-	return http.ListenAndServe(":"+cfg.Port, r)
+	srv, err := grpcserver.NewServer(appInstance.store, appInstance.domains, appInstance.maxBatchItems)
+	if err != nil {
+		return err
+	}
+
+	s := grpcserver.New(srv, appInstance.authenticator)
+	go func() {
+		if err := s.Serve(listen); err != nil {
+			logger.Log.Error("gRPC server stopped", zap.Error(err))
+		}
+	}()
+
+	return nil
 }
 
 func ShortenerRoutes(baseAddr string, appInstance app) (chi.Router, error) {
 	r := chi.NewRouter()
+	// идентификатор запроса попадает в журнал аудита и возвращается клиенту
+	r.Use(audit.RequestID)
 
 	if baseAddr == "http://localhost:" {
 		return nil, errors.New("port is empty")
 	}
 
-	r.Post("/", logger.WithLogging(GzipMiddleware(appInstance.PostHandler())))
-	r.Get("/{id}", logger.WithLogging(GzipMiddleware(appInstance.GetHandler())))
-	r.Post("/api/shorten", logger.WithLogging(GzipMiddleware(appInstance.ShortenerHandler())))
-	r.Get("/ping", logger.WithLogging(GzipMiddleware(appInstance.GetPing())))
-	r.Post("/api/shorten/batch", logger.WithLogging(GzipMiddleware(appInstance.PostBatch())))
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator := appInstance.authenticator
+	compressor := compress.New(compress.DefaultMinSize)
+	// limit ограничивает размер тела запроса до и после распаковки по настройкам маршрута
+	limit := func(route string) func(http.Handler) http.HandlerFunc {
+		return appInstance.bodyLimits.For(route).Middleware
+	}
+	// запросам с ключом API нужна соответствующая область действия
+	create := auth.RequireScope(auth.ScopeCreate)
+	readStats := auth.RequireScope(auth.ScopeReadStats)
+	remove := auth.RequireScope(auth.ScopeDelete)
+	update := auth.RequireScope(auth.ScopeUpdate)
+
+	r.Get("/openapi.json", logger.WithLogging(compressor.Middleware(openapi.Handler())))
+	r.Post("/", logger.WithLogging(limit("/")(authenticator.Middleware(create(compressor.Middleware(validator.Middleware(appInstance.PostHandler())))))))
+	r.Get("/{id}", logger.WithLogging(compressor.Middleware(appInstance.GetHandler())))
+	r.Get("/{id}/qr", logger.WithLogging(compressor.Middleware(appInstance.QRHandler())))
+	r.Post("/api/shorten", logger.WithLogging(limit("/api/shorten")(authenticator.Middleware(create(compressor.Middleware(validator.Middleware(appInstance.ShortenerHandler())))))))
+	r.Get("/ping", logger.WithLogging(compressor.Middleware(appInstance.GetPing())))
+	r.Post("/api/shorten/batch", logger.WithLogging(limit("/api/shorten/batch")(authenticator.Middleware(create(compressor.Middleware(validator.Middleware(appInstance.PostBatch())))))))
+	r.Get("/api/user/urls", logger.WithLogging(authenticator.Required(readStats(compressor.Middleware(appInstance.GetUserURLs())))))
+	r.Delete("/api/user/urls", logger.WithLogging(limit("/api/user/urls")(authenticator.Required(remove(compressor.Middleware(validator.Middleware(appInstance.DeleteUserURLs())))))))
+	r.Get("/api/urls/{id}", logger.WithLogging(authenticator.Required(readStats(compressor.Middleware(appInstance.GetUserURL())))))
+	r.Patch("/api/urls/{id}", logger.WithLogging(limit("/api/urls/{id}")(authenticator.Required(update(compressor.Middleware(validator.Middleware(appInstance.PatchUserURL())))))))
+	r.Get("/api/urls/{id}/history", logger.WithLogging(authenticator.Required(readStats(compressor.Middleware(appInstance.GetUserURLHistory())))))
+
+	// модерация ссылок доступна только с ключом API с областью действия admin
+	r.Route("/admin", func(r chi.Router) {
+		admin := func(route string, h http.HandlerFunc) http.HandlerFunc {
+			return logger.WithLogging(limit("/admin" + route)(authenticator.Admin(compressor.Middleware(validator.Middleware(h)))))
+		}
+
+		r.Get("/urls", admin("/urls", appInstance.AdminSearch()))
+		r.Post("/urls/disable", admin("/urls/disable", appInstance.AdminBulkDisable()))
+		r.Post("/urls/{id}/disable", admin("/urls/{id}/disable", appInstance.AdminSetDisabled(true)))
+		r.Post("/urls/{id}/enable", admin("/urls/{id}/enable", appInstance.AdminSetDisabled(false)))
+		r.Post("/urls/{id}/reassign", admin("/urls/{id}/reassign", appInstance.AdminReassign()))
+		r.Get("/audit", admin("/audit", appInstance.AdminAudit()))
+	})
 
 	return r, nil
 }
@@ -1,20 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Nastez/shortener/config"
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/geoip"
+	"github.com/Nastez/shortener/internal/limits"
+	"github.com/Nastez/shortener/internal/openapi"
+	"github.com/Nastez/shortener/internal/split"
 	"github.com/Nastez/shortener/internal/storage"
+	"github.com/Nastez/shortener/internal/store"
 	storeMock "github.com/Nastez/shortener/internal/store/mocks"
 )
 
@@ -126,23 +143,33 @@ func Test_postHandler(t *testing.T) {
 			assert.Equal(t, test.want.contentType, resp.Header.Get("Content-Type"))
 		})
 	}
+
+	// тело, которое не удаётся прочитать, — ошибка клиента, а не пустой успешный ответ
+	t.Run("unreadable body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", iotest.ErrReader(errors.New("connection reset")))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
 }
 
 func Test_getHandler(t *testing.T) {
 	id := "875910c4"
-	store := storage.MemoryStorage{}
-	store["https://yoga.org/"] = "875910c4"
+	memStore := storage.New()
 
 	ctrl := gomock.NewController(t)
 	s := storeMock.NewMockStore(ctrl)
 
 	//установим условие: при любом вызове метода Get не возвращались ошибки
 	s.EXPECT().
-		Get(gomock.Any(), id).
-		Return("875910c4", nil).AnyTimes()
+		Get(gomock.Any(), "", id).
+		Return(store.URL{OriginalURL: "875910c4"}, nil).AnyTimes()
+
+	_, err := memStore.Save(context.Background(), store.URL{OriginalURL: "https://yoga.org/", GeneratedID: "111"})
+	require.NoError(t, err)
 
 	// создадим экземпляр приложения и передадим ему «хранилище»
-	appInstance, err := newApp(store, "http://localhost:0007", "")
+	appInstance, err := newApp(memStore, "http://localhost:0007", "")
 	if err != nil {
 		assert.Error(t, err)
 	}
@@ -162,14 +189,26 @@ func Test_getHandler(t *testing.T) {
 		name   string
 		want   want
 		method string
+		id     string
 	}{
 		{
 			name: "success",
 			want: want{
 				code:   http.StatusTemporaryRedirect,
-				header: storage.MemoryStorage{}[id],
+				header: "https://yoga.org/",
 			},
 			method: http.MethodGet,
+			id:     "111",
+		},
+		{
+			name: "unknown id",
+			want: want{
+				code:        http.StatusNotFound,
+				contentType: "text/plain; charset=utf-8",
+				header:      "",
+			},
+			method: http.MethodGet,
+			id:     "222",
 		},
 		{
 			name: "incorrect method",
@@ -179,6 +218,7 @@ func Test_getHandler(t *testing.T) {
 				header:      "",
 			},
 			method: http.MethodPost,
+			id:     "111",
 		},
 	}
 
@@ -187,7 +227,7 @@ func Test_getHandler(t *testing.T) {
 			req := httptest.NewRequest(test.method, "/", nil)
 
 			ctx := chi.NewRouteContext()
-			ctx.URLParams.Add("id", "111")
+			ctx.URLParams.Add("id", test.id)
 			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
 			// Создаем `ResponseRecorder`, чтобы записать ответ
@@ -204,6 +244,74 @@ func Test_getHandler(t *testing.T) {
 	}
 }
 
+func Test_getHandlerRedirectModes(t *testing.T) {
+	s := storage.New()
+	for id, mode := range map[string]store.RedirectMode{
+		"default": store.RedirectDefault,
+		"moved":   store.RedirectMovedPermanently,
+		"found":   store.RedirectFound,
+		"perm":    store.RedirectPermanent,
+		"page":    store.RedirectInterstitial,
+	} {
+		_, err := s.Save(context.Background(), store.URL{
+			OriginalURL:  "https://yoga.org/" + id,
+			GeneratedID:  id,
+			RedirectMode: mode,
+		})
+		require.NoError(t, err)
+	}
+
+	maxAge := 60
+	_, err := s.Save(context.Background(), store.URL{
+		OriginalURL:  "https://yoga.org/campaign",
+		GeneratedID:  "campaign",
+		RedirectMode: store.RedirectFound,
+		CacheMaxAge:  &maxAge,
+	})
+	require.NoError(t, err)
+
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	require.NoError(t, appInstance.applySettings(config.Reloadable{LogLevel: "info", QRLevel: "M", RedirectStatus: "307", RedirectMaxAge: 3600}))
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		path         string
+		code         int
+		location     string
+		cacheControl string
+	}{
+		{name: "default", path: "/default", code: http.StatusTemporaryRedirect, location: "https://yoga.org/default", cacheControl: "no-store"},
+		{name: "301", path: "/moved", code: http.StatusMovedPermanently, location: "https://yoga.org/moved", cacheControl: "public, max-age=3600"},
+		{name: "302", path: "/found", code: http.StatusFound, location: "https://yoga.org/found", cacheControl: "no-store"},
+		{name: "308", path: "/perm", code: http.StatusPermanentRedirect, location: "https://yoga.org/perm", cacheControl: "public, max-age=3600"},
+		{name: "per-link max age", path: "/campaign", code: http.StatusFound, location: "https://yoga.org/campaign", cacheControl: "public, max-age=60"},
+		{name: "interstitial", path: "/page", code: http.StatusOK, cacheControl: "no-store"},
+		{name: "plus suffix", path: "/moved+", code: http.StatusOK, cacheControl: "no-store"},
+		{name: "preview query", path: "/found?preview=1", code: http.StatusOK, cacheControl: "no-store"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			w := httptest.NewRecorder()
+
+			routes.ServeHTTP(w, req)
+
+			assert.Equal(t, test.code, w.Code)
+			assert.Equal(t, test.location, w.Header().Get("Location"))
+			assert.Equal(t, test.cacheControl, w.Header().Get("Cache-Control"))
+			if test.code == http.StatusOK {
+				assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Body.String(), "https://yoga.org/")
+			}
+		})
+	}
+}
+
 func Test_shortenerHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	s := storeMock.NewMockStore(ctrl)
@@ -331,7 +439,7 @@ func Test_postBatchHandler(t *testing.T) {
 
 	//установим условие: при любом вызове метода Save не возвращались ошибки
 	s.EXPECT().
-		SaveBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		SaveBatch(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).AnyTimes()
 
 	// создадим экземпляр приложения и передадим ему «хранилище»
@@ -406,6 +514,195 @@ func Test_postBatchHandler(t *testing.T) {
 			assert.Equal(t, test.want.contentType, resp.Header.Get("Content-Type"))
 		})
 	}
+
+	// correlation_id служит идентификатором ссылки, повтор в пакете — конфликт
+	t.Run("duplicate correlation_id", func(t *testing.T) {
+		memApp, err := newApp(storage.New(), "http://localhost:0007", "")
+		require.NoError(t, err)
+		dup := `[{"correlation_id": "1", "original_url": "http://a.biz"}, {"correlation_id": "1", "original_url": "http://b.biz"}]`
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(dup))
+		w := httptest.NewRecorder()
+		memApp.PostBatch()(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func Test_routesMatchSpec(t *testing.T) {
+	appInstance, err := newApp(storage.New(), "http://localhost:0007", "")
+	require.NoError(t, err)
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+
+	// все маршруты роутера описаны в спецификации
+	registered := map[string]bool{}
+	err = chi.Walk(routes, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		_, ok := spec.Operation(method, route)
+		assert.True(t, ok, "route %s %s is missing in openapi.json", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// все операции спецификации зарегистрированы в роутере
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			key := strings.ToUpper(method) + " " + path
+			assert.True(t, registered[key], "operation %s is missing in router", key)
+		}
+	}
+}
+
+func Test_requestValidation(t *testing.T) {
+	appInstance, err := newApp(storage.New(), "http://localhost:0007", "")
+	require.NoError(t, err)
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{
+			name: "valid request",
+			path: "/api/shorten",
+			body: `{"url":"https://yoga.org/"}`,
+			code: http.StatusCreated,
+		},
+		{
+			name: "unknown field",
+			path: "/api/shorten",
+			body: `{"url":"https://yoga.org/","ttl":10}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "missing url",
+			path: "/api/shorten",
+			body: `{}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "oversize batch",
+			path: "/api/shorten/batch",
+			body: "[" + strings.TrimSuffix(strings.Repeat(`{"correlation_id":"1","original_url":"http://ya.ru"},`, 1001), ",") + "]",
+			code: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+test.path, strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+}
+
+func Test_qrHandler(t *testing.T) {
+	s := storage.New()
+	_, err := s.Save(context.Background(), store.URL{
+		OriginalURL: "https://yoga.org/",
+		GeneratedID: "875910c4",
+	})
+	require.NoError(t, err)
+
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+	}{
+		{
+			name:        "png by default",
+			path:        "/875910c4/qr",
+			code:        http.StatusOK,
+			contentType: "image/png",
+		},
+		{
+			name:        "svg",
+			path:        "/875910c4/qr?format=svg&size=128",
+			code:        http.StatusOK,
+			contentType: "image/svg+xml",
+		},
+		{
+			name: "unknown format",
+			path: "/875910c4/qr?format=gif",
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "size too large",
+			path: "/875910c4/qr?size=100000",
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "unknown id",
+			path: "/unknown/qr",
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := testRequest(t, ts, http.MethodGet, test.path, nil)
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+			if test.contentType != "" {
+				assert.Equal(t, test.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		resp, _ := testRequest(t, ts, http.MethodGet, "/875910c4/qr", nil)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		tests := []struct {
+			header string
+			code   int
+		}{
+			{header: etag, code: http.StatusNotModified},
+			{header: `"other", ` + etag, code: http.StatusNotModified},
+			{header: "W/" + etag, code: http.StatusNotModified},
+			{header: "*", code: http.StatusNotModified},
+			{header: `"other"`, code: http.StatusOK},
+		}
+		for _, test := range tests {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/875910c4/qr", nil)
+			require.NoError(t, err)
+			req.Header.Set("If-None-Match", test.header)
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode, test.header)
+		}
+	})
 }
 
 //func TestGzipCompression(t *testing.T) {
@@ -480,3 +777,854 @@ func Test_postBatchHandler(t *testing.T) {
 //		require.NoError(t, err)
 //	})
 //}
+
+func Test_reloader(t *testing.T) {
+	current, err := config.Load(nil, nil)
+	require.NoError(t, err)
+
+	appInstance, err := newApp(storage.New(), current.BaseURL, "")
+	require.NoError(t, err)
+	require.NoError(t, appInstance.applySettings(current.Reloadable()))
+
+	var args []string
+	r := newReloader(current, func() (*config.Config, error) { return config.Load(args, nil) }, appInstance.applySettings)
+
+	args = []string{"-r", "301", "-redirect-max-age", "60", "-q", "H"}
+	require.NoError(t, r.reload())
+	assert.Equal(t, store.RedirectMovedPermanently, appInstance.settings.Load().redirectMode)
+	assert.Equal(t, 60, appInstance.settings.Load().redirectCacheMaxAge)
+
+	// смена адреса требует перезапуска, действующие настройки не меняются
+	args = []string{"-a", "localhost:9090", "-r", "302"}
+	var restart *config.RestartRequiredError
+	require.ErrorAs(t, r.reload(), &restart)
+	assert.Equal(t, store.RedirectMovedPermanently, appInstance.settings.Load().redirectMode)
+}
+
+func Test_bodyLimits(t *testing.T) {
+	appInstance, err := newApp(storage.New(), "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.bodyLimits = limits.Config{
+		Default: limits.Limits{MaxBodySize: 1024, MaxDecompressedSize: 2048},
+		Routes:  map[string]limits.Limits{"/": {MaxBodySize: 64}},
+	}
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+
+	gzipped := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.String()
+	}
+	// тело сжимается почти в ноль, но после распаковки превышает лимит
+	bomb := `{"url":"https://yoga.org/` + strings.Repeat("a", 4096) + `"}`
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		encoding string
+		code     int
+	}{
+		{name: "within limit", path: "/api/shorten", body: `{"url":"https://yoga.org/"}`, code: http.StatusCreated},
+		{name: "raw body too large", path: "/api/shorten", body: `{"url":"https://yoga.org/` + strings.Repeat("a", 1024) + `"}`, code: http.StatusRequestEntityTooLarge},
+		{name: "route override", path: "/", body: "https://yoga.org/" + strings.Repeat("a", 64), code: http.StatusRequestEntityTooLarge},
+		{name: "compressed within limit", path: "/api/shorten", body: gzipped(`{"url":"https://yoga.org/"}`), encoding: "gzip", code: http.StatusCreated},
+		{name: "decompression bomb", path: "/api/shorten", body: gzipped(bomb), encoding: "gzip", code: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+test.path, strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if test.path == "/" {
+				req.Header.Set("Content-Type", "text/plain")
+			}
+			req.Header.Set("Content-Encoding", test.encoding)
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+}
+
+func Test_domains(t *testing.T) {
+	appInstance, err := newApp(storage.New(), "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.domains, err = domains.New("http://localhost:0007", []domains.Domain{
+		{Host: "sho.rt", BaseURL: "https://sho.rt", IDLength: 4},
+		{Host: "brand.example", BaseURL: "https://brand.example"},
+	})
+	require.NoError(t, err)
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, host, path, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	// один и тот же идентификатор на двух доменах ведёт в разные места
+	for host, url := range map[string]string{"sho.rt": "https://yoga.org/", "brand.example": "https://brand.example/yoga"} {
+		resp := do(http.MethodPost, host, "/api/shorten/batch", `[{"correlation_id":"yoga","original_url":"`+url+`"}]`)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var batch models.ResponseBodyBatch
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+		require.Len(t, batch, 1)
+		assert.Equal(t, "https://"+host+"/yoga", batch[0].ShortURL)
+	}
+
+	resp := do(http.MethodGet, "sho.rt", "/yoga", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://yoga.org/", resp.Header.Get("Location"))
+
+	resp = do(http.MethodGet, "brand.example:8080", "/yoga", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://brand.example/yoga", resp.Header.Get("Location"))
+
+	// идентификатор генерируется с длиной, заданной доменом
+	resp = do(http.MethodPost, "sho.rt", "/", "https://yoga.org/asanas")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Regexp(t, `^https://sho\.rt/[0-9a-f]{4}$`, string(body))
+}
+
+func Test_apiKeys(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+
+	// ключи выдаются той же подкомандой, что и в продакшене
+	var out bytes.Buffer
+	require.NoError(t, apiKeyCommand(context.Background(), s, "issue", []string{"-user", "billing", "-scopes", "create,read-stats"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	token := lines[len(lines)-1]
+
+	keys, err := s.ListKeys(context.Background(), "billing")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotContains(t, token, keys[0].Hash, "token must not be stored")
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+
+	do := func(method, path, contentType, body, token string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/", "text/plain", "https://yoga.org/", token)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Empty(t, resp.Cookies(), "api key requests don't get a cookie")
+
+	// ссылка принадлежит владельцу ключа
+	resp = do(http.MethodGet, "/api/user/urls", "", "", token)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var urls []models.UserURL
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&urls))
+	require.Len(t, urls, 1)
+	assert.Equal(t, "https://yoga.org/", urls[0].OriginalURL)
+
+	resp = do(http.MethodDelete, "/api/user/urls", "application/json", `["x"]`, token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "key has no delete scope")
+
+	resp = do(http.MethodPost, "/", "text/plain", "https://yoga.org/", token[:len(token)-1]+"x")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	out.Reset()
+	require.NoError(t, apiKeyCommand(context.Background(), s, "revoke", []string{keys[0].ID}, &out))
+	resp = do(http.MethodGet, "/api/user/urls", "", "", token)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	assert.Error(t, apiKeyCommand(context.Background(), s, "issue", []string{"-scopes", "superuser"}, &out))
+}
+
+func Test_admin(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+
+	ctx := context.Background()
+	for _, u := range []store.URL{
+		{OriginalURL: "https://evil.example/a", GeneratedID: "a", UserID: "alice"},
+		{OriginalURL: "https://EVIL.example:8443/b", GeneratedID: "b", UserID: "bob"},
+		{OriginalURL: "https://yoga.org/", GeneratedID: "c", UserID: "alice"},
+		{Namespace: "brand.example", OriginalURL: "https://evil.example/d", GeneratedID: "a", UserID: "carol"},
+	} {
+		_, err = s.Save(ctx, u)
+		require.NoError(t, err)
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, apiKeyCommand(ctx, s, "issue", []string{"-user", "ops", "-scopes", "admin"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	adminToken := lines[len(lines)-1]
+	out.Reset()
+	require.NoError(t, apiKeyCommand(ctx, s, "issue", []string{"-user", "ops", "-scopes", "create,read-stats,delete"}, &out))
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	userToken := lines[len(lines)-1]
+
+	keys, err := s.ListKeys(ctx, "ops")
+	require.NoError(t, err)
+	var adminKeyID string
+	for _, key := range keys {
+		if slices.Contains(key.Scopes, auth.ScopeAdmin) {
+			adminKeyID = key.ID
+		}
+	}
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, path, body, token string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+	search := func(query string) models.AdminURLPage {
+		resp := do(http.MethodGet, "/admin/urls"+query, "", adminToken)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var page models.AdminURLPage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		return page
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/urls", "", "").StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/urls", "", userToken).StatusCode)
+
+	// поиск по хосту назначения без учёта регистра и порта, постранично
+	page := search("?host=evil.example&limit=2")
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, []string{"a", "b"}, []string{page.URLs[0].ID, page.URLs[1].ID})
+	assert.Equal(t, "http://localhost:0007/a", page.URLs[0].ShortURL)
+	require.NotEmpty(t, page.NextCursor)
+	page = search("?host=evil.example&limit=2&cursor=" + page.NextCursor)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, "brand.example", page.URLs[0].Namespace)
+	assert.Empty(t, page.NextCursor)
+
+	page = search("?user_id=alice")
+	assert.Len(t, page.URLs, 2)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/urls?cursor=!!", "", adminToken).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/urls?limit=0", "", adminToken).StatusCode)
+
+	// отключённая ссылка отвечает 410, включённая снова перенаправляет
+	resp := do(http.MethodPost, "/admin/urls/a/disable", `{"reason":"phishing"}`, adminToken)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, http.StatusGone, do(http.MethodGet, "/a", "", "").StatusCode)
+	assert.Len(t, search("?disabled=true").URLs, 1)
+
+	resp = do(http.MethodPost, "/admin/urls/a/enable", "", adminToken)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, http.StatusTemporaryRedirect, do(http.MethodGet, "/a", "", "").StatusCode)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/urls/zzz/disable", "", adminToken).StatusCode)
+
+	// пакетное отключение сообщает о ненайденных ссылках
+	resp = do(http.MethodPost, "/admin/urls/disable", `{"urls":[{"id":"b"},{"namespace":"brand.example","id":"a"},{"id":"zzz"}],"reason":"phishing"}`, adminToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var bulk models.AdminBulkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&bulk))
+	assert.Equal(t, []models.LinkRef{{ID: "b"}, {Namespace: "brand.example", ID: "a"}}, bulk.Disabled)
+	assert.Equal(t, []models.LinkRef{{ID: "zzz"}}, bulk.NotFound)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/urls/disable", `{"urls":[]}`, adminToken).StatusCode)
+
+	// передача ссылки другому пользователю
+	resp = do(http.MethodPost, "/admin/urls/c/reassign", `{"user_id":"dave"}`, adminToken)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	urls, err := s.GetUserURLs(ctx, "dave")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "c", urls[0].GeneratedID)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/urls/c/reassign", `{}`, adminToken).StatusCode)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/urls/zzz/reassign", `{"user_id":"dave"}`, adminToken).StatusCode)
+
+	// каждое действие записано в журнал аудита от имени ключа
+	auditPage := func(query string) models.AdminAuditPage {
+		resp := do(http.MethodGet, "/admin/audit"+query, "", adminToken)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var page models.AdminAuditPage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		return page
+	}
+	events := auditPage("").Events
+	actions := make([]string, 0, len(events))
+	for _, e := range events {
+		assert.Equal(t, "key:"+adminKeyID, e.Actor)
+		assert.NotEmpty(t, e.RequestID)
+		actions = append(actions, e.Action+" "+e.Namespace+"/"+e.URLID)
+	}
+	require.Equal(t, []string{"disable /a", "enable /a", "disable /b", "disable brand.example/a", "reassign /c"}, actions)
+	assert.Equal(t, "phishing", events[0].Details["reason"])
+	assert.False(t, events[0].Before.Disabled)
+	assert.True(t, events[0].After.Disabled)
+	assert.Equal(t, "alice", events[4].Before.UserID)
+	assert.Equal(t, "dave", events[4].After.UserID)
+
+	// выборка по ссылке, действию и времени, постранично
+	page2 := auditPage("?namespace=&id=a&limit=1")
+	require.Len(t, page2.Events, 1)
+	assert.Equal(t, audit.ActionDisable, page2.Events[0].Action)
+	page2 = auditPage("?namespace=&id=a&limit=1&cursor=" + page2.NextCursor)
+	require.Len(t, page2.Events, 1)
+	assert.Equal(t, audit.ActionEnable, page2.Events[0].Action)
+	assert.Empty(t, page2.NextCursor)
+	assert.Len(t, auditPage("?action=disable").Events, 3)
+	assert.Empty(t, auditPage("?to="+events[0].Time.Format(time.RFC3339Nano)).Events)
+	assert.Len(t, auditPage("?from="+events[0].Time.Format(time.RFC3339Nano)).Events, 5)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/audit?from=yesterday", "", adminToken).StatusCode)
+
+	// идентификатор запроса клиента попадает в журнал
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/admin/urls/c/disable", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set(audit.RequestIDHeader, "req-42")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "req-42", resp.Header.Get(audit.RequestIDHeader))
+	events = auditPage("?id=c&action=disable").Events
+	require.Len(t, events, 1)
+	assert.Equal(t, "req-42", events[0].RequestID)
+
+	// создание и удаление ссылок пользователем тоже попадают в журнал
+	resp = do(http.MethodPost, "/api/shorten", `{"url":"https://new.example/"}`, userToken)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	events = auditPage("?action=create").Events
+	require.Len(t, events, 1)
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, "https://new.example/", events[0].After.OriginalURL)
+	assert.NotEqual(t, "key:"+adminKeyID, events[0].Actor)
+
+	resp = do(http.MethodDelete, "/api/user/urls", `["`+events[0].URLID+`","zzz"]`, userToken)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	events = auditPage("?action=delete").Events
+	require.Len(t, events, 1)
+	assert.True(t, events[0].After.Deleted)
+}
+
+func Test_editURL(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+
+	issue := func(user, scopes string) string {
+		var out bytes.Buffer
+		require.NoError(t, apiKeyCommand(context.Background(), s, "issue", []string{"-user", user, "-scopes", scopes}, &out))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		return lines[len(lines)-1]
+	}
+	owner := issue("alice", "create,read-stats,update")
+	readOnly := issue("alice", "read-stats")
+	stranger := issue("bob", "read-stats,update")
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, path, body, token string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+	decode := func(resp *http.Response, v any) {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+
+	resp := do(http.MethodPost, "/api/shorten", `{"url":"https://old.example/"}`, owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created models.Response
+	decode(resp, &created)
+	id := created.Result[strings.LastIndex(created.Result, "/")+1:]
+
+	resp = do(http.MethodGet, "/api/urls/"+id, "", owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	var details models.URLDetails
+	decode(resp, &details)
+	assert.Equal(t, "https://old.example/", details.OriginalURL)
+	assert.Equal(t, int64(1), details.Version)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/urls/"+id, "", stranger).StatusCode)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPatch, "/api/urls/"+id, `{"version":1}`, stranger).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPatch, "/api/urls/"+id, `{"version":1}`, readOnly).StatusCode)
+
+	// без версии изменение отклоняется
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodPatch, "/api/urls/"+id, `{"url":"https://new.example/"}`, owner).StatusCode)
+	// нулевая версия — не отказ от проверки, для него есть только If-Match: *
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, `{"url":"https://new.example/","version":0}`, owner, "If-Match", "*").StatusCode)
+
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"url":"https://new.example/","redirect_mode":"308"}`, owner, "If-Match", `"1"`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	decode(resp, &details)
+	assert.Equal(t, "https://new.example/", details.OriginalURL)
+	assert.Equal(t, "308", details.RedirectMode)
+
+	// изменение устаревшей версии не перезаписывает чужую правку
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"url":"https://lost.example/"}`, owner, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, `{"url":"","version":2}`, owner).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, `{"expires_at":"tomorrow","version":2}`, owner).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, `{"version":2}`, owner, "If-Match", "W/x").StatusCode)
+
+	// перенаправление ведёт на новый адрес и, раз ссылку уже меняли, не кэшируется,
+	// чтобы следующая правка дошла до клиентов сразу
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"expires_at":"`+expiresAt+`","version":2}`, owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(http.MethodGet, "/"+id, "", "")
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://new.example/", resp.Header.Get("Location"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	// истёкшая ссылка отвечает 410, но владелец по-прежнему может её продлить
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"expires_at":"`+expired+`"}`, owner, "If-Match", "*")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusGone, do(http.MethodGet, "/"+id, "", "").StatusCode)
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"expires_at":""}`, owner, "If-Match", `"4"`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusPermanentRedirect, do(http.MethodGet, "/"+id, "", "").StatusCode)
+
+	// история хранит прежние редакции
+	resp = do(http.MethodGet, "/api/urls/"+id+"/history", "", owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var revisions []models.URLRevision
+	decode(resp, &revisions)
+	require.Len(t, revisions, 4)
+	for i, revision := range revisions {
+		assert.Equal(t, int64(i+1), revision.Version)
+		assert.NotEmpty(t, revision.ReplacedBy)
+	}
+	assert.Equal(t, "https://old.example/", revisions[0].OriginalURL)
+	assert.Empty(t, revisions[0].RedirectMode)
+	assert.Equal(t, "https://new.example/", revisions[1].OriginalURL)
+	assert.Nil(t, revisions[1].ExpiresAt)
+	assert.NotNil(t, revisions[2].ExpiresAt)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/urls/"+id+"/history", "", stranger).StatusCode)
+}
+
+func Test_splitURL(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+
+	var out bytes.Buffer
+	require.NoError(t, apiKeyCommand(context.Background(), s, "issue", []string{"-user", "growth", "-scopes", "create,read-stats,update"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	token := lines[len(lines)-1]
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, path, body string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+	withKey := func(header ...string) []string {
+		return append([]string{"Authorization", "Bearer " + token}, header...)
+	}
+
+	resp := do(http.MethodPost, "/api/shorten", `{"url":"https://landing.example/"}`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created models.Response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	id := created.Result[strings.LastIndex(created.Result, "/")+1:]
+
+	for _, body := range []string{
+		`{"destinations":[{"url":"https://a.example/","weight":0}],"version":1}`,
+		`{"destinations":[{"variant":"x","url":"https://a.example/","weight":1},{"variant":"x","url":"https://b.example/","weight":1}],"version":1}`,
+		`{"destinations":[{"variant":"no spaces","url":"https://a.example/","weight":1}],"version":1}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, body, withKey()...).StatusCode, body)
+	}
+
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"destinations":[{"url":"https://a.example/","weight":1},{"variant":"new-cta","url":"https://b.example/","weight":1}],"version":1}`, withKey()...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var details models.URLDetails
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	require.Len(t, details.Destinations, 2)
+	assert.Equal(t, "a", details.Destinations[0].Variant)
+
+	// разные клиенты попадают в разные варианты, один клиент — всегда в один
+	served := map[string]int{}
+	for i := 0; i < 40; i++ {
+		agent := fmt.Sprintf("agent-%d", i)
+		resp = do(http.MethodGet, "/"+id, "", "User-Agent", agent)
+		require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		location := resp.Header.Get("Location")
+		served[location]++
+		assert.Equal(t, location, do(http.MethodGet, "/"+id, "", "User-Agent", agent).Header.Get("Location"))
+	}
+	assert.Len(t, served, 2)
+
+	// cookie закрепляет вариант независимо от клиента
+	resp = do(http.MethodGet, "/"+id, "", "Cookie", split.CookiePrefix+id+"=new-cta")
+	assert.Equal(t, "https://b.example/", resp.Header.Get("Location"))
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "new-cta", resp.Cookies()[0].Value)
+
+	// предпросмотр показывает вариант, но не считается переходом
+	resp = do(http.MethodGet, "/"+id+"+", "", "Cookie", split.CookiePrefix+id+"=a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "https://a.example/")
+
+	resp = do(http.MethodGet, "/api/urls/"+id, "", withKey()...)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	require.Len(t, details.Destinations, 2)
+	assert.Equal(t, int64(81), details.Destinations[0].Clicks+details.Destinations[1].Clicks)
+	assert.Equal(t, int64(served["https://a.example/"]*2), details.Destinations[0].Clicks)
+
+	// счётчики сохраняются при смене весов и пропадают вместе с вариантом
+	clicksA := details.Destinations[0].Clicks
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"destinations":[{"variant":"a","url":"https://a.example/","weight":9}]}`, withKey("If-Match", "*")...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	require.Len(t, details.Destinations, 1)
+	assert.Equal(t, clicksA, details.Destinations[0].Clicks)
+
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"destinations":[]}`, withKey("If-Match", "*")...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://landing.example/", do(http.MethodGet, "/"+id, "").Header.Get("Location"))
+
+	// варианты, заданные при создании, действуют с первого перехода
+	resp = do(http.MethodPost, "/api/shorten", `{"url":"https://fallback.example/","destinations":[{"url":"https://only.example/","weight":1}]}`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, "https://only.example/", do(http.MethodGet, created.Result[strings.LastIndex(created.Result, "/"):], "").Header.Get("Location"))
+
+	resp = do(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"split-batch","original_url":"https://batch.example/","destinations":[{"variant":"cta","url":"https://cta.example/","weight":1}]}]`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = do(http.MethodGet, "/split-batch", "")
+	assert.Equal(t, "https://cta.example/", resp.Header.Get("Location"))
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "cta", resp.Cookies()[0].Value)
+
+	for path, body := range map[string]string{
+		"/api/shorten":       `{"url":"https://bad.example/","destinations":[{"url":"https://a.example/","weight":0}]}`,
+		"/api/shorten/batch": `[{"correlation_id":"bad","original_url":"https://bad.example/","destinations":[{"variant":"x","url":"https://a.example/","weight":1},{"variant":"x","url":"https://b.example/","weight":1}]}]`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, path, body, withKey()...).StatusCode, path)
+	}
+}
+
+func Test_redirectRules(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+	// тестовый сервер принимает соединения с 127.0.0.1
+	countries, err := geoip.Read(strings.NewReader("127.0.0.0,127.255.255.255,NL\n"))
+	require.NoError(t, err)
+	appInstance.countries = countries
+
+	var out bytes.Buffer
+	require.NoError(t, apiKeyCommand(context.Background(), s, "issue", []string{"-user", "mobile", "-scopes", "create,read-stats,update"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	token := lines[len(lines)-1]
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, path, body string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+	withKey := func(header ...string) []string {
+		return append([]string{"Authorization", "Bearer " + token}, header...)
+	}
+
+	resp := do(http.MethodPost, "/api/shorten", `{"url":"https://app.example/"}`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created models.Response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	id := created.Result[strings.LastIndex(created.Result, "/")+1:]
+
+	for _, body := range []string{
+		`{"rules":[{"field":"referer","values":["x"],"url":"https://a.example/"}],"version":1}`,
+		`{"rules":[{"field":"device","values":["tablet"],"url":"https://a.example/"}],"version":1}`,
+		`{"rules":[{"field":"cidr","values":["10.0.0.0/33"],"url":"https://a.example/"}],"version":1}`,
+		`{"rules":[{"field":"language","values":[],"url":"https://a.example/"}],"version":1}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/api/urls/"+id, body, withKey()...).StatusCode, body)
+	}
+
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"rules":[
+		{"field":"device","values":["ios"],"url":"https://apps.apple.com/app/id1"},
+		{"field":"language","values":["ru"],"url":"https://app.example/ru/"},
+		{"field":"country","values":["NL","BE"],"url":"https://app.example/benelux/"},
+		{"field":"cidr","values":["10.0.0.0/8"],"url":"https://intranet.example/"}
+	],"version":1}`, withKey()...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var details models.URLDetails
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	require.Len(t, details.Rules, 4)
+
+	tests := []struct {
+		name   string
+		header []string
+		want   string
+	}{
+		{name: "ios wins over language", header: []string{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "Accept-Language", "ru"}, want: "https://apps.apple.com/app/id1"},
+		{name: "language", header: []string{"User-Agent", "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language", "ru-RU,en;q=0.5"}, want: "https://app.example/ru/"},
+		{name: "country", header: []string{"User-Agent", "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language", "en"}, want: "https://app.example/benelux/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(http.MethodGet, "/"+id, "", tt.header...)
+			require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			assert.Equal(t, tt.want, resp.Header.Get("Location"))
+			assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		})
+	}
+
+	// пустой список удаляет правила, и переход снова ведёт на обычный адрес
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"rules":[]}`, withKey("If-Match", "*")...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var cleared models.URLDetails
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cleared))
+	assert.Empty(t, cleared.Rules)
+	assert.Equal(t, "https://app.example/", do(http.MethodGet, "/"+id, "", "User-Agent", "iPhone").Header.Get("Location"))
+
+	// правила, заданные при создании, действуют с первого перехода
+	resp = do(http.MethodPost, "/api/shorten", `{"url":"https://web.example/","rules":[{"field":"language","values":["ru"],"url":"https://web.example/ru/"}]}`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, "https://web.example/ru/", do(http.MethodGet, created.Result[strings.LastIndex(created.Result, "/"):], "", "Accept-Language", "ru").Header.Get("Location"))
+
+	resp = do(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"rules-batch","original_url":"https://batch.example/","rules":[{"field":"country","values":["NL"],"url":"https://batch.example/nl/"}]}]`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "https://batch.example/nl/", do(http.MethodGet, "/rules-batch", "").Header.Get("Location"))
+
+	for path, body := range map[string]string{
+		"/api/shorten":       `{"url":"https://bad.example/","rules":[{"field":"device","values":["tablet"],"url":"https://a.example/"}]}`,
+		"/api/shorten/batch": `[{"correlation_id":"bad","original_url":"https://bad.example/","rules":[{"field":"cidr","values":["10.0.0.0/33"],"url":"https://a.example/"}]}]`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, path, body, withKey()...).StatusCode, path)
+	}
+}
+
+func Test_queryPassthrough(t *testing.T) {
+	s := storage.New()
+	appInstance, err := newApp(s, "http://localhost:0007", "")
+	require.NoError(t, err)
+	appInstance.authenticator.UseKeys(s)
+	require.NoError(t, appInstance.applySettings(config.Reloadable{
+		LogLevel:       "info",
+		QRLevel:        "M",
+		RedirectStatus: "307",
+		UTMTemplates: map[string]string{
+			"default":    "utm_source=short&utm_medium={domain}",
+			"newsletter": "utm_source=newsletter&utm_medium=email",
+		},
+	}))
+
+	var out bytes.Buffer
+	require.NoError(t, apiKeyCommand(context.Background(), s, "issue", []string{"-user", "marketing", "-scopes", "create,read-stats,update"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	token := lines[len(lines)-1]
+
+	routes, err := ShortenerRoutes("http://localhost:0007", *appInstance)
+	require.NoError(t, err)
+	ts := httptest.NewServer(routes)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, path, body string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+	withKey := func(header ...string) []string {
+		return append([]string{"Authorization", "Bearer " + token}, header...)
+	}
+	shorten := func(body string) string {
+		resp := do(http.MethodPost, "/api/shorten", body, withKey()...)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, body)
+		var created models.Response
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+		return created.Result[strings.LastIndex(created.Result, "/")+1:]
+	}
+	originalURL := func(id string) string {
+		var details models.URLDetails
+		require.NoError(t, json.NewDecoder(do(http.MethodGet, "/api/urls/"+id, "", withKey()...).Body).Decode(&details))
+
+		return details.OriginalURL
+	}
+
+	// шаблон по умолчанию не заменяет метки, уже указанные в адресе
+	id := shorten(`{"url":"https://shop.example/?utm_source=site","query_passthrough":"keep"}`)
+	assert.Equal(t, "https://shop.example/?utm_source=site&utm_medium=localhost", originalURL(id))
+	assert.Equal(t, "https://shop.example/?utm_source=newsletter&utm_medium=email",
+		originalURL(shorten(`{"url":"https://shop.example/","utm_template":"newsletter"}`)))
+	assert.Equal(t, "https://shop.example/plain", originalURL(shorten(`{"url":"https://shop.example/plain","utm_template":"none"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/shorten", `{"url":"https://shop.example/x","utm_template":"spring"}`, withKey()...).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/shorten", `{"url":"https://shop.example/x","query_passthrough":"merge"}`, withKey()...).StatusCode)
+
+	// keep добавляет только параметры, которых нет в адресе
+	resp := do(http.MethodGet, "/"+id+"?utm_source=ad&ref=abc", "")
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://shop.example/?utm_source=site&utm_medium=localhost&ref=abc", resp.Header.Get("Location"))
+
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"query_passthrough":"override"}`, withKey("If-Match", "*")...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var details models.URLDetails
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	assert.Equal(t, "override", details.QueryPassthrough)
+
+	resp = do(http.MethodGet, "/"+id+"?utm_source=ad&ref=abc", "")
+	assert.Equal(t, "https://shop.example/?utm_medium=localhost&ref=abc&utm_source=ad", resp.Header.Get("Location"))
+
+	// страница предпросмотра показывает адрес с параметрами, кроме служебного preview
+	resp = do(http.MethodGet, "/"+id+"?preview=1&ref=abc", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "ref=abc")
+	assert.NotContains(t, string(page), "preview=1")
+
+	// без переноса параметры перехода отбрасываются
+	resp = do(http.MethodPatch, "/api/urls/"+id, `{"query_passthrough":""}`, withKey("If-Match", "*")...)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://shop.example/?utm_source=site&utm_medium=localhost", do(http.MethodGet, "/"+id+"?ref=abc", "").Header.Get("Location"))
+
+	// пакет и текстовый запрос тоже получают метки шаблонов
+	resp = do(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"spring","original_url":"https://shop.example/spring","utm_template":"newsletter","query_passthrough":"keep"}]`, withKey()...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "https://shop.example/spring?utm_source=newsletter&utm_medium=email&ref=abc", do(http.MethodGet, "/spring?ref=abc", "").Header.Get("Location"))
+
+	resp = do(http.MethodPost, "/", "https://shop.example/text", withKey("Content-Type", "text/plain")...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	short, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	textID := string(short)[strings.LastIndex(string(short), "/")+1:]
+	assert.Equal(t, "https://shop.example/text?utm_source=short&utm_medium=localhost", do(http.MethodGet, "/"+textID, "").Header.Get("Location"))
+}
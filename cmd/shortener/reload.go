@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/config"
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// configPollInterval — как часто проверяется время изменения файла конфигурации
+const configPollInterval = 5 * time.Second
+
+// reloader перечитывает конфигурацию и применяет её перезагружаемую часть
+type reloader struct {
+	current *config.Config
+	load    func() (*config.Config, error)
+	apply   func(config.Reloadable) error
+	modTime time.Time
+}
+
+func newReloader(cfg *config.Config, load func() (*config.Config, error), apply func(config.Reloadable) error) *reloader {
+	r := &reloader{current: cfg, load: load, apply: apply}
+	r.modTime, _ = r.fileModTime()
+
+	return r
+}
+
+// watch ждёт SIGHUP или изменения файла конфигурации до отмены контекста
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Log.Info("got SIGHUP, reloading config")
+			r.reload()
+		case <-ticker.C:
+			modTime, err := r.fileModTime()
+			if err != nil || !modTime.After(r.modTime) {
+				continue
+			}
+			r.modTime = modTime
+			logger.Log.Info("config file changed, reloading config", zap.String("file", r.current.ConfigFile))
+			r.reload()
+		}
+	}
+}
+
+// reload применяет новую конфигурацию, если она меняет только перезагружаемые параметры.
+// При любой ошибке продолжает действовать текущая конфигурация.
+func (r *reloader) reload() error {
+	next, err := r.load()
+	if err != nil {
+		logger.Log.Error("can't reload config", zap.Error(err))
+		return err
+	}
+
+	if err = r.current.CheckReload(next); err != nil {
+		var restart *config.RestartRequiredError
+		if errors.As(err, &restart) {
+			logger.Log.Error("config reload rejected, restart the server to apply it", zap.Strings("fields", restart.Fields))
+		}
+		return err
+	}
+
+	if err = r.apply(next.Reloadable()); err != nil {
+		logger.Log.Error("can't apply config", zap.Error(err))
+		return err
+	}
+
+	r.current = next
+	logger.Log.Info("config reloaded", zap.Any("settings", next.Reloadable()))
+
+	return nil
+}
+
+func (r *reloader) fileModTime() (time.Time, error) {
+	if r.current.ConfigFile == "" {
+		return time.Time{}, errors.New("config file is not set")
+	}
+
+	info, err := os.Stat(r.current.ConfigFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
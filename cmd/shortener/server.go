@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/config"
+	"github.com/Nastez/shortener/internal/certs"
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// listen открывает сокет по адресу из конфигурации: TCP (в том числе IPv6) или unix
+func listen(cfg *config.Config) (net.Listener, error) {
+	if cfg.ListenNetwork == "unix" {
+		// удаляем сокет, оставшийся от предыдущего запуска
+		if err := os.Remove(cfg.ListenAddress); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return net.Listen(cfg.ListenNetwork, cfg.ListenAddress)
+}
+
+// tlsConfig загружает сертификат из файлов или генерирует самоподписанный
+func tlsConfig(cfg *config.Config) (*tls.Config, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+
+	if cfg.TLSCertFile != "" {
+		cert, err = tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		hosts := []string{"localhost", "127.0.0.1", "::1"}
+		if host, _, splitErr := net.SplitHostPort(cfg.ListenAddress); splitErr == nil {
+			hosts = append(hosts, host)
+		}
+		logger.Log.Warn("TLS certificate is not set, using self-signed certificate", zap.Strings("hosts", hosts))
+		cert, err = certs.SelfSigned(hosts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// serve запускает HTTP- или HTTPS-сервер на адресе из конфигурации
+func serve(cfg *config.Config, h http.Handler) error {
+	listener, err := listen(cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: h}
+
+	if !cfg.EnableHTTPS {
+		return srv.Serve(listener)
+	}
+
+	srv.TLSConfig, err = tlsConfig(cfg)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	return srv.ServeTLS(listener, "", "")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/logger"
+	"github.com/Nastez/shortener/internal/rules"
+	"github.com/Nastez/shortener/internal/services"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// GetUserURL возвращает ссылку {id} текущего пользователя с версией в заголовке ETag
+func (a *app) GetUserURL() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		userID, ok := auth.UserIDFromContext(ctx)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domain := a.domains.Resolve(req.Host)
+		url, err := services.GetUserURL(ctx, a.store, domain.Namespace, userID, chi.URLParam(req, "id"))
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Log.Info("cannot get user url", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(url.Version))
+		writeJSON(w, http.StatusOK, services.NewURLDetails(domain, url))
+	}
+}
+
+// PatchUserURL меняет адрес назначения, варианты, правила, режим перенаправления, перенос
+// параметров запроса или срок действия ссылки {id}.
+// Клиент передаёт прочитанную версию в заголовке If-Match или в поле version; без версии
+// запрос отклоняется с кодом 428, а если ссылку успели изменить — с кодом 412.
+// If-Match: * явно отключает проверку. Сервис не кэширует ссылки у себя,
+// а перенаправления изменённых ссылок отдаются с no-store, поэтому новое значение
+// действует со следующего перехода.
+func (a *app) PatchUserURL() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		userID, ok := auth.UserIDFromContext(ctx)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var patch models.URLPatch
+		if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+			logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatchVersion(req.Header.Get("If-Match"))
+		if !ok {
+			http.Error(w, "If-Match must be an ETag returned by GET /api/urls/{id} or *", http.StatusBadRequest)
+			return
+		}
+		if patch.Version != nil {
+			if *patch.Version < 1 {
+				http.Error(w, "version must be positive", http.StatusBadRequest)
+				return
+			}
+			version = *patch.Version
+		}
+
+		domain := a.domains.Resolve(req.Host)
+		url, err := services.UpdateURL(ctx, a.store, domain.Namespace, userID, chi.URLParam(req, "id"), version, patch)
+		switch {
+		case errors.Is(err, services.ErrVersionRequired):
+			// без версии нельзя проверить, что клиент меняет последнюю редакцию
+			http.Error(w, "If-Match header or version is required", http.StatusPreconditionRequired)
+			return
+		case errors.Is(err, services.ErrEmptyURL), errors.Is(err, services.ErrInvalidExpiry),
+			errors.Is(err, services.ErrInvalidDestinations), errors.Is(err, store.ErrInvalidRedirectMode),
+			errors.Is(err, rules.ErrInvalidRule), errors.Is(err, store.ErrInvalidQueryMode):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, store.ErrNotFound):
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		case errors.Is(err, store.ErrVersionMismatch):
+			http.Error(w, "URL was changed by another request, reload it and retry", http.StatusPreconditionFailed)
+			return
+		case errors.Is(err, store.ErrConflict):
+			http.Error(w, "URL is already shortened", http.StatusConflict)
+			return
+		case err != nil:
+			logger.Log.Info("cannot update user url", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(url.Version))
+		writeJSON(w, http.StatusOK, services.NewURLDetails(domain, url))
+	}
+}
+
+// GetUserURLHistory возвращает прежние редакции ссылки {id} текущего пользователя
+func (a *app) GetUserURLHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if a.auditLog == nil {
+			http.Error(w, "edit history is not supported by the storage", http.StatusNotImplemented)
+			return
+		}
+
+		userID, ok := auth.UserIDFromContext(ctx)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		namespace, id := a.domains.Resolve(req.Host).Namespace, chi.URLParam(req, "id")
+		_, err := services.GetUserURL(ctx, a.store, namespace, userID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Log.Info("cannot get user url", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		revisions, err := services.URLHistory(ctx, a.auditLog, namespace, id)
+		if err != nil {
+			logger.Log.Info("cannot get url history", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, revisions)
+	}
+}
+
+// versionETag возвращает сильный ETag версии ссылки
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion разбирает заголовок If-Match; пустой заголовок даёт версию 0 — версии нет,
+// а * — services.AnyVersion
+func ifMatchVersion(header string) (int64, bool) {
+	header = strings.TrimSpace(header)
+	switch header {
+	case "":
+		return 0, true
+	case "*":
+		return services.AnyVersion, true
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+
+	return version, true
+}
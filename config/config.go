@@ -1,104 +1,627 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/limits"
+	"github.com/Nastez/shortener/internal/utm"
 )
 
-// Env Переменные окружения
+const defaultBaseURL = "http://localhost:8080"
+
+// maxIDLength — наибольшая длина идентификатора ссылки домена
+const maxIDLength = 32
+
+// Env Переменные окружения.
+// Поля — указатели, чтобы отличать незаданную переменную от пустого значения.
 type Env struct {
-	ServerAddress             string `env:"SERVER_ADDRESS"`
-	BaseURL                   string `env:"BASE_URL"`
-	FileStoragePath           string `env:"FILE_STORAGE_PATH"`
-	DatabaseConnectionAddress string `env:"DATABASE_DSN"`
+	ConfigFile                *string        `env:"CONFIG"`
+	LogLevel                  *string        `env:"LOG_LEVEL"`
+	ServerAddress             *string        `env:"SERVER_ADDRESS"`
+	BaseURL                   *string        `env:"BASE_URL"`
+	Storage                   *string        `env:"STORAGE"`
+	FileStoragePath           *string        `env:"FILE_STORAGE_PATH"`
+	DatabaseConnectionAddress *string        `env:"DATABASE_DSN"`
+	GRPCAddress               *string        `env:"GRPC_ADDRESS"`
+	SecretKey                 *string        `env:"SECRET_KEY"`
+	QRLevel                   *string        `env:"QR_LEVEL"`
+	RedirectStatus            *string        `env:"REDIRECT_STATUS"`
+	RedirectMaxAge            *int           `env:"REDIRECT_MAX_AGE"`
+	EnableHTTPS               *bool          `env:"ENABLE_HTTPS"`
+	TLSCertFile               *string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile                *string        `env:"TLS_KEY_FILE"`
+	MaxBodySize               *int64         `env:"MAX_BODY_SIZE"`
+	MaxDecompressedSize       *int64         `env:"MAX_DECOMPRESSED_SIZE"`
+	MaxBatchItems             *int           `env:"MAX_BATCH_ITEMS"`
+	DBMaxOpenConns            *int           `env:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns            *int           `env:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime         *time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+	DBConnMaxIdleTime         *time.Duration `env:"DB_CONN_MAX_IDLE_TIME"`
+	AuthMode                  *string        `env:"AUTH_MODE"`
+	JWTAlgorithm              *string        `env:"JWT_ALG"`
+	JWTSecret                 *string        `env:"JWT_SECRET"`
+	JWTIssuer                 *string        `env:"JWT_ISSUER"`
+	JWTAudience               *string        `env:"JWT_AUDIENCE"`
+	JWTJWKSFile               *string        `env:"JWT_JWKS_FILE"`
+	JWTPrivateKeyFile         *string        `env:"JWT_PRIVATE_KEY_FILE"`
+	JWTKeyID                  *string        `env:"JWT_KEY_ID"`
+	JWTTTL                    *time.Duration `env:"JWT_TTL"`
+	GeoIPFile                 *string        `env:"GEOIP_FILE"`
+}
+
+// File — содержимое файла конфигурации в формате JSON или YAML
+type File struct {
+	LogLevel                  *string   `json:"log_level" yaml:"log_level"`
+	ServerAddress             *string   `json:"server_address" yaml:"server_address"`
+	BaseURL                   *string   `json:"base_url" yaml:"base_url"`
+	Storage                   *string   `json:"storage" yaml:"storage"`
+	FileStoragePath           *string   `json:"file_storage_path" yaml:"file_storage_path"`
+	DatabaseConnectionAddress *string   `json:"database_dsn" yaml:"database_dsn"`
+	GRPCAddress               *string   `json:"grpc_address" yaml:"grpc_address"`
+	SecretKey                 *string   `json:"secret_key" yaml:"secret_key"`
+	QRLevel                   *string   `json:"qr_level" yaml:"qr_level"`
+	RedirectStatus            *string   `json:"redirect_status" yaml:"redirect_status"`
+	RedirectMaxAge            *int      `json:"redirect_max_age" yaml:"redirect_max_age"`
+	EnableHTTPS               *bool     `json:"enable_https" yaml:"enable_https"`
+	TLSCertFile               *string   `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile                *string   `json:"tls_key_file" yaml:"tls_key_file"`
+	MaxBodySize               *int64    `json:"max_body_size" yaml:"max_body_size"`
+	MaxDecompressedSize       *int64    `json:"max_decompressed_size" yaml:"max_decompressed_size"`
+	MaxBatchItems             *int      `json:"max_batch_items" yaml:"max_batch_items"`
+	DBMaxOpenConns            *int      `json:"db_max_open_conns" yaml:"db_max_open_conns"`
+	DBMaxIdleConns            *int      `json:"db_max_idle_conns" yaml:"db_max_idle_conns"`
+	DBConnMaxLifetime         *Duration `json:"db_conn_max_lifetime" yaml:"db_conn_max_lifetime"`
+	DBConnMaxIdleTime         *Duration `json:"db_conn_max_idle_time" yaml:"db_conn_max_idle_time"`
+	AuthMode                  *string   `json:"auth_mode" yaml:"auth_mode"`
+	JWTAlgorithm              *string   `json:"jwt_alg" yaml:"jwt_alg"`
+	JWTSecret                 *string   `json:"jwt_secret" yaml:"jwt_secret"`
+	JWTIssuer                 *string   `json:"jwt_issuer" yaml:"jwt_issuer"`
+	JWTAudience               *string   `json:"jwt_audience" yaml:"jwt_audience"`
+	JWTJWKSFile               *string   `json:"jwt_jwks_file" yaml:"jwt_jwks_file"`
+	JWTPrivateKeyFile         *string   `json:"jwt_private_key_file" yaml:"jwt_private_key_file"`
+	JWTKeyID                  *string   `json:"jwt_key_id" yaml:"jwt_key_id"`
+	JWTTTL                    *Duration `json:"jwt_ttl" yaml:"jwt_ttl"`
+	GeoIPFile                 *string   `json:"geoip_file" yaml:"geoip_file"`
+	// RouteLimits — лимиты тела для отдельных маршрутов, задаются только в файле
+	RouteLimits map[string]limits.Limits `json:"route_limits" yaml:"route_limits"`
+	// Domains — короткие домены, задаются только в файле
+	Domains []domains.Domain `json:"domains" yaml:"domains"`
+	// UTMTemplates — именованные шаблоны UTM-меток, задаются только в файле
+	UTMTemplates map[string]string `json:"utm_templates" yaml:"utm_templates"`
+}
+
+// Duration — длительность в файле конфигурации в формате time.ParseDuration, например "5m"
+type Duration time.Duration
+
+// UnmarshalText разбирает длительность из строки
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
 }
 
 type Config struct {
-	ServerAddress             string
-	BaseURL                   string
-	FileStoragePath           string
-	Port                      string
-	FileName                  string
+	// ConfigFile — путь к файлу конфигурации, за изменениями которого следит перезагрузка
+	ConfigFile string
+	// Args — аргументы после флагов: подкоманда администрирования вместо запуска сервера
+	Args          []string
+	LogLevel      string
+	ServerAddress string
+	BaseURL       string
+	// Storage — имя хранилища: memory, file или postgres
+	Storage         string
+	FileStoragePath string
+	// ListenNetwork и ListenAddress — параметры net.Listen, полученные из ServerAddress
+	ListenNetwork             string
+	ListenAddress             string
 	DatabaseConnectionAddress string
+	GRPCAddress               string
+	SecretKey                 string
+	QRLevel                   string
+	RedirectStatus            string
+	RedirectMaxAge            int
+	EnableHTTPS               bool
+	// TLSCertFile и TLSKeyFile — пути к сертификату и ключу; если не заданы, при HTTPS
+	// на старте генерируется самоподписанный сертификат
+	TLSCertFile string
+	TLSKeyFile  string
+	// MaxBodySize и MaxDecompressedSize — лимиты тела запроса по умолчанию, до и после распаковки
+	MaxBodySize         int64
+	MaxDecompressedSize int64
+	// MaxBatchItems — наибольшее число элементов в пакетном запросе
+	MaxBatchItems int
+	// RouteLimits — переопределения лимитов тела по шаблону пути маршрута
+	RouteLimits map[string]limits.Limits
+	// Domains — короткие домены со своими базовыми адресами и пространствами имён;
+	// запросы на другие хосты обслуживаются с BaseURL
+	Domains []domains.Domain
+	// DBMaxOpenConns, DBMaxIdleConns, DBConnMaxLifetime и DBConnMaxIdleTime — параметры
+	// пула соединений с СУБД; 0 оставляет значение database/sql
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	// AuthMode — cookie (собственные подписанные токены) или jwt
+	AuthMode string
+	// JWTAlgorithm, JWTSecret, JWTIssuer, JWTAudience, JWTJWKSFile, JWTPrivateKeyFile,
+	// JWTKeyID и JWTTTL — параметры режима jwt, см. auth.JWTOptions
+	JWTAlgorithm      string
+	JWTSecret         string
+	JWTIssuer         string
+	JWTAudience       string
+	JWTJWKSFile       string
+	JWTPrivateKeyFile string
+	JWTKeyID          string
+	JWTTTL            time.Duration
+	// GeoIPFile — офлайн-база диапазонов IP-адресов и стран для правил перенаправления по стране
+	GeoIPFile string
+	// UTMTemplates — шаблоны UTM-меток по именам, например utm_source=short&utm_medium={domain};
+	// шаблон default добавляется к ссылкам, создаваемым через HTTP API, если клиент не выбрал другой
+	UTMTemplates map[string]string
+}
+
+// ValidationError описывает недопустимое значение параметра конфигурации
+type ValidationError struct {
+	Field   string
+	Value   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Message)
 }
 
-// New обрабатывает аргументы командной строки
-// и сохраняет их значения в соответствующих переменных
+// ValidationErrors — все ошибки валидации конфигурации
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// New собирает конфигурацию из аргументов командной строки и окружения процесса
 func New() (*Config, error) {
+	return Load(os.Args[1:], environ())
+}
+
+// Load собирает конфигурацию в порядке возрастания приоритета:
+// значения по умолчанию < файл конфигурации (-c или CONFIG) < переменные окружения < флаги.
+func Load(args []string, environment map[string]string) (*Config, error) {
+	cfg := defaults()
+
+	// первый разбор флагов нужен только для поиска файла конфигурации и проверки синтаксиса
+	var configFile string
+	if err := newFlagSet(&Config{}, &configFile).Parse(args); err != nil {
+		return nil, err
+	}
+
 	var envConf Env
-	err := env.Parse(&envConf)
+	if err := env.Parse(&envConf, env.Options{Environment: environment}); err != nil {
+		return nil, ValidationErrors{{Field: "environment", Message: err.Error()}}
+	}
+
+	if configFile == "" && envConf.ConfigFile != nil {
+		configFile = *envConf.ConfigFile
+	}
+
+	// fileStorageSet — путь к файлу хранилища задан явно, а не взят по умолчанию
+	fileStorageSet := envConf.FileStoragePath != nil
+
+	if configFile != "" {
+		file, err := readFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.applyFile(file)
+		fileStorageSet = fileStorageSet || file.FileStoragePath != nil
+	}
+
+	cfg.applyEnv(envConf)
+
+	// флаги разбираются поверх уже собранной конфигурации: незаданные флаги её не меняют
+	fs := newFlagSet(cfg, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.Args = fs.Args()
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "f" {
+			fileStorageSet = true
+		}
+	})
+
+	if cfg.EnableHTTPS && cfg.BaseURL == defaultBaseURL {
+		// без явного базового адреса короткие ссылки выдаются по https
+		cfg.BaseURL = "https://" + strings.TrimPrefix(defaultBaseURL, "http://")
+	}
+
+	if cfg.Storage == "" {
+		// хранилище не выбрано явно: строка подключения к СУБД означает postgres,
+		// явно заданный путь к файлу — file
+		switch {
+		case cfg.DatabaseConnectionAddress != "":
+			cfg.Storage = "postgres"
+		case fileStorageSet:
+			cfg.Storage = "file"
+		default:
+			cfg.Storage = "memory"
+		}
+	}
+
+	cfg.ConfigFile = configFile
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func defaults() *Config {
+	return &Config{
+		LogLevel:        "info",
+		ServerAddress:   "localhost:8080",
+		BaseURL:         defaultBaseURL,
+		FileStoragePath: "events.log",
+		QRLevel:         "M",
+		RedirectStatus:  "307",
+		RedirectMaxAge:  30 * 24 * 60 * 60,
+
+		MaxBodySize:         limits.DefaultMaxBodySize,
+		MaxDecompressedSize: limits.DefaultMaxDecompressedSize,
+		MaxBatchItems:       limits.DefaultMaxBatchItems,
+
+		// по умолчанию database/sql держит всего 2 простаивающих соединения,
+		// и под нагрузкой редиректы ждут установки новых
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    25,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBConnMaxIdleTime: 5 * time.Minute,
+
+		AuthMode:     "cookie",
+		JWTAlgorithm: "HS256",
+		JWTTTL:       30 * 24 * time.Hour,
+	}
+}
+
+// newFlagSet регистрирует флаги, значения по умолчанию которых берутся из cfg
+func newFlagSet(cfg *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	fs.StringVar(configFile, "c", *configFile, "path to JSON or YAML config file")
+	fs.StringVar(&cfg.LogLevel, "l", cfg.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.ServerAddress, "a", cfg.ServerAddress, "address and port to run server, [::1]:8080 for IPv6 or unix:/path/to.sock")
+	fs.StringVar(&cfg.BaseURL, "b", cfg.BaseURL, "base address before a short URL")
+	fs.StringVar(&cfg.Storage, "storage", cfg.Storage, "storage backend: memory, file or postgres; postgres if -d is set, file if -f is set, memory otherwise")
+	fs.StringVar(&cfg.FileStoragePath, "f", cfg.FileStoragePath, "file storage path")
+	fs.StringVar(&cfg.DatabaseConnectionAddress, "d", cfg.DatabaseConnectionAddress, "database connection address")
+	fs.StringVar(&cfg.GRPCAddress, "g", cfg.GRPCAddress, "address and port to run gRPC server, disabled if empty")
+	fs.StringVar(&cfg.SecretKey, "k", cfg.SecretKey, "secret key to sign user tokens, random if empty")
+	fs.StringVar(&cfg.QRLevel, "q", cfg.QRLevel, "QR code error correction level: L, M, Q or H")
+	fs.StringVar(&cfg.RedirectStatus, "r", cfg.RedirectStatus, "default redirect mode: 301, 302, 307, 308 or interstitial")
+	fs.IntVar(&cfg.RedirectMaxAge, "redirect-max-age", cfg.RedirectMaxAge, "seconds to cache permanent (301/308) redirects")
+	fs.BoolVar(&cfg.EnableHTTPS, "s", cfg.EnableHTTPS, "enable HTTPS")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "TLS certificate file, self-signed certificate is generated if empty")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "TLS private key file")
+	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", cfg.MaxBodySize, "max request body size in bytes, 0 for no limit")
+	fs.Int64Var(&cfg.MaxDecompressedSize, "max-decompressed-size", cfg.MaxDecompressedSize, "max request body size after decompression in bytes, 0 for no limit")
+	fs.IntVar(&cfg.MaxBatchItems, "max-batch-items", cfg.MaxBatchItems, "max number of items in a batch request, 0 for no limit")
+
+	fs.IntVar(&cfg.DBMaxOpenConns, "db-max-open-conns", cfg.DBMaxOpenConns, "max open database connections, 0 for no limit")
+	fs.IntVar(&cfg.DBMaxIdleConns, "db-max-idle-conns", cfg.DBMaxIdleConns, "max idle database connections kept in the pool")
+	fs.DurationVar(&cfg.DBConnMaxLifetime, "db-conn-max-lifetime", cfg.DBConnMaxLifetime, "max lifetime of a database connection, 0 for no limit")
+	fs.DurationVar(&cfg.DBConnMaxIdleTime, "db-conn-max-idle-time", cfg.DBConnMaxIdleTime, "max idle time of a database connection, 0 for no limit")
+
+	fs.StringVar(&cfg.AuthMode, "auth-mode", cfg.AuthMode, "user authentication: cookie or jwt")
+	fs.StringVar(&cfg.JWTAlgorithm, "jwt-alg", cfg.JWTAlgorithm, "JWT signing algorithm: HS256 or RS256")
+	fs.StringVar(&cfg.JWTSecret, "jwt-secret", cfg.JWTSecret, "HS256 shared secret")
+	fs.StringVar(&cfg.JWTIssuer, "jwt-issuer", cfg.JWTIssuer, "required JWT issuer (iss), not checked if empty")
+	fs.StringVar(&cfg.JWTAudience, "jwt-audience", cfg.JWTAudience, "required JWT audience (aud), not checked if empty")
+	fs.StringVar(&cfg.JWTJWKSFile, "jwt-jwks", cfg.JWTJWKSFile, "JWKS file with verification keys, reloaded on change")
+	fs.StringVar(&cfg.JWTPrivateKeyFile, "jwt-private-key", cfg.JWTPrivateKeyFile, "PEM RSA private key to issue RS256 tokens")
+	fs.StringVar(&cfg.JWTKeyID, "jwt-kid", cfg.JWTKeyID, "key id (kid) of issued tokens")
+	fs.DurationVar(&cfg.JWTTTL, "jwt-ttl", cfg.JWTTTL, "lifetime of issued tokens, 0 for no expiry")
+	fs.StringVar(&cfg.GeoIPFile, "geoip-file", cfg.GeoIPFile, "CSV GeoIP database for country redirect rules, country rules never match if empty")
+
+	return fs
+}
+
+// readFile читает файл конфигурации; формат определяется по расширению
+func readFile(path string) (File, error) {
+	var file File
+
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.New("can't parse env")
+		return file, fmt.Errorf("can't read config file: %w", err)
 	}
 
-	log.Println(envConf)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	default:
+		return file, ValidationErrors{{Field: "config file", Value: path, Message: "extension must be .json, .yaml or .yml"}}
+	}
+	if err != nil {
+		return file, ValidationErrors{{Field: "config file", Value: path, Message: err.Error()}}
+	}
 
-	var (
-		serverAddress             string
-		baseURL                   string
-		fileStoragePath           string
-		port                      string
-		fileName                  string
-		databaseConnectionAddress string
-	)
+	return file, nil
+}
 
-	flag.StringVar(&serverAddress, "a", "localhost:8080", "address and port to run server")
-	flag.StringVar(&baseURL, "b", "http://localhost:8080", "base address before a short URL")
-	flag.StringVar(&fileStoragePath, "f", "events.log", "file storage path")
-	flag.StringVar(&databaseConnectionAddress, "d", "", "database connection address")
-	// парсим переданные серверу аргументы в зарегистрированные переменные
-	flag.Parse()
+func (c *Config) applyFile(f File) {
+	set(&c.LogLevel, f.LogLevel)
+	set(&c.ServerAddress, f.ServerAddress)
+	set(&c.BaseURL, f.BaseURL)
+	set(&c.Storage, f.Storage)
+	set(&c.FileStoragePath, f.FileStoragePath)
+	set(&c.DatabaseConnectionAddress, f.DatabaseConnectionAddress)
+	set(&c.GRPCAddress, f.GRPCAddress)
+	set(&c.SecretKey, f.SecretKey)
+	set(&c.QRLevel, f.QRLevel)
+	set(&c.RedirectStatus, f.RedirectStatus)
+	set(&c.RedirectMaxAge, f.RedirectMaxAge)
+	set(&c.EnableHTTPS, f.EnableHTTPS)
+	set(&c.TLSCertFile, f.TLSCertFile)
+	set(&c.TLSKeyFile, f.TLSKeyFile)
+	set(&c.MaxBodySize, f.MaxBodySize)
+	set(&c.MaxDecompressedSize, f.MaxDecompressedSize)
+	set(&c.MaxBatchItems, f.MaxBatchItems)
+	set(&c.DBMaxOpenConns, f.DBMaxOpenConns)
+	set(&c.DBMaxIdleConns, f.DBMaxIdleConns)
+	set((*Duration)(&c.DBConnMaxLifetime), f.DBConnMaxLifetime)
+	set((*Duration)(&c.DBConnMaxIdleTime), f.DBConnMaxIdleTime)
+	set(&c.AuthMode, f.AuthMode)
+	set(&c.JWTAlgorithm, f.JWTAlgorithm)
+	set(&c.JWTSecret, f.JWTSecret)
+	set(&c.JWTIssuer, f.JWTIssuer)
+	set(&c.JWTAudience, f.JWTAudience)
+	set(&c.JWTJWKSFile, f.JWTJWKSFile)
+	set(&c.JWTPrivateKeyFile, f.JWTPrivateKeyFile)
+	set(&c.JWTKeyID, f.JWTKeyID)
+	set((*Duration)(&c.JWTTTL), f.JWTTTL)
+	set(&c.GeoIPFile, f.GeoIPFile)
+	if f.RouteLimits != nil {
+		c.RouteLimits = f.RouteLimits
+	}
+	if f.Domains != nil {
+		c.Domains = f.Domains
+	}
+	if f.UTMTemplates != nil {
+		c.UTMTemplates = f.UTMTemplates
+	}
+}
+
+func (c *Config) applyEnv(e Env) {
+	set(&c.LogLevel, e.LogLevel)
+	set(&c.ServerAddress, e.ServerAddress)
+	set(&c.BaseURL, e.BaseURL)
+	set(&c.Storage, e.Storage)
+	set(&c.FileStoragePath, e.FileStoragePath)
+	set(&c.DatabaseConnectionAddress, e.DatabaseConnectionAddress)
+	set(&c.GRPCAddress, e.GRPCAddress)
+	set(&c.SecretKey, e.SecretKey)
+	set(&c.QRLevel, e.QRLevel)
+	set(&c.RedirectStatus, e.RedirectStatus)
+	set(&c.RedirectMaxAge, e.RedirectMaxAge)
+	set(&c.EnableHTTPS, e.EnableHTTPS)
+	set(&c.TLSCertFile, e.TLSCertFile)
+	set(&c.TLSKeyFile, e.TLSKeyFile)
+	set(&c.MaxBodySize, e.MaxBodySize)
+	set(&c.MaxDecompressedSize, e.MaxDecompressedSize)
+	set(&c.MaxBatchItems, e.MaxBatchItems)
+	set(&c.DBMaxOpenConns, e.DBMaxOpenConns)
+	set(&c.DBMaxIdleConns, e.DBMaxIdleConns)
+	set(&c.DBConnMaxLifetime, e.DBConnMaxLifetime)
+	set(&c.DBConnMaxIdleTime, e.DBConnMaxIdleTime)
+	set(&c.AuthMode, e.AuthMode)
+	set(&c.JWTAlgorithm, e.JWTAlgorithm)
+	set(&c.JWTSecret, e.JWTSecret)
+	set(&c.JWTIssuer, e.JWTIssuer)
+	set(&c.JWTAudience, e.JWTAudience)
+	set(&c.JWTJWKSFile, e.JWTJWKSFile)
+	set(&c.JWTPrivateKeyFile, e.JWTPrivateKeyFile)
+	set(&c.JWTKeyID, e.JWTKeyID)
+	set(&c.JWTTTL, e.JWTTTL)
+	set(&c.GeoIPFile, e.GeoIPFile)
+}
 
-	if envConf.ServerAddress != "" {
-		serverAddress = envConf.ServerAddress
+// set переносит значение, если оно задано в источнике
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
 	}
+}
 
-	if envConf.BaseURL != "" {
-		baseURL = envConf.BaseURL
+// validate проверяет все параметры и возвращает ValidationErrors со всеми найденными ошибками
+func (c *Config) validate() error {
+	var errs ValidationErrors
+
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, ValidationError{Field: "log_level", Value: c.LogLevel, Message: err.Error()})
 	}
 
-	if fileStoragePath != "" {
-		fileName = fileStoragePath
+	network, address, err := ParseServerAddress(c.ServerAddress)
+	if err != nil {
+		errs = append(errs, ValidationError{Field: "server_address", Value: c.ServerAddress, Message: err.Error()})
 	}
+	c.ListenNetwork, c.ListenAddress = network, address
 
-	if envConf.FileStoragePath != "" {
-		fileName = envConf.FileStoragePath
+	if err = validateBaseURL(c.BaseURL); err != nil {
+		errs = append(errs, ValidationError{Field: "base_url", Value: c.BaseURL, Message: err.Error()})
 	}
 
-	if envConf.FileStoragePath == "" && fileStoragePath != "" {
-		fileName = fileStoragePath
+	switch c.Storage {
+	case "memory":
+	case "file":
+		if c.FileStoragePath == "" {
+			errs = append(errs, ValidationError{Field: "file_storage_path", Value: c.FileStoragePath, Message: "is required for file storage"})
+		}
+	case "postgres":
+		if c.DatabaseConnectionAddress == "" {
+			errs = append(errs, ValidationError{Field: "database_dsn", Value: c.DatabaseConnectionAddress, Message: "is required for postgres storage"})
+		}
+	default:
+		errs = append(errs, ValidationError{Field: "storage", Value: c.Storage, Message: "must be one of memory, file, postgres"})
 	}
 
-	if envConf.DatabaseConnectionAddress != "" {
-		databaseConnectionAddress = envConf.DatabaseConnectionAddress
+	switch strings.ToUpper(c.QRLevel) {
+	case "L", "M", "Q", "H":
+	default:
+		errs = append(errs, ValidationError{Field: "qr_level", Value: c.QRLevel, Message: "must be one of L, M, Q, H"})
 	}
 
-	if baseURL == "http://localhost:" || baseURL == "http://localhost:/" {
-		fmt.Fprintf(os.Stderr, "Invalid base address: %s (must has format http://localhost:8080/)\n", baseURL)
-		os.Exit(1)
+	switch c.RedirectStatus {
+	case "301", "302", "307", "308", "interstitial":
+	default:
+		errs = append(errs, ValidationError{Field: "redirect_status", Value: c.RedirectStatus, Message: "must be one of 301, 302, 307, 308, interstitial"})
 	}
 
-	port = splitRunAddr(serverAddress)
+	if c.RedirectMaxAge < 0 {
+		errs = append(errs, ValidationError{Field: "redirect_max_age", Value: fmt.Sprint(c.RedirectMaxAge), Message: "must not be negative"})
+	}
 
-	if !validatePort(port) {
-		return nil, errors.New("invalid port number")
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, ValidationError{Field: "tls_cert_file", Value: c.TLSCertFile, Message: "TLS certificate and key must be set together"})
 	}
 
-	return &Config{
-		ServerAddress:             serverAddress,
-		BaseURL:                   baseURL,
-		FileStoragePath:           fileStoragePath,
-		Port:                      port,
-		FileName:                  fileName,
-		DatabaseConnectionAddress: databaseConnectionAddress,
-	}, nil
+	for _, limit := range []struct {
+		field    string
+		value    any
+		negative bool
+	}{
+		{field: "max_body_size", value: c.MaxBodySize, negative: c.MaxBodySize < 0},
+		{field: "max_decompressed_size", value: c.MaxDecompressedSize, negative: c.MaxDecompressedSize < 0},
+		{field: "max_batch_items", value: c.MaxBatchItems, negative: c.MaxBatchItems < 0},
+		{field: "db_max_open_conns", value: c.DBMaxOpenConns, negative: c.DBMaxOpenConns < 0},
+		{field: "db_max_idle_conns", value: c.DBMaxIdleConns, negative: c.DBMaxIdleConns < 0},
+		{field: "db_conn_max_lifetime", value: c.DBConnMaxLifetime, negative: c.DBConnMaxLifetime < 0},
+		{field: "db_conn_max_idle_time", value: c.DBConnMaxIdleTime, negative: c.DBConnMaxIdleTime < 0},
+		{field: "jwt_ttl", value: c.JWTTTL, negative: c.JWTTTL < 0},
+	} {
+		if limit.negative {
+			errs = append(errs, ValidationError{Field: limit.field, Value: fmt.Sprint(limit.value), Message: "must not be negative"})
+		}
+	}
+
+	switch c.AuthMode {
+	case "cookie":
+	case "jwt":
+		switch c.JWTAlgorithm {
+		case "HS256":
+			if c.JWTSecret == "" && c.JWTJWKSFile == "" {
+				errs = append(errs, ValidationError{Field: "jwt_secret", Message: "jwt_secret or jwt_jwks_file is required for HS256"})
+			}
+		case "RS256":
+			if c.JWTPrivateKeyFile == "" && c.JWTJWKSFile == "" {
+				errs = append(errs, ValidationError{Field: "jwt_jwks_file", Message: "jwt_jwks_file or jwt_private_key_file is required for RS256"})
+			}
+		default:
+			errs = append(errs, ValidationError{Field: "jwt_alg", Value: c.JWTAlgorithm, Message: "must be one of HS256, RS256"})
+		}
+	default:
+		errs = append(errs, ValidationError{Field: "auth_mode", Value: c.AuthMode, Message: "must be one of cookie, jwt"})
+	}
+
+	routes := make([]string, 0, len(c.RouteLimits))
+	for route := range c.RouteLimits {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		if l := c.RouteLimits[route]; l.MaxBodySize < 0 || l.MaxDecompressedSize < 0 {
+			errs = append(errs, ValidationError{Field: "route_limits", Value: route, Message: "limits must not be negative"})
+		}
+	}
+
+	hosts := make(map[string]bool, len(c.Domains))
+	for _, d := range c.Domains {
+		host := strings.ToLower(d.Host)
+		switch {
+		case host == "":
+			errs = append(errs, ValidationError{Field: "domains", Value: d.BaseURL, Message: "host is required"})
+		case hosts[host]:
+			errs = append(errs, ValidationError{Field: "domains", Value: d.Host, Message: "host is configured twice"})
+		}
+		hosts[host] = true
+
+		if err = validateBaseURL(d.BaseURL); err != nil {
+			errs = append(errs, ValidationError{Field: "domains", Value: d.Host, Message: "base_url: " + err.Error()})
+		}
+		if d.IDLength < 0 || d.IDLength > maxIDLength {
+			errs = append(errs, ValidationError{Field: "domains", Value: d.Host, Message: fmt.Sprintf("id_length must be between 0 and %d", maxIDLength)})
+		}
+	}
+
+	names := make([]string, 0, len(c.UTMTemplates))
+	for name := range c.UTMTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case name == "" || name == utm.NoTemplate:
+			errs = append(errs, ValidationError{Field: "utm_templates", Value: name, Message: "name must not be empty or " + utm.NoTemplate})
+		case utm.ValidateTemplate(c.UTMTemplates[name]) != nil:
+			errs = append(errs, ValidationError{Field: "utm_templates", Value: name, Message: utm.ErrInvalidTemplate.Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+
+	if u.Hostname() == "" {
+		return errors.New("host is empty")
+	}
+
+	if strings.HasSuffix(u.Host, ":") {
+		return errors.New("port is empty (must has format http://localhost:8080)")
+	}
+
+	return nil
 }
 
 func validatePort(port string) bool {
@@ -106,9 +629,45 @@ func validatePort(port string) bool {
 	return match
 }
 
-func splitRunAddr(runAddr string) string {
-	splittedRunAddr := strings.Split(runAddr, ":")
-	port := splittedRunAddr[1]
+// ParseServerAddress разбирает адрес сервера в параметры net.Listen.
+// Поддерживаются host:port, [ipv6]:port, :port и unix:/path/to.sock.
+func ParseServerAddress(addr string) (string, string, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		path = strings.TrimPrefix(path, "//")
+		if path == "" {
+			return "", "", errors.New("invalid server address: unix socket path is empty")
+		}
+		return "unix", path, nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid server address %q: %w", addr, err)
+	}
+
+	if !validatePort(port) {
+		return "", "", errors.New("invalid port number")
+	}
 
-	return port
+	return "tcp", addr, nil
+}
+
+// environ возвращает окружение процесса в виде словаря
+func environ() map[string]string {
+	environment := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			environment[k] = v
+		}
+	}
+
+	return environment
+}
+
+// BodyLimits возвращает лимиты тела запросов по умолчанию и для отдельных маршрутов
+func (c *Config) BodyLimits() limits.Config {
+	return limits.Config{
+		Default: limits.Limits{MaxBodySize: c.MaxBodySize, MaxDecompressedSize: c.MaxDecompressedSize},
+		Routes:  c.RouteLimits,
+	}
 }
@@ -0,0 +1,353 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/limits"
+)
+
+func TestParseServerAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		network string
+		address string
+		wantErr bool
+	}{
+		{name: "host and port", addr: "localhost:8080", network: "tcp", address: "localhost:8080"},
+		{name: "port only", addr: ":8080", network: "tcp", address: ":8080"},
+		{name: "ipv4", addr: "127.0.0.1:8080", network: "tcp", address: "127.0.0.1:8080"},
+		{name: "ipv6", addr: "[::1]:8080", network: "tcp", address: "[::1]:8080"},
+		{name: "unix socket", addr: "unix:/tmp/shortener.sock", network: "unix", address: "/tmp/shortener.sock"},
+		{name: "unix socket url", addr: "unix:///tmp/shortener.sock", network: "unix", address: "/tmp/shortener.sock"},
+		{name: "no colon", addr: "localhost", wantErr: true},
+		{name: "invalid port", addr: "localhost:http", wantErr: true},
+		{name: "empty unix path", addr: "unix:", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network, address, err := ParseServerAddress(test.addr)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.network, network)
+			assert.Equal(t, test.address, address)
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"server_address": "localhost:9000", "base_url": "http://file", "qr_level": "H", "redirect_status": "301"}`), 0o600))
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("server_address: localhost:9001\nbase_url: http://yaml\n"), 0o600))
+
+	tests := []struct {
+		name          string
+		args          []string
+		env           map[string]string
+		serverAddress string
+		baseURL       string
+		qrLevel       string
+		redirect      string
+	}{
+		{name: "defaults", serverAddress: "localhost:8080", baseURL: "http://localhost:8080", qrLevel: "M", redirect: "307"},
+		{name: "json file", args: []string{"-c", jsonFile}, serverAddress: "localhost:9000", baseURL: "http://file", qrLevel: "H", redirect: "301"},
+		{name: "yaml file from env", env: map[string]string{"CONFIG": yamlFile}, serverAddress: "localhost:9001", baseURL: "http://yaml", qrLevel: "M", redirect: "307"},
+		{
+			name:          "env overrides file",
+			args:          []string{"-c", jsonFile},
+			env:           map[string]string{"BASE_URL": "http://env"},
+			serverAddress: "localhost:9000", baseURL: "http://env", qrLevel: "H", redirect: "301",
+		},
+		{
+			name:          "flags override env",
+			args:          []string{"-c", jsonFile, "-b", "http://flag", "-r", "302"},
+			env:           map[string]string{"BASE_URL": "http://env", "REDIRECT_STATUS": "308"},
+			serverAddress: "localhost:9000", baseURL: "http://flag", qrLevel: "H", redirect: "302",
+		},
+		{
+			name:          "config flag overrides env",
+			args:          []string{"-c", yamlFile},
+			env:           map[string]string{"CONFIG": jsonFile},
+			serverAddress: "localhost:9001", baseURL: "http://yaml", qrLevel: "M", redirect: "307",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Load(test.args, test.env)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.serverAddress, cfg.ServerAddress)
+			assert.Equal(t, test.baseURL, cfg.BaseURL)
+			assert.Equal(t, test.qrLevel, cfg.QRLevel)
+			assert.Equal(t, test.redirect, cfg.RedirectStatus)
+		})
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	dir := t.TempDir()
+	unknownField := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(unknownField, []byte(`{"port": 8080}`), 0o600))
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		fields []string
+	}{
+		{name: "invalid address", args: []string{"-a", "localhost"}, fields: []string{"server_address"}},
+		{name: "invalid base url", args: []string{"-b", "localhost:8080"}, fields: []string{"base_url"}},
+		{name: "empty port", args: []string{"-b", "http://localhost:"}, fields: []string{"base_url"}},
+		{
+			name:   "several errors",
+			args:   []string{"-q", "X", "-r", "200", "-redirect-max-age", "-1", "-tls-cert", "cert.pem"},
+			fields: []string{"qr_level", "redirect_status", "redirect_max_age", "tls_cert_file"},
+		},
+		{name: "unknown storage", args: []string{"-storage", "redis"}, fields: []string{"storage"}},
+		{name: "postgres without dsn", args: []string{"-storage", "postgres"}, fields: []string{"database_dsn"}},
+		{name: "file without path", args: []string{"-storage", "file", "-f", ""}, fields: []string{"file_storage_path"}},
+		{name: "invalid env", env: map[string]string{"REDIRECT_MAX_AGE": "week"}, fields: []string{"environment"}},
+		{name: "unknown file field", args: []string{"-c", unknownField}, fields: []string{"config file"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(test.args, test.env)
+
+			var errs ValidationErrors
+			require.ErrorAs(t, err, &errs)
+
+			fields := make([]string, 0, len(errs))
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			assert.Equal(t, test.fields, fields)
+		})
+	}
+}
+
+func TestLoadHTTPSBaseURL(t *testing.T) {
+	cfg, err := Load([]string{"-s"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost:8080", cfg.BaseURL)
+
+	cfg, err = Load([]string{"-s", "-b", "http://example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", cfg.BaseURL)
+}
+
+func TestCheckReload(t *testing.T) {
+	current, err := Load(nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		args   []string
+		fields []string
+	}{
+		{name: "reloadable only", args: []string{"-l", "debug", "-q", "H", "-r", "308", "-redirect-max-age", "60"}},
+		{name: "listen address", args: []string{"-a", "localhost:9090", "-l", "debug"}, fields: []string{"server_address"}},
+		{name: "storage", args: []string{"-d", "postgres://localhost/db", "-f", "urls.log"}, fields: []string{"storage", "file_storage_path", "database_dsn"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, err := Load(test.args, nil)
+			require.NoError(t, err)
+
+			err = current.CheckReload(next)
+			if test.fields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var restart *RestartRequiredError
+			require.ErrorAs(t, err, &restart)
+			assert.Equal(t, test.fields, restart.Fields)
+		})
+	}
+}
+
+func TestLoadStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		storage string
+	}{
+		{name: "memory by default", storage: "memory"},
+		{name: "postgres with dsn", args: []string{"-d", "postgres://localhost/db"}, storage: "postgres"},
+		{name: "explicit file", args: []string{"-storage", "file", "-d", "postgres://localhost/db"}, storage: "file"},
+		{name: "file path flag", args: []string{"-f", "some.log"}, storage: "file"},
+		{name: "file path env", env: map[string]string{"FILE_STORAGE_PATH": "some.log"}, storage: "file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Load(test.args, test.env)
+			require.NoError(t, err)
+			assert.Equal(t, test.storage, cfg.Storage)
+		})
+	}
+}
+
+func TestLoadBodyLimits(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+max_body_size: 2048
+route_limits:
+  /api/shorten/batch:
+    max_body_size: 65536
+    max_decompressed_size: 131072
+`), 0o600))
+
+	cfg, err := Load([]string{"-c", file, "-max-decompressed-size", "4096"}, map[string]string{"MAX_BATCH_ITEMS": "10"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.MaxBatchItems)
+
+	l := cfg.BodyLimits()
+	assert.Equal(t, limits.Limits{MaxBodySize: 2048, MaxDecompressedSize: 4096}, l.For("/api/shorten"))
+	assert.Equal(t, limits.Limits{MaxBodySize: 65536, MaxDecompressedSize: 131072}, l.For("/api/shorten/batch"))
+}
+
+func TestLoadDBPool(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("db_max_open_conns: 50\ndb_conn_max_lifetime: 1h\n"), 0o600))
+	jsonFile := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"db_conn_max_idle_time": "90s"}`), 0o600))
+
+	cfg, err := Load([]string{"-c", yamlFile, "-db-max-idle-conns", "10"}, map[string]string{"DB_CONN_MAX_IDLE_TIME": "2m"})
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.DBMaxOpenConns)
+	assert.Equal(t, 10, cfg.DBMaxIdleConns)
+	assert.Equal(t, time.Hour, cfg.DBConnMaxLifetime)
+	assert.Equal(t, 2*time.Minute, cfg.DBConnMaxIdleTime)
+
+	cfg, err = Load([]string{"-c", jsonFile}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cfg.DBConnMaxIdleTime)
+
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"db_conn_max_idle_time": "soon"}`), 0o600))
+	_, err = Load([]string{"-c", jsonFile}, nil)
+	require.Error(t, err)
+
+	_, err = Load([]string{"-db-conn-max-lifetime", "-1s"}, nil)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, "db_conn_max_lifetime", errs[0].Field)
+	assert.Equal(t, "-1s", errs[0].Value)
+}
+
+func TestLoadDomains(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+domains:
+  - host: sho.rt
+    base_url: https://sho.rt
+    id_length: 6
+  - host: www.sho.rt
+    base_url: https://www.sho.rt
+    namespace: sho.rt
+`), 0o600))
+
+	cfg, err := Load([]string{"-c", file}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []domains.Domain{
+		{Host: "sho.rt", BaseURL: "https://sho.rt", IDLength: 6},
+		{Host: "www.sho.rt", BaseURL: "https://www.sho.rt", Namespace: "sho.rt"},
+	}, cfg.Domains)
+
+	require.NoError(t, os.WriteFile(file, []byte(`
+domains:
+  - host: sho.rt
+    base_url: ftp://sho.rt
+  - host: SHO.RT
+    base_url: https://sho.rt
+    id_length: 64
+`), 0o600))
+
+	_, err = Load([]string{"-c", file}, nil)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Message, "base_url")
+	assert.Equal(t, "host is configured twice", errs[1].Message)
+	assert.Contains(t, errs[2].Message, "id_length")
+}
+
+func TestLoadJWT(t *testing.T) {
+	cfg, err := Load(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "cookie", cfg.AuthMode)
+
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("auth_mode: jwt\njwt_alg: RS256\njwt_jwks_file: /etc/jwks.json\njwt_ttl: 1h\n"), 0o600))
+
+	cfg, err = Load([]string{"-c", yamlFile, "-jwt-audience", "shortener"}, map[string]string{"JWT_ISSUER": "sso"})
+	require.NoError(t, err)
+	assert.Equal(t, "jwt", cfg.AuthMode)
+	assert.Equal(t, "RS256", cfg.JWTAlgorithm)
+	assert.Equal(t, "/etc/jwks.json", cfg.JWTJWKSFile)
+	assert.Equal(t, "sso", cfg.JWTIssuer)
+	assert.Equal(t, "shortener", cfg.JWTAudience)
+	assert.Equal(t, time.Hour, cfg.JWTTTL)
+
+	var errs ValidationErrors
+	_, err = Load([]string{"-auth-mode", "jwt"}, nil)
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, "jwt_secret", errs[0].Field)
+
+	_, err = Load([]string{"-auth-mode", "jwt", "-jwt-alg", "none"}, nil)
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, "jwt_alg", errs[0].Field)
+
+	_, err = Load([]string{"-auth-mode", "oauth"}, nil)
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, "auth_mode", errs[0].Field)
+}
+
+func TestLoadUTMTemplates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+utm_templates:
+  default: utm_source=short&utm_medium={domain}
+  newsletter: utm_source=newsletter&utm_medium=email
+`), 0o600))
+
+	cfg, err := Load([]string{"-c", file}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"default":    "utm_source=short&utm_medium={domain}",
+		"newsletter": "utm_source=newsletter&utm_medium=email",
+	}, cfg.Reloadable().UTMTemplates)
+
+	require.NoError(t, os.WriteFile(file, []byte(`
+utm_templates:
+  none: utm_source=x
+  broken: utm_source=%zz
+`), 0o600))
+
+	_, err = Load([]string{"-c", file}, nil)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "broken", errs[0].Value)
+	assert.Equal(t, "none", errs[1].Value)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Reloadable — параметры, которые применяются к работающему серверу без перезапуска
+type Reloadable struct {
+	LogLevel       string
+	QRLevel        string
+	RedirectStatus string
+	RedirectMaxAge int
+	UTMTemplates   map[string]string
+}
+
+// Reloadable возвращает перезагружаемую часть конфигурации
+func (c *Config) Reloadable() Reloadable {
+	return Reloadable{
+		LogLevel:       c.LogLevel,
+		QRLevel:        c.QRLevel,
+		RedirectStatus: c.RedirectStatus,
+		RedirectMaxAge: c.RedirectMaxAge,
+		UTMTemplates:   c.UTMTemplates,
+	}
+}
+
+// RestartRequiredError возвращается, если новая конфигурация меняет параметры,
+// которые применяются только при старте: адреса прослушивания и хранилище
+type RestartRequiredError struct {
+	Fields []string
+}
+
+func (e *RestartRequiredError) Error() string {
+	return fmt.Sprintf("restart required to change %s", strings.Join(e.Fields, ", "))
+}
+
+// CheckReload проверяет, что next отличается от c только перезагружаемыми параметрами
+func (c *Config) CheckReload(next *Config) error {
+	var fields []string
+
+	changed := func(name string, old, new any) {
+		if old != new {
+			fields = append(fields, name)
+		}
+	}
+
+	changed("server_address", c.ServerAddress, next.ServerAddress)
+	changed("grpc_address", c.GRPCAddress, next.GRPCAddress)
+	changed("enable_https", c.EnableHTTPS, next.EnableHTTPS)
+	changed("tls_cert_file", c.TLSCertFile, next.TLSCertFile)
+	changed("tls_key_file", c.TLSKeyFile, next.TLSKeyFile)
+	changed("base_url", c.BaseURL, next.BaseURL)
+	changed("storage", c.Storage, next.Storage)
+	changed("file_storage_path", c.FileStoragePath, next.FileStoragePath)
+	changed("database_dsn", c.DatabaseConnectionAddress, next.DatabaseConnectionAddress)
+	changed("secret_key", c.SecretKey, next.SecretKey)
+	changed("config file", c.ConfigFile, next.ConfigFile)
+	// лимиты тела применяются к маршрутам при их создании
+	changed("max_body_size", c.MaxBodySize, next.MaxBodySize)
+	changed("max_decompressed_size", c.MaxDecompressedSize, next.MaxDecompressedSize)
+	changed("max_batch_items", c.MaxBatchItems, next.MaxBatchItems)
+	changed("db_max_open_conns", c.DBMaxOpenConns, next.DBMaxOpenConns)
+	changed("db_max_idle_conns", c.DBMaxIdleConns, next.DBMaxIdleConns)
+	changed("db_conn_max_lifetime", c.DBConnMaxLifetime, next.DBConnMaxLifetime)
+	changed("db_conn_max_idle_time", c.DBConnMaxIdleTime, next.DBConnMaxIdleTime)
+	changed("auth_mode", c.AuthMode, next.AuthMode)
+	changed("jwt_alg", c.JWTAlgorithm, next.JWTAlgorithm)
+	changed("jwt_secret", c.JWTSecret, next.JWTSecret)
+	changed("jwt_issuer", c.JWTIssuer, next.JWTIssuer)
+	changed("jwt_audience", c.JWTAudience, next.JWTAudience)
+	// ключи из файла JWKS ротируются без перезапуска, но сам путь к файлу — нет
+	changed("jwt_jwks_file", c.JWTJWKSFile, next.JWTJWKSFile)
+	changed("jwt_private_key_file", c.JWTPrivateKeyFile, next.JWTPrivateKeyFile)
+	changed("jwt_key_id", c.JWTKeyID, next.JWTKeyID)
+	changed("jwt_ttl", c.JWTTTL, next.JWTTTL)
+	changed("geoip_file", c.GeoIPFile, next.GeoIPFile)
+	if !maps.Equal(c.RouteLimits, next.RouteLimits) {
+		fields = append(fields, "route_limits")
+	}
+	if !slices.Equal(c.Domains, next.Domains) {
+		fields = append(fields, "domains")
+	}
+
+	if len(fields) > 0 {
+		return &RestartRequiredError{Fields: fields}
+	}
+
+	return nil
+}
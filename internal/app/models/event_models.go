@@ -1,7 +1,39 @@
 package models
 
+import "time"
+
 type Event struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UUID string `json:"uuid"`
+	// ShortURL есть только в старых журналах, идентификатор тогда берётся из него
+	ShortURL     string `json:"short_url,omitempty"`
+	OriginalURL  string `json:"original_url,omitempty"`
+	URLID        string `json:"url_id,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	UserID       string `json:"user_id,omitempty"`
+	DeletedFlag  bool   `json:"is_deleted,omitempty"`
+	Disabled     bool   `json:"is_disabled,omitempty"`
+	RedirectMode string `json:"redirect_mode,omitempty"`
+	CacheMaxAge  *int   `json:"cache_max_age,omitempty"`
+	// ExpiresAt и Version появились вместе с изменением ссылок
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Version          int64      `json:"version,omitempty"`
+	QueryPassthrough string     `json:"query_passthrough,omitempty"`
+	// Destinations — варианты ссылки вместе со счётчиками переходов
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Rules — правила перенаправления в порядке проверки
+	Rules []Rule `json:"rules,omitempty"`
+	// Click — вариант, по которому был переход; такое событие содержит только ссылку
+	// и увеличивает счётчик варианта вместо замены состояния
+	Click string `json:"click,omitempty"`
+}
+
+// KeyEvent — состояние ключа API в журнале ключей файлового хранилища
+type KeyEvent struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name,omitempty"`
+	Hash      string     `json:"hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
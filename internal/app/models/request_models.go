@@ -1,7 +1,17 @@
 package models
 
 type Request struct {
-	URL string `json:"url"`
+	URL          string `json:"url"`
+	RedirectMode string `json:"redirect_mode,omitempty"`
+	CacheMaxAge  *int   `json:"cache_max_age,omitempty"`
+	// QueryPassthrough — перенос параметров перехода в адрес назначения: override или keep
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// UTMTemplate — имя шаблона UTM-меток из конфигурации, none отключает шаблон по умолчанию
+	UTMTemplate string `json:"utm_template,omitempty"`
+	// Destinations делит переходы между адресами по весам с первого перехода
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Rules — правила перенаправления в порядке проверки, действуют с первого перехода
+	Rules []Rule `json:"rules,omitempty"`
 }
 
 type PayloadBatch []RequestBatch
@@ -9,4 +19,70 @@ type PayloadBatch []RequestBatch
 type RequestBatch struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	RedirectMode  string `json:"redirect_mode,omitempty"`
+	CacheMaxAge   *int   `json:"cache_max_age,omitempty"`
+	// QueryPassthrough, UTMTemplate, Destinations и Rules — как в Request
+	QueryPassthrough string        `json:"query_passthrough,omitempty"`
+	UTMTemplate      string        `json:"utm_template,omitempty"`
+	Destinations     []Destination `json:"destinations,omitempty"`
+	Rules            []Rule        `json:"rules,omitempty"`
+}
+
+type DeleteRequest []string
+
+// LinkRef — ссылка в пространстве имён домена, пустое пространство — домен по умолчанию
+type LinkRef struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+}
+
+// AdminAction — необязательное тело действия модератора
+type AdminAction struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// AdminReassign — запрос на передачу ссылки другому пользователю
+type AdminReassign struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AdminBulkDisable — запрос на отключение нескольких ссылок
+type AdminBulkDisable struct {
+	URLs   []LinkRef `json:"urls"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// URLPatch — изменения ссылки владельцем; отсутствующие поля не меняются
+type URLPatch struct {
+	URL          *string `json:"url,omitempty"`
+	RedirectMode *string `json:"redirect_mode,omitempty"`
+	// ExpiresAt — срок действия в RFC 3339, пустая строка делает ссылку бессрочной
+	ExpiresAt *string `json:"expires_at,omitempty"`
+	// Destinations делит переходы между адресами по весам, пустой список возвращает одиночный адрес url
+	Destinations *[]Destination `json:"destinations,omitempty"`
+	// QueryPassthrough — перенос параметров перехода в адрес назначения, пустая строка отключает его
+	QueryPassthrough *string `json:"query_passthrough,omitempty"`
+	// Rules заменяет правила перенаправления ссылки, пустой список удаляет их
+	Rules *[]Rule `json:"rules,omitempty"`
+	// Version — прочитанная клиентом версия ссылки, заменяет заголовок If-Match
+	Version *int64 `json:"version,omitempty"`
+}
+
+// Destination — вариант ссылки с несколькими адресами назначения
+type Destination struct {
+	// Variant — имя варианта; если не задано, варианты называются a, b, c по порядку
+	Variant string `json:"variant,omitempty"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	// Clicks — число переходов, отданных варианту; в запросах игнорируется
+	Clicks int64 `json:"clicks,omitempty"`
+}
+
+// Rule — правило перенаправления: переход ведёт на URL, если признак запроса field
+// совпадает с одним из значений values
+type Rule struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+	URL    string   `json:"url"`
 }
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"github.com/Nastez/shortener/internal/audit"
+)
+
 type Response struct {
 	Result string `json:"result"`
 }
@@ -10,3 +16,68 @@ type ResponseBatch struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
 }
+
+type UserURL struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+}
+
+// AdminURL — ссылка в ответе поиска модератора
+type AdminURL struct {
+	Namespace   string `json:"namespace"`
+	ID          string `json:"id"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id"`
+	Deleted     bool   `json:"deleted"`
+	Disabled    bool   `json:"disabled"`
+}
+
+// AdminURLPage — страница результатов поиска; NextCursor пуст на последней странице
+type AdminURLPage struct {
+	URLs       []AdminURL `json:"urls"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// AdminBulkResult — ссылки, найденные и отключённые пакетным запросом
+type AdminBulkResult struct {
+	Disabled []LinkRef `json:"disabled"`
+	NotFound []LinkRef `json:"not_found"`
+}
+
+// AdminAuditPage — страница журнала аудита; NextCursor пуст на последней странице
+type AdminAuditPage struct {
+	Events     []audit.Event `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// URLDetails — ссылка владельца вместе с версией, по которой её можно изменить
+type URLDetails struct {
+	ID           string     `json:"id"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	RedirectMode string     `json:"redirect_mode,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Disabled     bool       `json:"disabled,omitempty"`
+	Version      int64      `json:"version"`
+	// QueryPassthrough — перенос параметров перехода в адрес назначения: override или keep
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// Destinations — варианты ссылки вместе с числом отданных каждому переходов
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Rules — правила перенаправления в порядке проверки
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// URLRevision — прежняя редакция ссылки из истории изменений
+type URLRevision struct {
+	Version          int64      `json:"version"`
+	OriginalURL      string     `json:"original_url"`
+	RedirectMode     string     `json:"redirect_mode,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	QueryPassthrough string     `json:"query_passthrough,omitempty"`
+	// ReplacedAt и ReplacedBy — когда и кем редакция была заменена
+	ReplacedAt   time.Time     `json:"replaced_at"`
+	ReplacedBy   string        `json:"replaced_by"`
+	Destinations []Destination `json:"destinations,omitempty"`
+	Rules        []Rule        `json:"rules,omitempty"`
+}
@@ -0,0 +1,168 @@
+// Package audit описывает журнал аудита ссылок: кто, когда и как изменил ссылку.
+// Записи только добавляются; хранилища реализуют Log.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Действия над ссылками
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionDisable  = "disable"
+	ActionEnable   = "enable"
+	ActionReassign = "reassign"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса; под тем же именем
+// идентификатор передаётся в метаданных gRPC
+const RequestIDHeader = "X-Request-Id"
+
+// Event — запись журнала аудита
+type Event struct {
+	// ID — порядковый номер записи, назначается хранилищем
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Actor — кто выполнил действие: key:<id ключа API>, user:<id пользователя> или anonymous
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Namespace string `json:"namespace"`
+	URLID     string `json:"url_id"`
+	// Before и After — состояние ссылки до и после действия; Before пуст при создании
+	Before *Link `json:"before,omitempty"`
+	After  *Link `json:"after,omitempty"`
+	// Details — параметры действия, например причина модерации
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Link — состояние ссылки в записи аудита
+type Link struct {
+	OriginalURL  string `json:"original_url"`
+	UserID       string `json:"user_id"`
+	Deleted      bool   `json:"deleted,omitempty"`
+	Disabled     bool   `json:"disabled,omitempty"`
+	RedirectMode string `json:"redirect_mode,omitempty"`
+	CacheMaxAge  *int   `json:"cache_max_age,omitempty"`
+	// ExpiresAt и Version — срок действия и номер редакции ссылки
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Version   int64      `json:"version,omitempty"`
+	// QueryPassthrough — перенос параметров перехода в адрес назначения
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// Destinations — варианты ссылки с несколькими адресами назначения
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Rules — правила перенаправления в порядке проверки
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Destination — вариант ссылки в записи аудита; счётчики переходов не записываются
+type Destination struct {
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+}
+
+// Rule — правило перенаправления в записи аудита
+type Rule struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+	URL    string   `json:"url"`
+}
+
+// Query — условия выборки журнала; пустые поля не ограничивают выборку
+type Query struct {
+	// From и To — полуинтервал времени [From, To)
+	From time.Time
+	To   time.Time
+	// Namespace и URLID выбирают записи одной ссылки
+	Namespace *string
+	URLID     string
+	Actor     string
+	Action    string
+	// AfterID — последняя запись предыдущей страницы
+	AfterID int64
+	Limit   int
+}
+
+// Recorder добавляет записи в журнал аудита
+type Recorder interface {
+	Record(ctx context.Context, events ...Event) error
+}
+
+// Log — журнал аудита с выборкой по времени; записи возвращаются в порядке ID
+type Log interface {
+	Recorder
+	Query(ctx context.Context, q Query) ([]Event, error)
+}
+
+// Match сообщает, подходит ли запись под условия q без учёта AfterID и Limit
+func (q Query) Match(e Event) bool {
+	switch {
+	case !q.From.IsZero() && e.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && !e.Time.Before(q.To):
+		return false
+	case q.Namespace != nil && e.Namespace != *q.Namespace:
+		return false
+	case q.URLID != "" && e.URLID != q.URLID:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Action != "" && e.Action != q.Action:
+		return false
+	}
+
+	return true
+}
+
+type requestIDKey struct{}
+type reasonKey struct{}
+
+// WithRequestID сохраняет в контексте идентификатор запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext возвращает идентификатор запроса
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithReason сохраняет в контексте причину действия для записи аудита
+func WithReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+// ReasonFromContext возвращает причину действия
+func ReasonFromContext(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
+
+// NewRequestID генерирует идентификатор запроса
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID берёт идентификатор запроса из заголовка X-Request-Id или генерирует новый
+// и возвращает его клиенту в том же заголовке
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		h.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
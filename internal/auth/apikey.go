@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Области действия ключей API
+const (
+	ScopeCreate    = "create"
+	ScopeReadStats = "read-stats"
+	ScopeDelete    = "delete"
+	// ScopeUpdate разрешает менять адрес назначения, режим перенаправления и срок действия ссылок
+	ScopeUpdate = "update"
+	// ScopeAdmin открывает /admin; запросы с cookie или JWT её не получают
+	ScopeAdmin = "admin"
+)
+
+// Scopes — все области действия в порядке вывода
+var Scopes = []string{ScopeCreate, ScopeReadStats, ScopeDelete, ScopeUpdate, ScopeAdmin}
+
+// keyPrefix отличает ключи API от других токенов и упрощает поиск утёкших ключей
+const keyPrefix = "shk_"
+
+// ErrInvalidScope указывает на неизвестную область действия
+var ErrInvalidScope = errors.New("invalid scope")
+
+type apiKeyKey struct{}
+
+// ParseScopes разбирает список областей действия через запятую
+func ParseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("%w %q, must be one of %s", ErrInvalidScope, scope, strings.Join(Scopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	return scopes, nil
+}
+
+// NewAPIKey создаёт ключ API пользователя. Возвращает токен, который показывается
+// только один раз, и запись для хранилища, содержащую лишь хэш секрета.
+func NewAPIKey(userID, name string, scopes []string) (string, store.APIKey) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	key := store.APIKey{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = hashSecret(encoded)
+
+	return keyPrefix + key.ID + "." + encoded, key
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// UseKeys включает проверку ключей API по хранилищу keys
+func (a *Authenticator) UseKeys(keys store.KeyStore) {
+	a.keys = keys
+}
+
+// APIKey проверяет токен ключа API и возвращает ключ
+func (a *Authenticator) APIKey(ctx context.Context, token string) (store.APIKey, error) {
+	if a.keys == nil {
+		return store.APIKey{}, ErrInvalidToken
+	}
+
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, keyPrefix), ".")
+	if !ok || !strings.HasPrefix(token, keyPrefix) || id == "" || secret == "" {
+		return store.APIKey{}, ErrInvalidToken
+	}
+
+	key, err := a.keys.GetKey(ctx, id)
+	if errors.Is(err, store.ErrKeyNotFound) {
+		return store.APIKey{}, ErrInvalidToken
+	}
+	if err != nil {
+		return store.APIKey{}, err
+	}
+
+	if key.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashSecret(secret))) != 1 {
+		return store.APIKey{}, ErrInvalidToken
+	}
+
+	return key, nil
+}
+
+// WithKey сохраняет в контексте пользователя и ключ API
+func WithKey(ctx context.Context, key store.APIKey) context.Context {
+	key.Hash = ""
+	return context.WithValue(WithUserID(ctx, key.UserID), apiKeyKey{}, key)
+}
+
+// KeyFromContext возвращает ключ API, с которым пришёл запрос
+func KeyFromContext(ctx context.Context) (store.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(store.APIKey)
+	return key, ok
+}
+
+// HasScope сообщает, разрешено ли действие scope. Запросы с cookie не ограничены
+// областями действия, запросы с ключом API — только областями ключа.
+func HasScope(ctx context.Context, scope string) bool {
+	key, ok := KeyFromContext(ctx)
+	if !ok {
+		return true
+	}
+
+	return slices.Contains(key.Scopes, scope)
+}
+
+// Actor описывает в журнале аудита, от чьего имени выполняется запрос
+func Actor(ctx context.Context) string {
+	if key, ok := KeyFromContext(ctx); ok {
+		return "key:" + key.ID
+	}
+	if userID, ok := UserIDFromContext(ctx); ok {
+		return "user:" + userID
+	}
+
+	return "anonymous"
+}
+
+// RequireScope отвечает 403 на запросы с ключом API без области действия scope
+func RequireScope(scope string) func(h http.Handler) http.HandlerFunc {
+	return func(h http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !HasScope(r.Context(), scope) {
+				http.Error(w, "api key has no "+scope+" scope", http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+	}
+}
+
+// Admin пропускает только запросы с ключом API с областью действия admin:
+// без ключа отвечает 401, с ключом без этой области — 403
+func (a *Authenticator) Admin(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearer(r.Header.Get("Authorization"))
+		if !ok || !strings.HasPrefix(token, keyPrefix) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "admin api key is required", http.StatusUnauthorized)
+			return
+		}
+
+		a.serveBearer(w, r, token, RequireScope(ScopeAdmin)(h))
+	}
+}
+
+// bearer возвращает токен из заголовка Authorization: Bearer
+func bearer(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/logger"
+	"github.com/Nastez/shortener/internal/store"
+	"github.com/Nastez/shortener/utils"
+)
+
+// CookieName — имя cookie с токеном пользователя.
+// Под тем же именем токен передаётся в метаданных gRPC.
+const CookieName = "token"
+
+// ErrInvalidToken указывает на отсутствующий или повреждённый токен
+var ErrInvalidToken = errors.New("invalid token")
+
+type ctxKey struct{}
+
+// Authenticator выдаёт и проверяет подписанные токены пользователей
+type Authenticator struct {
+	secret []byte
+	// keys — хранилище ключей API, nil отключает заголовок Authorization
+	keys store.KeyStore
+	// jwt — режим JWT, nil — собственные токены сервиса
+	jwt *jwtCodec
+}
+
+// New возвращает Authenticator с заданным секретом.
+// При пустом секрете генерируется случайный, и токены теряют силу после перезапуска.
+func New(secret string) *Authenticator {
+	if secret == "" {
+		b := make([]byte, 32)
+		rand.Read(b)
+		return &Authenticator{secret: b}
+	}
+
+	return &Authenticator{secret: []byte(secret)}
+}
+
+// NewToken возвращает токен вида <userID>.<подпись>
+func (a *Authenticator) NewToken(userID string) string {
+	return userID + "." + a.sign(userID)
+}
+
+// UserID проверяет подпись токена и возвращает идентификатор пользователя
+func (a *Authenticator) UserID(token string) (string, error) {
+	if a.jwt != nil {
+		claims, err := a.jwt.verify(token)
+		return claims.Subject, err
+	}
+
+	userID, sign, ok := strings.Cut(token, ".")
+	if !ok || userID == "" {
+		return "", ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(sign), []byte(a.sign(userID))) {
+		return "", ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+// Issue создаёт нового пользователя и возвращает его идентификатор и токен.
+// В режиме JWT без ключа подписи возвращает ErrCannotIssue.
+func (a *Authenticator) Issue() (string, string, error) {
+	userID := utils.GenerateID()
+	if a.jwt != nil {
+		token, err := a.jwt.issue(userID)
+		return userID, token, err
+	}
+
+	return userID, a.NewToken(userID), nil
+}
+
+// Authenticate проверяет токен пользователя и возвращает контекст с его идентификатором,
+// а в режиме JWT — и с утверждениями токена
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (context.Context, error) {
+	if a.jwt != nil {
+		claims, err := a.jwt.verify(token)
+		if err != nil {
+			return ctx, err
+		}
+		return WithClaims(ctx, claims), nil
+	}
+
+	userID, err := a.UserID(token)
+	if err != nil {
+		return ctx, err
+	}
+
+	return WithUserID(ctx, userID), nil
+}
+
+// Bearer проверяет токен из заголовка Authorization: Bearer — ключ API или, в режиме JWT, JWT
+func (a *Authenticator) Bearer(ctx context.Context, token string) (context.Context, error) {
+	if a.jwt != nil && !strings.HasPrefix(token, keyPrefix) {
+		return a.Authenticate(ctx, token)
+	}
+
+	key, err := a.APIKey(ctx, token)
+	if err != nil {
+		return ctx, err
+	}
+
+	return WithKey(ctx, key), nil
+}
+
+func (a *Authenticator) sign(userID string) string {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write([]byte(userID))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WithUserID сохраняет идентификатор пользователя в контексте
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, userID)
+}
+
+// UserIDFromContext возвращает идентификатор пользователя из контекста
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(ctxKey{}).(string)
+	return userID, ok && userID != ""
+}
+
+// Middleware определяет пользователя по заголовку Authorization: Bearer или по cookie.
+// Недействительный ключ API или JWT в заголовке отклоняется с кодом 401. Если cookie нет
+// или подпись неверна, создаётся новый пользователь и выставляется новая cookie;
+// в режиме JWT без ключа подписи такие запросы отклоняются с кодом 401.
+func (a *Authenticator) Middleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearer(r.Header.Get("Authorization")); ok {
+			a.serveBearer(w, r, token, h)
+			return
+		}
+
+		ctx, err := a.fromCookie(r)
+		if err == nil {
+			a.refreshCookie(w, ctx)
+			h.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		userID, token, err := a.Issue()
+		if errors.Is(err, ErrCannotIssue) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logger.Log.Info("can't issue token", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		setCookie(w, token)
+
+		if a.jwt != nil {
+			ctx, err = a.Authenticate(r.Context(), token)
+		} else {
+			ctx = WithUserID(r.Context(), userID)
+		}
+		if err != nil {
+			logger.Log.Info("can't read issued token", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// Required пропускает только запросы с действительным ключом API или cookie, остальным отвечает 401
+func (a *Authenticator) Required(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearer(r.Header.Get("Authorization")); ok {
+			a.serveBearer(w, r, token, h)
+			return
+		}
+
+		ctx, err := a.fromCookie(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		a.refreshCookie(w, ctx)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// serveBearer передаёт запрос дальше от имени владельца ключа API или JWT
+func (a *Authenticator) serveBearer(w http.ResponseWriter, r *http.Request, token string, h http.Handler) {
+	ctx, err := a.Bearer(r.Context(), token)
+	if errors.Is(err, ErrInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.Info("can't check bearer token", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (a *Authenticator) fromCookie(r *http.Request) (context.Context, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return a.Authenticate(r.Context(), cookie.Value)
+}
+
+// refreshCookie перевыпускает JWT в cookie, у которого прошла половина срока действия
+func (a *Authenticator) refreshCookie(w http.ResponseWriter, ctx context.Context) {
+	claims, ok := ClaimsFromContext(ctx)
+	if a.jwt == nil || !ok || !a.jwt.refresh(claims) {
+		return
+	}
+
+	token, err := a.jwt.issue(claims.Subject)
+	if err != nil {
+		logger.Log.Info("can't refresh token", zap.Error(err))
+		return
+	}
+	setCookie(w, token)
+}
+
+func setCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// jwksCheckInterval — как часто проверяется, не изменился ли файл JWKS
+const jwksCheckInterval = time.Second
+
+// jwk — ключ из файла JWKS
+type jwk struct {
+	id  string
+	alg string
+	// secret — ключ HS256 (kty oct), public — ключ RS256 (kty RSA)
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// keySet — ключи из файла JWKS. Файл перечитывается при изменении, поэтому
+// ключи ротируются без перезапуска: новый ключ добавляется в файл до начала
+// выпуска токенов с ним, старый удаляется после истечения его токенов.
+type keySet struct {
+	path string
+
+	mu      sync.Mutex
+	keys    []jwk
+	checked time.Time
+	modTime time.Time
+	size    int64
+}
+
+// load читает файл JWKS
+func (s *keySet) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("can't read jwks file: %w", err)
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("can't read jwks file: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("can't parse jwks file %s: %w", s.path, err)
+	}
+
+	s.keys, s.modTime, s.size = keys, info.ModTime(), info.Size()
+	return nil
+}
+
+// current возвращает ключи, перечитав файл, если он изменился.
+// Ошибка чтения не сбрасывает ключи: проверка продолжается по последнему удачно прочитанному файлу.
+func (s *keySet) current() []jwk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) < jwksCheckInterval {
+		return s.keys
+	}
+	s.checked = time.Now()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		logger.Log.Info("can't stat jwks file", zap.Error(err))
+		return s.keys
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.keys
+	}
+
+	if err = s.load(); err != nil {
+		logger.Log.Info("can't reload jwks file", zap.Error(err))
+		return s.keys
+	}
+	logger.Log.Info("jwks file reloaded", zap.Int("keys", len(s.keys)))
+
+	return s.keys
+}
+
+// find возвращает ключи проверки алгоритма alg; без kid подходят все
+func (s *keySet) find(kid, alg string) []any {
+	var keys []any
+	for _, k := range s.current() {
+		if kid != "" && k.id != kid || k.alg != "" && k.alg != alg {
+			continue
+		}
+		switch {
+		case alg == HS256 && k.secret != nil:
+			keys = append(keys, k.secret)
+		case alg == RS256 && k.public != nil:
+			keys = append(keys, k.public)
+		}
+	}
+
+	return keys
+}
+
+// signing возвращает ключ HS256 для подписи: с kid, если он задан, иначе первый в файле
+func (s *keySet) signing(kid string) (jwk, bool) {
+	if s == nil {
+		return jwk{}, false
+	}
+
+	for _, k := range s.current() {
+		if k.secret != nil && (kid == "" || k.id == kid) && (k.alg == "" || k.alg == HS256) {
+			return k, true
+		}
+	}
+
+	return jwk{}, false
+}
+
+// parseJWKS разбирает набор ключей по RFC 7517; ключи шифрования и неизвестных типов пропускаются
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+
+		k := jwk{id: raw.Kid, alg: raw.Alg}
+		switch raw.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(raw.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("key %q: invalid k", raw.Kid)
+			}
+			k.secret = secret
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(raw.N)
+			if err != nil || len(n) == 0 {
+				return nil, fmt.Errorf("key %q: invalid n", raw.Kid)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(raw.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %q: invalid e", raw.Kid)
+			}
+			k.public = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		default:
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	return keys, nil
+}
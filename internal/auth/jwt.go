@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Алгоритмы подписи JWT
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// leeway — допустимое расхождение часов с шлюзом, выпустившим токен
+const leeway = time.Minute
+
+// ErrCannotIssue возвращается, если в режиме JWT нет ключа для подписи токенов:
+// сервис только проверяет токены, выпущенные шлюзом
+var ErrCannotIssue = errors.New("no key to sign tokens")
+
+// JWTOptions — параметры режима JWT
+type JWTOptions struct {
+	// Algorithm — HS256 или RS256; токены с другим алгоритмом отклоняются
+	Algorithm string
+	// Secret — общий ключ HS256
+	Secret string
+	// Issuer и Audience, если заданы, должны совпадать с iss и одним из aud токена
+	Issuer   string
+	Audience string
+	// JWKSFile — файл JWKS с ключами проверки; перечитывается при изменении
+	JWKSFile string
+	// PrivateKeyFile — закрытый ключ RSA в PEM для выпуска токенов RS256
+	PrivateKeyFile string
+	// KeyID — kid выпускаемых токенов
+	KeyID string
+	// TTL — срок действия выпускаемых токенов, 0 — бессрочные
+	TTL time.Duration
+}
+
+// Claims — утверждения JWT
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	// Extra — все утверждения токена, в том числе добавленные шлюзом
+	Extra map[string]any `json:"-"`
+}
+
+// Audience — утверждение aud: строка или массив строк
+type Audience []string
+
+// UnmarshalJSON разбирает aud в обоих видах
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+type claimsKey struct{}
+
+// WithClaims сохраняет в контексте утверждения JWT и пользователя из sub
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(WithUserID(ctx, claims.Subject), claimsKey{}, claims)
+}
+
+// ClaimsFromContext возвращает утверждения JWT, с которым пришёл запрос
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// jwtCodec выпускает и проверяет JWT
+type jwtCodec struct {
+	opts JWTOptions
+	// keys — ключи проверки из JWKS, nil без файла JWKS
+	keys *keySet
+	// secret — ключ HS256 из параметров
+	secret []byte
+	// private — ключ подписи RS256
+	private *rsa.PrivateKey
+	now     func() time.Time
+}
+
+// UseJWT переключает Authenticator в режим JWT: cookie и заголовок Authorization: Bearer
+// содержат JWT вместо собственного токена сервиса
+func (a *Authenticator) UseJWT(opts JWTOptions) error {
+	c := &jwtCodec{opts: opts, now: time.Now}
+
+	switch opts.Algorithm {
+	case HS256:
+		c.secret = []byte(opts.Secret)
+	case RS256:
+		if opts.PrivateKeyFile != "" {
+			key, err := readPrivateKey(opts.PrivateKeyFile)
+			if err != nil {
+				return err
+			}
+			c.private = key
+		}
+	default:
+		return fmt.Errorf("unsupported jwt algorithm %q", opts.Algorithm)
+	}
+
+	if opts.JWKSFile != "" {
+		c.keys = &keySet{path: opts.JWKSFile}
+		if err := c.keys.load(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.secret) == 0 && c.private == nil && c.keys == nil {
+		return errors.New("jwt mode requires a secret, a private key or a jwks file")
+	}
+
+	a.jwt = c
+	return nil
+}
+
+// issue выпускает токен пользователя userID
+func (c *jwtCodec) issue(userID string) (string, error) {
+	key, kid, err := c.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := c.now()
+	claims := map[string]any{"sub": userID, "iat": now.Unix()}
+	if c.opts.TTL > 0 {
+		claims["exp"] = now.Add(c.opts.TTL).Unix()
+	}
+	if c.opts.Issuer != "" {
+		claims["iss"] = c.opts.Issuer
+	}
+	if c.opts.Audience != "" {
+		claims["aud"] = c.opts.Audience
+	}
+
+	header, err := json.Marshal(jwtHeader{Algorithm: c.opts.Algorithm, Type: "JWT", KeyID: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	sig, err := sign(c.opts.Algorithm, key, signed)
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + encodeSegment(sig), nil
+}
+
+// signingKey возвращает ключ подписи и его kid
+func (c *jwtCodec) signingKey() (any, string, error) {
+	if c.opts.Algorithm == RS256 {
+		if c.private == nil {
+			return nil, "", ErrCannotIssue
+		}
+		return c.private, c.opts.KeyID, nil
+	}
+
+	if len(c.secret) > 0 {
+		return c.secret, c.opts.KeyID, nil
+	}
+
+	// HS256 без общего ключа в параметрах: подписываем ключом из JWKS
+	if k, ok := c.keys.signing(c.opts.KeyID); ok {
+		return k.secret, k.id, nil
+	}
+
+	return nil, "", ErrCannotIssue
+}
+
+// verify проверяет подпись и утверждения токена
+func (c *jwtCodec) verify(token string) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrInvalidToken
+	}
+	// алгоритм задаётся конфигурацией, а не токеном: иначе подойдёт alg=none
+	// или HS256 с открытым ключом RSA в роли общего секрета
+	if header.Algorithm != c.opts.Algorithm {
+		return claims, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if !c.checkSignature(header.KeyID, parts[0]+"."+parts[1], sig) {
+		return claims, ErrInvalidToken
+	}
+
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err = decodeSegment(parts[1], &claims.Extra); err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	if err = c.validate(claims); err != nil {
+		return claims, err
+	}
+
+	return claims, nil
+}
+
+func (c *jwtCodec) checkSignature(kid, signed string, sig []byte) bool {
+	for _, key := range c.verificationKeys(kid) {
+		if verify(c.opts.Algorithm, key, signed, sig) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verificationKeys возвращает ключи, которыми мог быть подписан токен с kid
+func (c *jwtCodec) verificationKeys(kid string) []any {
+	var keys []any
+	if c.opts.Algorithm == HS256 && len(c.secret) > 0 && (kid == "" || kid == c.opts.KeyID) {
+		keys = append(keys, c.secret)
+	}
+	if c.opts.Algorithm == RS256 && c.private != nil && (kid == "" || kid == c.opts.KeyID) {
+		keys = append(keys, &c.private.PublicKey)
+	}
+	if c.keys != nil {
+		keys = append(keys, c.keys.find(kid, c.opts.Algorithm)...)
+	}
+
+	return keys
+}
+
+func (c *jwtCodec) validate(claims Claims) error {
+	now := c.now()
+
+	if claims.Subject == "" {
+		return ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && !now.Before(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return ErrInvalidToken
+	}
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return ErrInvalidToken
+	}
+	if c.opts.Issuer != "" && claims.Issuer != c.opts.Issuer {
+		return ErrInvalidToken
+	}
+	if c.opts.Audience != "" && !slices.Contains(claims.Audience, c.opts.Audience) {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// refresh сообщает, что токен пора перевыпустить: прошла половина срока действия.
+// Так активный пользователь не теряет свои ссылки, когда истекает токен в cookie.
+func (c *jwtCodec) refresh(claims Claims) bool {
+	if c.opts.TTL <= 0 || claims.ExpiresAt == 0 {
+		return false
+	}
+	if _, _, err := c.signingKey(); err != nil {
+		return false
+	}
+
+	return time.Unix(claims.ExpiresAt, 0).Sub(c.now()) < c.opts.TTL/2
+}
+
+func sign(alg string, key any, signed string) ([]byte, error) {
+	switch alg {
+	case HS256:
+		h := hmac.New(sha256.New, key.([]byte))
+		h.Write([]byte(signed))
+		return h.Sum(nil), nil
+	case RS256:
+		sum := sha256.Sum256([]byte(signed))
+		return rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, sum[:])
+	}
+
+	return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+}
+
+func verify(alg string, key any, signed string, sig []byte) bool {
+	switch k := key.(type) {
+	case []byte:
+		if alg != HS256 {
+			return false
+		}
+		h := hmac.New(sha256.New, k)
+		h.Write([]byte(signed))
+		return hmac.Equal(sig, h.Sum(nil))
+	case *rsa.PublicKey:
+		if alg != RS256 {
+			return false
+		}
+		sum := sha256.Sum256([]byte(signed))
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	}
+
+	return false
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// readPrivateKey читает закрытый ключ RSA в формате PKCS #1 или PKCS #8
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read jwt private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt private key %s is not PEM encoded", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse jwt private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt private key %s is not an RSA key", path)
+	}
+
+	return key, nil
+}
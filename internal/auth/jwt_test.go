@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatewayToken подписывает токен так, как это делает шлюз
+func gatewayToken(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(jwtHeader{Algorithm: alg, Type: "JWT", KeyID: kid})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	sig, err := sign(alg, key, signed)
+	require.NoError(t, err)
+
+	return signed + "." + encodeSegment(sig)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"alg": RS256,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestJWTHS256(t *testing.T) {
+	a := New("")
+	require.NoError(t, a.UseJWT(JWTOptions{Algorithm: HS256, Secret: "shared", Issuer: "sso", Audience: "shortener", TTL: time.Hour}))
+
+	userID, token, err := a.Issue()
+	require.NoError(t, err)
+	got, err := a.UserID(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+
+	now := time.Now().Unix()
+	valid := map[string]any{"sub": "alice", "iss": "sso", "aud": []string{"other", "shortener"}, "exp": now + 60, "email": "alice@example.com"}
+	ctx, err := a.Authenticate(context.Background(), gatewayToken(t, HS256, "", []byte("shared"), valid))
+	require.NoError(t, err)
+	claims, ok := ClaimsFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, "alice@example.com", claims.Extra["email"])
+	got, _ = UserIDFromContext(ctx)
+	assert.Equal(t, "alice", got)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		claims map[string]any
+	}{
+		{name: "wrong secret", token: gatewayToken(t, HS256, "", []byte("other"), valid)},
+		{name: "other algorithm", token: gatewayToken(t, RS256, "", rsaKey, valid)},
+		{name: "alg none", token: encodeSegment([]byte(`{"alg":"none"}`)) + "." + encodeSegment([]byte(`{"sub":"alice"}`)) + "."},
+		{name: "expired", claims: map[string]any{"sub": "alice", "iss": "sso", "aud": "shortener", "exp": now - 3600}},
+		{name: "not yet valid", claims: map[string]any{"sub": "alice", "iss": "sso", "aud": "shortener", "nbf": now + 3600}},
+		{name: "wrong issuer", claims: map[string]any{"sub": "alice", "iss": "evil", "aud": "shortener"}},
+		{name: "wrong audience", claims: map[string]any{"sub": "alice", "iss": "sso", "aud": "billing"}},
+		{name: "no subject", claims: map[string]any{"iss": "sso", "aud": "shortener"}},
+		{name: "garbage", token: "a.b.c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if tt.claims != nil {
+				token = gatewayToken(t, HS256, "", []byte("shared"), tt.claims)
+			}
+
+			_, err := a.Authenticate(context.Background(), token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestJWTRS256JWKSRotation(t *testing.T) {
+	dir := t.TempDir()
+	jwks := filepath.Join(dir, "jwks.json")
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeJWKS(t, jwks, rsaJWK("old", oldKey))
+
+	// шлюз выпускает токены сам: у сервиса нет закрытого ключа
+	a := New("")
+	require.NoError(t, a.UseJWT(JWTOptions{Algorithm: RS256, JWKSFile: jwks}))
+	_, _, err = a.Issue()
+	assert.ErrorIs(t, err, ErrCannotIssue)
+
+	oldToken := gatewayToken(t, RS256, "old", oldKey, map[string]any{"sub": "alice"})
+	newToken := gatewayToken(t, RS256, "new", newKey, map[string]any{"sub": "bob"})
+
+	_, err = a.Authenticate(context.Background(), oldToken)
+	require.NoError(t, err)
+	_, err = a.Authenticate(context.Background(), newToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	rotate := func(keys ...map[string]string) {
+		writeJWKS(t, jwks, keys...)
+		modTime := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(jwks, modTime, modTime))
+		a.jwt.keys.checked = time.Time{}
+	}
+
+	rotate(rsaJWK("old", oldKey), rsaJWK("new", newKey))
+	_, err = a.Authenticate(context.Background(), oldToken)
+	require.NoError(t, err)
+	_, err = a.Authenticate(context.Background(), newToken)
+	require.NoError(t, err)
+
+	rotate(rsaJWK("new", newKey))
+	_, err = a.Authenticate(context.Background(), oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = a.Authenticate(context.Background(), newToken)
+	require.NoError(t, err)
+
+	// повреждённый файл не сбрасывает последние ключи
+	require.NoError(t, os.WriteFile(jwks, []byte("{"), 0o600))
+	a.jwt.keys.checked = time.Time{}
+	_, err = a.Authenticate(context.Background(), newToken)
+	require.NoError(t, err)
+}
+
+func TestJWTRS256PrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	a := New("")
+	require.NoError(t, a.UseJWT(JWTOptions{Algorithm: RS256, PrivateKeyFile: path, KeyID: "k1"}))
+
+	userID, token, err := a.Issue()
+	require.NoError(t, err)
+	got, err := a.UserID(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	a := New("")
+	require.NoError(t, a.UseJWT(JWTOptions{Algorithm: HS256, Secret: "shared", TTL: time.Hour}))
+
+	var claims Claims
+	h := a.Required(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = ClaimsFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	r.Header.Set("Authorization", "Bearer "+gatewayToken(t, HS256, "", []byte("shared"), map[string]any{"sub": "alice", "role": "admin"}))
+	w := httptest.NewRecorder()
+	h(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, "admin", claims.Extra["role"])
+	assert.Empty(t, w.Result().Cookies())
+
+	r.Header.Set("Authorization", "Bearer "+gatewayToken(t, HS256, "", []byte("other"), map[string]any{"sub": "alice"}))
+	w = httptest.NewRecorder()
+	h(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// cookie с токеном, у которого прошла половина срока, перевыпускается для того же пользователя
+	stale := gatewayToken(t, HS256, "", []byte("shared"), map[string]any{"sub": "bob", "exp": time.Now().Add(10 * time.Minute).Unix()})
+	r = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: stale})
+	w = httptest.NewRecorder()
+	h(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, w.Result().Cookies(), 1)
+	userID, err := a.UserID(w.Result().Cookies()[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", userID)
+}
@@ -0,0 +1,154 @@
+// Package compress реализует сжатие ответов и распаковку тел запросов
+// с поддержкой gzip, deflate, brotli и zstd.
+package compress
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/limits"
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// Поддерживаемые кодировки
+const (
+	Brotli  = "br"
+	Zstd    = "zstd"
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// preference — порядок выбора кодировки при равных весах q
+var preference = []string{Brotli, Zstd, Gzip, Deflate}
+
+// DefaultMinSize — ответы меньшего размера не сжимаются: выигрыш меньше накладных расходов
+const DefaultMinSize = 512
+
+// Compressor сжимает ответы и распаковывает запросы
+type Compressor struct {
+	minSize int
+}
+
+// New возвращает Compressor, который сжимает ответы не меньше minSize байт
+func New(minSize int) *Compressor {
+	return &Compressor{minSize: minSize}
+}
+
+// Middleware распаковывает тело запроса по Content-Encoding и сжимает ответ кодировкой,
+// выбранной по Accept-Encoding, если тип содержимого ответа сжимаемый и он достаточно велик.
+// Повреждённое сжатое тело отклоняется с кодом 400, неизвестная кодировка — с кодом 415,
+// превышение лимита распакованного размера — с кодом 413.
+func (c *Compressor) Middleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "" && r.Body != nil && r.Body != http.NoBody {
+			// лимит распакованного тела задаёт limits.Middleware маршрута
+			l, _ := limits.FromContext(r.Context())
+
+			body, err := decodeBody(r.Body, encoding, l.MaxDecompressedSize)
+			if err != nil {
+				logger.Log.Info("can't decode request body", zap.String("encoding", encoding), zap.Error(err))
+				status := http.StatusBadRequest
+				switch {
+				case errors.Is(err, errUnsupportedEncoding):
+					status = http.StatusUnsupportedMediaType
+				case errors.Is(err, limits.ErrTooLarge):
+					status = http.StatusRequestEntityTooLarge
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+
+		if r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// без подходящей кодировки ответ тоже проходит через writer, чтобы выставить Vary
+		cw := &responseWriter{ResponseWriter: w, encoding: Negotiate(r.Header.Get("Accept-Encoding")), minSize: c.minSize, status: http.StatusOK}
+		defer cw.Close()
+
+		h.ServeHTTP(cw, r)
+	}
+}
+
+// Negotiate выбирает кодировку ответа по заголовку Accept-Encoding с учётом весов q.
+// Пустая строка означает, что ответ нужно отдать без сжатия.
+func Negotiate(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				q = 0
+			} else {
+				q = parsed
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		// x-gzip — устаревший синоним gzip
+		if name == "x-gzip" {
+			name = Gzip
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range preference {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compressible сообщает, имеет ли смысл сжимать содержимое такого типа
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
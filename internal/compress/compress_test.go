@@ -0,0 +1,167 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "gzip", want: Gzip},
+		{acceptEncoding: "gzip, deflate, br, zstd", want: Brotli},
+		{acceptEncoding: "gzip;q=1.0, br;q=0.5", want: Gzip},
+		{acceptEncoding: "br;q=0, gzip;q=0.1", want: Gzip},
+		{acceptEncoding: "deflate, gzip;q=0.9", want: Deflate},
+		{acceptEncoding: "*", want: Brotli},
+		{acceptEncoding: "*;q=0.5, zstd;q=0.8, br;q=0", want: Zstd},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "gzip;q=0", want: ""},
+		{acceptEncoding: "x-gzip", want: Gzip},
+		{acceptEncoding: "GZIP ; Q=0.5", want: Gzip},
+	}
+
+	for _, test := range tests {
+		t.Run(test.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, test.want, Negotiate(test.acceptEncoding))
+		})
+	}
+}
+
+func decompress(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case Gzip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case Deflate:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case Zstd:
+		r, err = zstd.NewReader(bytes.NewReader(data))
+	case "":
+		r = bytes.NewReader(data)
+	}
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func TestMiddlewareResponse(t *testing.T) {
+	large := `{"result":"` + strings.Repeat("a", 2*DefaultMinSize) + `"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		wantEncoding   string
+	}{
+		{name: "gzip json", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusOK, body: large, wantEncoding: Gzip},
+		{name: "deflate", acceptEncoding: "deflate", contentType: "application/json", status: http.StatusOK, body: large, wantEncoding: Deflate},
+		{name: "brotli", acceptEncoding: "br", contentType: "application/json", status: http.StatusCreated, body: large, wantEncoding: Brotli},
+		{name: "zstd html", acceptEncoding: "zstd", contentType: "text/html; charset=utf-8", status: http.StatusOK, body: large, wantEncoding: Zstd},
+		{name: "detected content type", acceptEncoding: "gzip", status: http.StatusOK, body: large, wantEncoding: Gzip},
+		{name: "error status", acceptEncoding: "gzip", contentType: "text/plain", status: http.StatusGone, body: large, wantEncoding: Gzip},
+		{name: "small body", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusOK, body: `{"result":"a"}`},
+		{name: "image", acceptEncoding: "gzip", contentType: "image/png", status: http.StatusOK, body: large},
+		{name: "no accept encoding", contentType: "application/json", status: http.StatusOK, body: large},
+		{name: "no body", acceptEncoding: "gzip", status: http.StatusTemporaryRedirect},
+	}
+
+	c := New(DefaultMinSize)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.WriteHeader(test.status)
+				// тело пишется частями, чтобы проверить буферизацию
+				for i := 0; i < len(test.body); i += 100 {
+					w.Write([]byte(test.body[i:min(i+100, len(test.body))]))
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.wantEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, test.body, decompress(t, test.wantEncoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestMiddlewareRequest(t *testing.T) {
+	const payload = `{"url":"https://yoga.org"}`
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(payload))
+	zw.Close()
+
+	var zs bytes.Buffer
+	enc, err := zstd.NewWriter(&zs)
+	require.NoError(t, err)
+	enc.Write([]byte(payload))
+	enc.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{name: "gzip", encoding: "gzip", body: gz.Bytes(), status: http.StatusOK},
+		{name: "zstd", encoding: "zstd", body: zs.Bytes(), status: http.StatusOK},
+		{name: "identity", encoding: "identity", body: []byte(payload), status: http.StatusOK},
+		{name: "corrupt gzip header", encoding: "gzip", body: []byte("not gzip at all"), status: http.StatusBadRequest},
+		{name: "truncated gzip", encoding: "gzip", body: gz.Bytes()[:gz.Len()-6], status: http.StatusBadRequest},
+		{name: "unsupported", encoding: "compress", body: []byte(payload), status: http.StatusUnsupportedMediaType},
+	}
+
+	c := New(DefaultMinSize)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, payload, string(body))
+				assert.Empty(t, r.Header.Get("Content-Encoding"))
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			r.Header.Set("Content-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
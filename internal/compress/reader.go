@@ -0,0 +1,91 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Nastez/shortener/internal/limits"
+)
+
+// errUnsupportedEncoding — тело запроса закодировано неизвестным способом
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodeBody распаковывает тело запроса целиком, чтобы повреждённые данные
+// обнаруживались до вызова обработчика. Кодировки применяются в обратном порядке.
+// Результат каждой распаковки ограничен maxSize байт (0 — без ограничения),
+// при превышении возвращается limits.ErrTooLarge.
+func decodeBody(body io.ReadCloser, contentEncoding string, maxSize int64) (io.ReadCloser, error) {
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read body: %w", err)
+	}
+
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		if data, err = decode(data, encoding, maxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func decode(data []byte, encoding string, maxSize int64) ([]byte, error) {
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case Gzip, "x-gzip":
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	case Deflate:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case Zstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1)); err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	default:
+		return nil, errUnsupportedEncoding
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s body: %w", encoding, err)
+	}
+
+	decoded, err := limits.ReadAll(r, maxSize)
+	if errors.Is(err, limits.ErrTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s body: %w", encoding, err)
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,184 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder — сжимающий writer, который можно переиспользовать через Reset
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders хранит пулы writer'ов для каждой кодировки
+var encoders = map[string]*sync.Pool{
+	Gzip: {New: func() any {
+		zw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return zw
+	}},
+	Deflate: {New: func() any {
+		// в HTTP кодировка deflate означает поток zlib (RFC 9110)
+		zw, _ := zlib.NewWriterLevel(io.Discard, zlib.DefaultCompression)
+		return zw
+	}},
+	Brotli: {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	Zstd: {New: func() any {
+		zw, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return zw
+	}},
+}
+
+// responseWriter откладывает решение о сжатии до получения первых minSize байт ответа,
+// чтобы учесть Content-Type и размер ответа
+type responseWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+}
+
+func (c *responseWriter) WriteHeader(statusCode int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = statusCode
+
+	// у этих ответов нет тела, сжимать нечего
+	if statusCode < http.StatusOK || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		c.decide(false)
+	}
+}
+
+func (c *responseWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if !c.decided {
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < c.minSize {
+			return len(p), nil
+		}
+		if err := c.decideAndFlush(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush отправляет клиенту накопленные данные
+func (c *responseWriter) Flush() {
+	if !c.decided {
+		if !c.wroteHeader {
+			c.WriteHeader(http.StatusOK)
+		}
+		c.decideAndFlush(len(c.buf) >= c.minSize)
+	}
+
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному writer'у
+func (c *responseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close дописывает накопленный ответ и возвращает writer в пул
+func (c *responseWriter) Close() error {
+	if !c.decided {
+		if !c.wroteHeader && len(c.buf) == 0 {
+			// обработчик ничего не записал, ответ сформирует net/http
+			return nil
+		}
+		if err := c.decideAndFlush(len(c.buf) >= c.minSize); err != nil {
+			return err
+		}
+	}
+
+	if c.enc == nil {
+		return nil
+	}
+
+	err := c.enc.Close()
+	c.enc.Reset(io.Discard)
+	encoders[c.encoding].Put(c.enc)
+	c.enc = nil
+
+	return err
+}
+
+func (c *responseWriter) decideAndFlush(bigEnough bool) error {
+	if h := c.Header(); h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		// как и net/http, определяем тип по началу тела
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	c.decide(bigEnough && compressible(c.Header().Get("Content-Type")))
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	buf := c.buf
+	c.buf = nil
+	if c.enc != nil {
+		_, err := c.enc.Write(buf)
+		return err
+	}
+
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// decide фиксирует решение о сжатии и отправляет заголовки
+func (c *responseWriter) decide(compress bool) {
+	c.decided = true
+
+	h := c.Header()
+	if h.Get("Content-Encoding") != "" || c.encoding == "" {
+		// обработчик уже отдаёт закодированное тело или клиент не принимает сжатие
+		compress = false
+	}
+
+	if compress {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		h.Add("Vary", "Accept-Encoding")
+
+		c.enc = encoders[c.encoding].Get().(encoder)
+		c.enc.Reset(c.ResponseWriter)
+	} else if compressible(h.Get("Content-Type")) {
+		// ответ мог бы быть сжат при другом Accept-Encoding
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+}
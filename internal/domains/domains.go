@@ -0,0 +1,116 @@
+// Package domains описывает короткие домены, которые обслуживает один экземпляр сервиса.
+// Каждый домен задаёт базовый адрес коротких ссылок, длину идентификатора и пространство
+// имён: один и тот же идентификатор может существовать в разных пространствах.
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultIDLength — длина идентификатора, если домен её не задаёт
+const DefaultIDLength = 8
+
+// Domain — короткий домен
+type Domain struct {
+	// Host — значение заголовка Host, по которому выбирается домен; без порта совпадает с любым портом
+	Host string `json:"host" yaml:"host"`
+	// BaseURL — адрес, перед которым ставится идентификатор короткой ссылки
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// IDLength — длина генерируемого идентификатора, 0 — DefaultIDLength
+	IDLength int `json:"id_length" yaml:"id_length"`
+	// Namespace — пространство имён ссылок; по умолчанию совпадает с Host.
+	// Домены с общим пространством имён — синонимы друг друга.
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+// ShortURL собирает короткий URL ссылки с идентификатором id
+func (d Domain) ShortURL(id string) string {
+	return strings.TrimSuffix(d.BaseURL, "/") + "/" + id
+}
+
+// Registry выбирает домен по заголовку Host
+type Registry struct {
+	fallback    Domain
+	byHost      map[string]Domain
+	byNamespace map[string]Domain
+}
+
+// New возвращает Registry с доменами list. Запросы на неизвестные хосты обслуживает
+// домен по умолчанию с базовым адресом baseURL и пустым пространством имён,
+// в котором лежат ссылки, созданные до появления доменов.
+func New(baseURL string, list []Domain) (*Registry, error) {
+	if baseURL == "" {
+		return nil, errors.New("base url is empty")
+	}
+
+	fallback := Domain{BaseURL: baseURL, IDLength: DefaultIDLength}
+	r := &Registry{
+		fallback:    fallback,
+		byHost:      make(map[string]Domain, len(list)),
+		byNamespace: map[string]Domain{"": fallback},
+	}
+
+	for _, d := range list {
+		if d.Host == "" {
+			return nil, errors.New("domain host is empty")
+		}
+		if d.BaseURL == "" {
+			return nil, fmt.Errorf("domain %s: base url is empty", d.Host)
+		}
+		if d.IDLength < 0 {
+			return nil, fmt.Errorf("domain %s: id length must not be negative", d.Host)
+		}
+
+		host := strings.ToLower(d.Host)
+		if _, ok := r.byHost[host]; ok {
+			return nil, fmt.Errorf("domain %s is configured twice", d.Host)
+		}
+		if d.IDLength == 0 {
+			d.IDLength = DefaultIDLength
+		}
+		if d.Namespace == "" {
+			d.Namespace = host
+		}
+
+		r.byHost[host] = d
+		if _, ok := r.byNamespace[d.Namespace]; !ok {
+			// ссылки общего пространства имён выдаются с адресом первого домена
+			r.byNamespace[d.Namespace] = d
+		}
+	}
+
+	return r, nil
+}
+
+// Resolve возвращает домен по заголовку Host или домен по умолчанию
+func (r *Registry) Resolve(host string) Domain {
+	host = strings.ToLower(host)
+	if d, ok := r.byHost[host]; ok {
+		return d
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if d, ok := r.byHost[hostname]; ok {
+			return d
+		}
+	}
+
+	return r.fallback
+}
+
+// Namespace возвращает домен, которым выдаются ссылки пространства имён namespace
+func (r *Registry) Namespace(namespace string) Domain {
+	if d, ok := r.byNamespace[namespace]; ok {
+		return d
+	}
+
+	return r.fallback
+}
+
+// Default возвращает домен по умолчанию
+func (r *Registry) Default() Domain {
+	return r.fallback
+}
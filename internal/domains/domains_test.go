@@ -0,0 +1,54 @@
+package domains
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := New("http://localhost:8080", []Domain{
+		{Host: "sho.rt", BaseURL: "https://sho.rt", IDLength: 5},
+		{Host: "www.sho.rt", BaseURL: "https://www.sho.rt", Namespace: "sho.rt"},
+		{Host: "brand.example:8443", BaseURL: "https://brand.example:8443/go/"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		host      string
+		baseURL   string
+		namespace string
+		idLength  int
+	}{
+		{name: "exact host", host: "sho.rt", baseURL: "https://sho.rt", namespace: "sho.rt", idLength: 5},
+		{name: "host with any port", host: "SHO.RT:8080", baseURL: "https://sho.rt", namespace: "sho.rt", idLength: 5},
+		{name: "alias shares namespace", host: "www.sho.rt", baseURL: "https://www.sho.rt", namespace: "sho.rt", idLength: DefaultIDLength},
+		{name: "host with port", host: "brand.example:8443", baseURL: "https://brand.example:8443/go/", namespace: "brand.example:8443", idLength: DefaultIDLength},
+		{name: "unknown host", host: "other.example", baseURL: "http://localhost:8080", namespace: "", idLength: DefaultIDLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := r.Resolve(tt.host)
+			assert.Equal(t, tt.baseURL, d.BaseURL)
+			assert.Equal(t, tt.namespace, d.Namespace)
+			assert.Equal(t, tt.idLength, d.IDLength)
+		})
+	}
+
+	assert.Equal(t, "https://sho.rt/abc", r.Namespace("sho.rt").ShortURL("abc"))
+	assert.Equal(t, "https://brand.example:8443/go/abc", r.Namespace("brand.example:8443").ShortURL("abc"))
+	assert.Equal(t, "http://localhost:8080/abc", r.Namespace("").ShortURL("abc"))
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New("http://localhost:8080", []Domain{{Host: "sho.rt", BaseURL: "https://sho.rt"}, {Host: "SHO.RT", BaseURL: "https://sho.rt"}})
+	assert.Error(t, err)
+
+	_, err = New("http://localhost:8080", []Domain{{BaseURL: "https://sho.rt"}})
+	assert.Error(t, err)
+
+	_, err = New("", nil)
+	assert.Error(t, err)
+}
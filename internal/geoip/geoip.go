@@ -0,0 +1,140 @@
+// Package geoip определяет страну по IP-адресу из офлайн-базы в формате CSV.
+//
+// Каждая строка базы — диапазон адресов и двухбуквенный код страны ISO 3166-1:
+//
+//	1.0.0.0,1.0.0.255,AU
+//	2a02:6b8::/32,RU
+//
+// Диапазон задаётся первым и последним адресом, как в бесплатных базах DB-IP и IP2Location,
+// или сетью в нотации CIDR. Пустые строки и строки, начинающиеся с #, пропускаются.
+package geoip
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DB — база диапазонов, отсортированных по первому адресу
+type DB struct {
+	ranges []ipRange
+}
+
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// Open читает базу из файла path
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("geoip database %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// Read читает базу из r
+func Read(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	db := &DB{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		rng, err := parseRange(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].first.Less(db.ranges[j].first)
+	})
+
+	return db, nil
+}
+
+func parseRange(record []string) (ipRange, error) {
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(record[0])
+		if err != nil {
+			return ipRange{}, err
+		}
+		prefix = prefix.Masked()
+
+		return ipRange{first: prefix.Addr(), last: lastAddr(prefix), country: strings.ToUpper(record[1])}, nil
+	case 3:
+		first, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return ipRange{}, err
+		}
+		last, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return ipRange{}, err
+		}
+		if first.Is4() != last.Is4() || last.Less(first) {
+			return ipRange{}, fmt.Errorf("invalid range %s-%s", first, last)
+		}
+
+		return ipRange{first: first, last: last, country: strings.ToUpper(record[2])}, nil
+	}
+
+	return ipRange{}, fmt.Errorf("expected first,last,country or network,country, got %d fields", len(record))
+}
+
+// lastAddr возвращает последний адрес сети
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+
+	return addr
+}
+
+// Country возвращает код страны адреса addr или пустую строку, если адреса нет в базе
+func (db *DB) Country(addr netip.Addr) string {
+	addr = addr.Unmap()
+
+	// последний диапазон, начинающийся не позже addr
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].first)
+	}) - 1
+	if i < 0 {
+		return ""
+	}
+
+	rng := db.ranges[i]
+	if rng.first.Is4() != addr.Is4() || rng.last.Less(addr) {
+		return ""
+	}
+
+	return rng.country
+}
@@ -0,0 +1,54 @@
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountry(t *testing.T) {
+	db, err := Read(strings.NewReader(`# first,last,country
+1.0.0.0,1.0.0.255,au
+5.255.255.0, 5.255.255.255, RU
+10.0.0.0/8,ZZ
+
+2a02:6b8::/32,RU
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "1.0.0.0", want: "AU"},
+		{addr: "1.0.0.255", want: "AU"},
+		{addr: "1.0.1.0", want: ""},
+		{addr: "5.255.255.5", want: "RU"},
+		{addr: "10.20.30.40", want: "ZZ"},
+		{addr: "::ffff:10.0.0.1", want: "ZZ"},
+		{addr: "2a02:6b8:a::1", want: "RU"},
+		{addr: "2a02:6b9::1", want: ""},
+		{addr: "0.0.0.1", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, db.Country(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	require.NoError(t, os.WriteFile(path, []byte("1.0.0.0,1.0.0.255,AU\n1.0.0.9,oops\n"), 0o600))
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.csv"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/auth"
+	pb "github.com/Nastez/shortener/internal/proto"
+)
+
+// requiredAuth — методы, которым нужен уже существующий пользователь (аналог 401 в HTTP API)
+var requiredAuth = map[string]bool{
+	pb.Shortener_ListUserURLs_FullMethodName: true,
+	pb.Shortener_Delete_FullMethodName:       true,
+}
+
+// requiredScope — область действия ключа API, нужная методу
+var requiredScope = map[string]string{
+	pb.Shortener_Shorten_FullMethodName:      auth.ScopeCreate,
+	pb.Shortener_ShortenBatch_FullMethodName: auth.ScopeCreate,
+	pb.Shortener_ListUserURLs_FullMethodName: auth.ScopeReadStats,
+	pb.Shortener_Delete_FullMethodName:       auth.ScopeDelete,
+}
+
+// AuthInterceptor определяет пользователя по ключу API или JWT из метаданных authorization
+// или по токену в метаданных так же, как HTTP API по cookie.
+// Если токена нет, создаётся новый пользователь, а его токен отправляется клиенту в заголовке ответа.
+func AuthInterceptor(a *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+			return withBearer(ctx, a, md.Get("authorization")[0], req, info, handler)
+		}
+
+		userCtx, err := fromMetadata(ctx, a)
+		if err == nil {
+			return handler(userCtx, req)
+		}
+
+		if requiredAuth[info.FullMethod] {
+			return nil, status.Error(codes.Unauthenticated, "token is required")
+		}
+
+		_, token, err := a.Issue()
+		if errors.Is(err, auth.ErrCannotIssue) {
+			return nil, status.Error(codes.Unauthenticated, "token is required")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, "cannot issue token")
+		}
+		if err = grpc.SetHeader(ctx, metadata.Pairs(auth.CookieName, token)); err != nil {
+			return nil, status.Error(codes.Internal, "cannot set token")
+		}
+
+		userCtx, err = a.Authenticate(ctx, token)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "cannot read issued token")
+		}
+
+		return handler(userCtx, req)
+	}
+}
+
+// withBearer вызывает метод от имени владельца ключа API или JWT
+func withBearer(ctx context.Context, a *auth.Authenticator, header string, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+
+	ctx, err := a.Bearer(ctx, strings.TrimSpace(token))
+	if errors.Is(err, auth.ErrInvalidToken) {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "cannot check bearer token")
+	}
+
+	if scope, ok := requiredScope[info.FullMethod]; ok && !auth.HasScope(ctx, scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "api key has no %s scope", scope)
+	}
+
+	return handler(ctx, req)
+}
+
+func fromMetadata(ctx context.Context, a *auth.Authenticator) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+
+	values := md.Get(auth.CookieName)
+	if len(values) == 0 {
+		return nil, auth.ErrInvalidToken
+	}
+
+	return a.Authenticate(ctx, values[0])
+}
+
+// RequestIDInterceptor берёт идентификатор запроса из метаданных x-request-id или генерирует новый
+// и возвращает его клиенту в заголовке ответа, как HTTP API
+func RequestIDInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(audit.RequestIDHeader); len(ids) > 0 && len(ids[0]) <= 128 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = audit.NewRequestID()
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(audit.RequestIDHeader, id)); err != nil {
+		return nil, status.Error(codes.Internal, "cannot set request id")
+	}
+
+	return handler(audit.WithRequestID(ctx, id), req)
+}
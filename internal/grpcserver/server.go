@@ -0,0 +1,244 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/logger"
+	pb "github.com/Nastez/shortener/internal/proto"
+	"github.com/Nastez/shortener/internal/rules"
+	"github.com/Nastez/shortener/internal/services"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Server реализует gRPC-сервис Shortener поверх того же слоя services и хранилища, что и HTTP API
+type Server struct {
+	pb.UnimplementedShortenerServer
+
+	store   store.Store
+	domains *domains.Registry
+	// maxBatchItems — наибольшее число элементов ShortenBatch, 0 — без ограничения
+	maxBatchItems int
+}
+
+// NewServer возвращает реализацию gRPC-сервиса; maxBatchItems ограничивает пакет так же,
+// как в HTTP API
+func NewServer(s store.Store, registry *domains.Registry, maxBatchItems int) (*Server, error) {
+	if s == nil {
+		return nil, errors.New("storage is empty")
+	}
+
+	if registry == nil {
+		return nil, errors.New("domains are empty")
+	}
+
+	return &Server{store: s, domains: registry, maxBatchItems: maxBatchItems}, nil
+}
+
+// domain выбирает домен запроса по псевдозаголовку :authority, как HTTP API — по Host
+func (s *Server) domain(ctx context.Context) domains.Domain {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		return s.domains.Resolve(authority[0])
+	}
+
+	return s.domains.Default()
+}
+
+// New создаёт grpc.Server с зарегистрированным сервисом и перехватчиком аутентификации
+func New(srv *Server, a *auth.Authenticator) *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(RequestIDInterceptor, AuthInterceptor(a)))
+	pb.RegisterShortenerServer(s, srv)
+
+	return s
+}
+
+func (s *Server) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is empty")
+	}
+
+	opts, err := services.NewLinkOptions(req.GetRedirectMode(), cacheMaxAge(req.CacheMaxAge))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if opts.Destinations, err = services.NewDestinations(destinations(req.GetDestinations())); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if opts.Rules, err = services.NewRules(redirectRules(req.GetRules())); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	userID, _ := auth.UserIDFromContext(ctx)
+	oldShortURL, shortURL, err := services.SaveURL(ctx, s.domain(ctx), s.store, req.GetUrl(), userID, opts)
+	if errors.Is(err, store.ErrConflict) && oldShortURL == "" {
+		return nil, status.Error(codes.AlreadyExists, "short id is already taken")
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return &pb.ShortenResponse{Result: oldShortURL, Conflict: true}, nil
+	}
+	if err != nil {
+		logger.Log.Debug("cannot save urls in the store", zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot save url")
+	}
+
+	return &pb.ShortenResponse{Result: shortURL}, nil
+}
+
+func (s *Server) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	if s.maxBatchItems > 0 && len(req.GetItems()) > s.maxBatchItems {
+		return nil, status.Errorf(codes.InvalidArgument, "batch must contain at most %d items", s.maxBatchItems)
+	}
+
+	requestBatch := make(models.PayloadBatch, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		if _, err := services.NewLinkOptions(item.GetRedirectMode(), cacheMaxAge(item.CacheMaxAge)); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		requestBatch = append(requestBatch, models.RequestBatch{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			RedirectMode:  item.GetRedirectMode(),
+			CacheMaxAge:   cacheMaxAge(item.CacheMaxAge),
+			Destinations:  destinations(item.GetDestinations()),
+			Rules:         redirectRules(item.GetRules()),
+		})
+	}
+
+	userID, _ := auth.UserIDFromContext(ctx)
+	responseBatch, err := services.SaveBatchURL(ctx, requestBatch, s.domain(ctx), s.store, userID)
+	if errors.Is(err, services.ErrInvalidDestinations) || errors.Is(err, rules.ErrInvalidRule) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Error(codes.AlreadyExists, "correlation_id is already taken")
+	}
+	if err != nil {
+		logger.Log.Debug("cannot save batch in the store", zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot save batch")
+	}
+
+	resp := &pb.ShortenBatchResponse{}
+	for _, b := range responseBatch {
+		resp.Items = append(resp.Items, &pb.BatchResult{
+			CorrelationId: b.CorrelationID,
+			ShortUrl:      b.ShortURL,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is empty")
+	}
+
+	link, err := s.store.Get(ctx, s.domain(ctx).Namespace, req.GetId())
+	if errors.Is(err, store.ErrDeleted) {
+		return nil, status.Error(codes.NotFound, "url is deleted")
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "url not found")
+	}
+	if err != nil {
+		logger.Log.Debug("cannot get originalURL", zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot get url")
+	}
+
+	resp := &pb.ResolveResponse{
+		OriginalUrl:  link.OriginalURL,
+		RedirectMode: string(link.RedirectMode),
+	}
+	if link.CacheMaxAge != nil {
+		age := int32(*link.CacheMaxAge)
+		resp.CacheMaxAge = &age
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	userURLs, err := services.GetUserURLs(ctx, s.domains, s.store, userID)
+	if err != nil {
+		logger.Log.Debug("cannot get user urls", zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot get user urls")
+	}
+
+	resp := &pb.ListUserURLsResponse{}
+	for _, url := range userURLs {
+		resp.Urls = append(resp.Urls, &pb.UserURL{
+			ShortUrl:    url.ShortURL,
+			OriginalUrl: url.OriginalURL,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	if err := services.DeleteUserURLs(ctx, s.store, s.domain(ctx).Namespace, userID, req.GetIds()); err != nil {
+		logger.Log.Debug("cannot delete user urls", zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot delete user urls")
+	}
+
+	return &pb.DeleteResponse{}, nil
+}
+
+// cacheMaxAge переводит необязательное поле protobuf в представление моделей
+func cacheMaxAge(age *int32) *int {
+	if age == nil {
+		return nil
+	}
+
+	v := int(*age)
+	return &v
+}
+
+// destinations переводит варианты protobuf в представление моделей
+func destinations(in []*pb.Destination) []models.Destination {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make([]models.Destination, 0, len(in))
+	for _, d := range in {
+		out = append(out, models.Destination{Variant: d.GetVariant(), URL: d.GetUrl(), Weight: int(d.GetWeight())})
+	}
+
+	return out
+}
+
+// redirectRules переводит правила перенаправления protobuf в представление моделей
+func redirectRules(in []*pb.Rule) []models.Rule {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make([]models.Rule, 0, len(in))
+	for _, r := range in {
+		out = append(out, models.Rule{Field: r.GetField(), Values: r.GetValues(), URL: r.GetUrl()})
+	}
+
+	return out
+}
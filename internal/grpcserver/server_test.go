@@ -0,0 +1,121 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/domains"
+	pb "github.com/Nastez/shortener/internal/proto"
+	"github.com/Nastez/shortener/internal/storage"
+)
+
+func newTestClient(t *testing.T) pb.ShortenerClient {
+	listen := bufconn.Listen(1024 * 1024)
+
+	registry, err := domains.New("http://localhost:0007", nil)
+	require.NoError(t, err)
+	srv, err := NewServer(storage.New(), registry, 2)
+	require.NoError(t, err)
+
+	s := New(srv, auth.New("secret"))
+	go s.Serve(listen)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listen.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	// без токена список URL недоступен
+	_, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// при первом сокращении сервер выдаёт токен в заголовке ответа
+	var header metadata.MD
+	shortened, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://yoga.org/"}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(auth.CookieName), 1)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, auth.CookieName, header.Get(auth.CookieName)[0])
+
+	list, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUrls(), 1)
+	assert.Equal(t, shortened.GetResult(), list.GetUrls()[0].GetShortUrl())
+
+	id := shortened.GetResult()[len("http://localhost:0007/"):]
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, "https://yoga.org/", resolved.GetOriginalUrl())
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Ids: []string{id}})
+	require.NoError(t, err)
+
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// варианты принимаются при создании и проверяются так же, как в HTTP API
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{
+		Url:          "https://split.example/",
+		Destinations: []*pb.Destination{{Url: "https://a.example/", Weight: 0}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{{
+		CorrelationId: "split",
+		OriginalUrl:   "https://split.example/",
+		Destinations:  []*pb.Destination{{Variant: "x", Url: "https://a.example/", Weight: 1}, {Variant: "x", Url: "https://b.example/", Weight: 1}},
+	}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{{
+		CorrelationId: "split",
+		OriginalUrl:   "https://split.example/",
+		Destinations:  []*pb.Destination{{Url: "https://a.example/", Weight: 1}},
+	}}})
+	require.NoError(t, err)
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{
+		Url:   "https://rules.example/",
+		Rules: []*pb.Rule{{Field: "device", Values: []string{"tablet"}, Url: "https://a.example/"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{
+		Url:   "https://rules.example/",
+		Rules: []*pb.Rule{{Field: "device", Values: []string{"ios"}, Url: "https://apps.apple.com/app/id1"}},
+	})
+	require.NoError(t, err)
+
+	// пакет больше лимита отклоняется целиком, как в HTTP API
+	items := make([]*pb.BatchItem, 0, 3)
+	for _, id := range []string{"b1", "b2", "b3"} {
+		items = append(items, &pb.BatchItem{CorrelationId: id, OriginalUrl: "https://" + id + ".example/"})
+	}
+	_, err = client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: items})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: "b1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
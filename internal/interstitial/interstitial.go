@@ -0,0 +1,28 @@
+package interstitial
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed page.html
+var page string
+
+var tmpl = template.Must(template.New("interstitial").Parse(page))
+
+// Page — данные страницы предпросмотра
+type Page struct {
+	ShortURL    string
+	Destination string
+}
+
+// Render отдаёт страницу предпросмотра с адресом назначения и кнопкой перехода
+func Render(w http.ResponseWriter, p Page) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// страница не должна кэшироваться, чтобы смена режима ссылки применялась сразу
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	return tmpl.Execute(w, p)
+}
@@ -0,0 +1,120 @@
+// Package limits ограничивает размер тел запросов
+package limits
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// Значения по умолчанию
+const (
+	DefaultMaxBodySize         = 1 << 20
+	DefaultMaxDecompressedSize = 8 << 20
+	DefaultMaxBatchItems       = 1000
+)
+
+// ErrTooLarge — тело запроса превышает лимит
+var ErrTooLarge = errors.New("request body too large")
+
+// Limits — ограничения тела запроса одного маршрута; 0 означает отсутствие ограничения
+type Limits struct {
+	// MaxBodySize — размер тела в том виде, в котором его передал клиент
+	MaxBodySize int64 `json:"max_body_size" yaml:"max_body_size"`
+	// MaxDecompressedSize — размер тела после распаковки Content-Encoding
+	MaxDecompressedSize int64 `json:"max_decompressed_size" yaml:"max_decompressed_size"`
+}
+
+// Config — ограничения по умолчанию и переопределения для отдельных маршрутов
+type Config struct {
+	Default Limits
+	// Routes — переопределения по шаблону пути chi, например /api/shorten/batch;
+	// незаданные (нулевые) поля берутся из Default
+	Routes map[string]Limits
+}
+
+// Defaults возвращает ограничения по умолчанию
+func Defaults() Config {
+	return Config{Default: Limits{MaxBodySize: DefaultMaxBodySize, MaxDecompressedSize: DefaultMaxDecompressedSize}}
+}
+
+// For возвращает ограничения маршрута
+func (c Config) For(route string) Limits {
+	l := c.Default
+	if override, ok := c.Routes[route]; ok {
+		if override.MaxBodySize != 0 {
+			l.MaxBodySize = override.MaxBodySize
+		}
+		if override.MaxDecompressedSize != 0 {
+			l.MaxDecompressedSize = override.MaxDecompressedSize
+		}
+	}
+
+	return l
+}
+
+type ctxKey struct{}
+
+// FromContext возвращает ограничения, установленные Middleware
+func FromContext(ctx context.Context) (Limits, bool) {
+	l, ok := ctx.Value(ctxKey{}).(Limits)
+	return l, ok
+}
+
+// Middleware читает тело запроса не больше MaxBodySize байт, отвечая 413 на превышение,
+// и передаёт ограничения дальше через контекст для распаковки тела
+func (l Limits) Middleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l.MaxBodySize > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > l.MaxBodySize {
+				tooLarge(w, r.ContentLength, l.MaxBodySize)
+				return
+			}
+
+			body, err := ReadAll(r.Body, l.MaxBodySize)
+			r.Body.Close()
+			if errors.Is(err, ErrTooLarge) {
+				tooLarge(w, -1, l.MaxBodySize)
+				return
+			}
+			if err != nil {
+				logger.Log.Info("can't read body", zap.Error(err))
+				http.Error(w, "can't read body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, l)))
+	}
+}
+
+// ReadAll читает r целиком, но не больше limit байт; при превышении возвращает ErrTooLarge.
+// limit 0 и меньше снимает ограничение.
+func ReadAll(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+func tooLarge(w http.ResponseWriter, size, limit int64) {
+	logger.Log.Info("request body too large", zap.Int64("size", size), zap.Int64("limit", limit))
+	http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+}
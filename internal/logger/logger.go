@@ -5,11 +5,42 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-var sugar zap.SugaredLogger
 var Log *zap.Logger = zap.NewNop()
 
+// level — текущий уровень логирования, его можно менять без перезапуска
+var level = zap.NewAtomicLevel()
+
+// Initialize инициализирует синглтон логера с необходимым уровнем логирования
+func Initialize(lvl string) error {
+	if err := SetLevel(lvl); err != nil {
+		return err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = level
+	zl, err := cfg.Build()
+	if err != nil {
+		return err
+	}
+
+	Log = zl
+	return nil
+}
+
+// SetLevel атомарно меняет уровень логирования
+func SetLevel(lvl string) error {
+	parsed, err := zapcore.ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+
+	level.SetLevel(parsed)
+	return nil
+}
+
 type (
 	// берём структуру для хранения сведений об ответе
 	responseData struct {
@@ -38,19 +69,10 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 }
 
 // WithLogging добавляет дополнительный код для регистрации сведений о запросе
-// и возвращает новый http.Handler.
+// и возвращает новый http.Handler. Сведения пишутся общим логером Log,
+// поэтому к ним сразу применяется уровень, заданный SetLevel.
 func WithLogging(h http.Handler) http.HandlerFunc {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
-		logger, err := zap.NewDevelopment()
-		if err != nil {
-			// вызываем панику, если ошибка
-			panic(err)
-		}
-		defer logger.Sync()
-
-		// делаем регистратор SugaredLogger
-		sugar = *logger.Sugar()
-
 		start := time.Now()
 
 		responseData := &responseData{
@@ -65,12 +87,12 @@ func WithLogging(h http.Handler) http.HandlerFunc {
 
 		duration := time.Since(start)
 
-		sugar.Infoln(
-			"uri", r.RequestURI,
-			"method", r.Method,
-			"status", responseData.status, // получаем перехваченный код статуса ответа
-			"duration", duration,
-			"size", responseData.size, // получаем перехваченный размер ответа
+		Log.Info("request",
+			zap.String("uri", r.RequestURI),
+			zap.String("method", r.Method),
+			zap.Int("status", responseData.status), // получаем перехваченный код статуса ответа
+			zap.Duration("duration", duration),
+			zap.Int("size", responseData.size), // получаем перехваченный размер ответа
 		)
 	}
 	return logFn
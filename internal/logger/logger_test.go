@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithLoggingFollowsLevel(t *testing.T) {
+	core, logs := observer.New(level)
+	prev := Log
+	Log = zap.New(core)
+	defer func() {
+		Log = prev
+		level.SetLevel(zap.InfoLevel)
+	}()
+
+	h := WithLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("tea"))
+	}))
+
+	tests := []struct {
+		level string
+		want  int
+	}{
+		{level: "info", want: 1},
+		{level: "warn", want: 0},
+		{level: "debug", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			require.NoError(t, SetLevel(tt.level))
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+			entries := logs.TakeAll()
+			require.Len(t, entries, tt.want)
+			if tt.want > 0 {
+				fields := entries[0].ContextMap()
+				assert.Equal(t, "/abc", fields["uri"])
+				assert.Equal(t, int64(http.StatusTeapot), fields["status"])
+				assert.Equal(t, int64(3), fields["size"])
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// document содержит спецификацию API в формате OpenAPI 3
+//
+//go:embed openapi.json
+var document []byte
+
+// Spec описывает ту часть спецификации OpenAPI, которая нужна для валидации запросов
+type Spec struct {
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// Operation описывает одну операцию (метод + путь) спецификации
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// RequestBody описывает тело запроса операции
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType описывает схему тела запроса для конкретного Content-Type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema — поддерживаемое подмножество JSON Schema
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	Minimum              *float64           `json:"minimum"`
+	Enum                 []string           `json:"enum"`
+}
+
+// Document возвращает исходный текст спецификации
+func Document() []byte {
+	return document
+}
+
+// Load разбирает встроенную спецификацию
+func Load() (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+// Operation возвращает операцию по методу и шаблону пути в нотации chi (/{id})
+func (s *Spec) Operation(method, path string) (Operation, bool) {
+	methods, ok := s.Paths[path]
+	if !ok {
+		return Operation{}, false
+	}
+
+	op, ok := methods[strings.ToLower(method)]
+	return op, ok
+}
+
+// resolve разворачивает ссылку вида #/components/schemas/Name
+func (s *Spec) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		schema = s.Components.Schemas[name]
+	}
+
+	return schema
+}
+
+// Handler отдаёт спецификацию клиенту
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(document)
+	}
+}
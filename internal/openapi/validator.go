@@ -0,0 +1,199 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/logger"
+)
+
+// Validator проверяет тела входящих запросов на соответствие спецификации
+type Validator struct {
+	spec *Spec
+}
+
+// NewValidator возвращает валидатор, построенный по встроенной спецификации
+func NewValidator() (*Validator, error) {
+	spec, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{spec: spec}, nil
+}
+
+// Middleware проверяет тело запроса по схеме операции, найденной по шаблону маршрута chi.
+// Запросы, не прошедшие проверку, отклоняются с кодом 400.
+func (v *Validator) Middleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op, ok := v.spec.Operation(r.Method, chi.RouteContext(r.Context()).RoutePattern())
+		if !ok || op.RequestBody == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Info("can't read body", zap.Error(err))
+			http.Error(w, "can't read body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err = v.validateBody(op.RequestBody, r.Header.Get("Content-Type"), body); err != nil {
+			logger.Log.Info("request doesn't match openapi schema", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+func (v *Validator) validateBody(rb *RequestBody, contentType string, body []byte) error {
+	if len(body) == 0 {
+		if rb.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+
+	mediaType, media, ok := selectMediaType(rb, contentType)
+	if !ok {
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	schema := v.spec.resolve(media.Schema)
+	if schema == nil {
+		return nil
+	}
+
+	if mediaType != "application/json" {
+		return v.validate(schema, string(body), "body")
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return v.validate(schema, value, "body")
+}
+
+// selectMediaType выбирает описание тела по Content-Type запроса.
+// Если заголовок не передан или не описан, а вариант в спецификации один, используется он.
+func selectMediaType(rb *RequestBody, contentType string) (string, MediaType, bool) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if media, ok := rb.Content[mediaType]; ok {
+			return mediaType, media, true
+		}
+	}
+
+	if len(rb.Content) == 1 {
+		for mediaType, media := range rb.Content {
+			return mediaType, media, true
+		}
+	}
+
+	return "", MediaType{}, false
+}
+
+func (v *Validator) validate(schema *Schema, value interface{}, path string) error {
+	schema = v.spec.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an object", path)
+		}
+
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					return fmt.Errorf("%s: unknown field %q", path, name)
+				}
+				continue
+			}
+			if err := v.validate(prop, obj[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an array", path)
+		}
+
+		if schema.MinItems != nil && len(arr) < *schema.MinItems {
+			return fmt.Errorf("%s: must contain at least %d items", path, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(arr) > *schema.MaxItems {
+			return fmt.Errorf("%s: must contain at most %d items", path, *schema.MaxItems)
+		}
+
+		for i, item := range arr {
+			if err := v.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+
+		n, err := num.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+
+		if schema.Minimum != nil && float64(n) < *schema.Minimum {
+			return fmt.Errorf("%s: must be at least %v", path, *schema.Minimum)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", path)
+		}
+
+		if schema.MinLength != nil && len(str) < *schema.MinLength {
+			return fmt.Errorf("%s: must be at least %d characters long", path, *schema.MinLength)
+		}
+
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, str) {
+			return fmt.Errorf("%s: must be one of %s", path, strings.Join(schema.Enum, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	// DefaultSize — размер стороны изображения по умолчанию в пикселях
+	DefaultSize = 256
+	MinSize     = 64
+	MaxSize     = 2048
+
+	// DefaultLevel — уровень коррекции ошибок по умолчанию (M, ~15% восстанавливаемых данных)
+	DefaultLevel = qrcode.Medium
+)
+
+var (
+	// ErrUnknownFormat указывает на неподдерживаемый формат изображения
+	ErrUnknownFormat = errors.New("unknown qr format")
+	// ErrInvalidSize указывает на размер вне допустимого диапазона
+	ErrInvalidSize = fmt.Errorf("qr size must be between %d and %d", MinSize, MaxSize)
+	// ErrUnknownLevel указывает на неизвестный уровень коррекции ошибок
+	ErrUnknownLevel = errors.New("unknown qr error correction level, must be one of L, M, Q, H")
+)
+
+// Level — уровень коррекции ошибок QR-кода
+type Level = qrcode.RecoveryLevel
+
+// ParseLevel разбирает уровень коррекции ошибок в нотации стандарта: L, M, Q или H
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qrcode.Low, nil
+	case "", "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+
+	return 0, ErrUnknownLevel
+}
+
+// Encode кодирует content в QR-код заданного формата и размера.
+// Возвращает изображение и его Content-Type.
+func Encode(content string, level Level, format string, size int) ([]byte, string, error) {
+	if size < MinSize || size > MaxSize {
+		return nil, "", ErrInvalidSize
+	}
+
+	q, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case "", FormatPNG:
+		png, err := q.PNG(size)
+		if err != nil {
+			return nil, "", err
+		}
+		return png, "image/png", nil
+	case FormatSVG:
+		return svg(q.Bitmap(), size), "image/svg+xml", nil
+	}
+
+	return nil, "", ErrUnknownFormat
+}
+
+// svg рисует матрицу модулей в виде SVG: каждая строка тёмных модулей объединяется в один path
+func svg(bitmap [][]bool, size int) []byte {
+	n := len(bitmap)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
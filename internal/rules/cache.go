@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"sync"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// DefaultCacheSize — сколько ссылок с правилами держит кэш по умолчанию
+const DefaultCacheSize = 10000
+
+// Key — редакция ссылки; после изменения ссылки её правила компилируются заново
+type Key struct {
+	Namespace string
+	ID        string
+	Version   int64
+}
+
+// Cache хранит скомпилированные правила ссылок, чтобы переход только проверял их.
+// Безопасен для одновременного использования.
+type Cache struct {
+	mu      sync.RWMutex
+	size    int
+	engines map[Key]cached
+}
+
+type cached struct {
+	engine *Engine
+	err    error
+}
+
+// NewCache возвращает кэш не больше чем на size ссылок
+func NewCache(size int) *Cache {
+	return &Cache{size: size, engines: make(map[Key]cached)}
+}
+
+// Engine возвращает скомпилированные правила rules редакции key, компилируя их при первом обращении
+func (c *Cache) Engine(key Key, rules []store.Rule, countries Countries) (*Engine, error) {
+	c.mu.RLock()
+	e, ok := c.engines[key]
+	c.mu.RUnlock()
+	if ok {
+		return e.engine, e.err
+	}
+
+	e.engine, e.err = Compile(rules, countries)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.engines) >= c.size {
+		// редакции не устаревают сами, поэтому при переполнении вытесняется произвольная
+		for k := range c.engines {
+			delete(c.engines, k)
+			break
+		}
+	}
+	c.engines[key] = e
+
+	return e.engine, e.err
+}
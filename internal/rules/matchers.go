@@ -0,0 +1,215 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Matcher проверяет, совпадает ли запрос с условием правила
+type Matcher interface {
+	Match(req Request) bool
+}
+
+// Устройства, которые различает FieldDevice
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceMobile  = "mobile"
+	DeviceDesktop = "desktop"
+)
+
+// languageTag — допустимое значение правила по языку, например ru или pt-BR
+var languageTag = regexp.MustCompile(`^[A-Za-z]{1,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// countryCode — двухбуквенный код страны
+var countryCode = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// NewMatcher возвращает условие на признак field со значениями values
+func NewMatcher(field string, values []string, countries Countries) (Matcher, error) {
+	switch field {
+	case FieldLanguage:
+		m := make(languageMatcher, 0, len(values))
+		for _, v := range values {
+			if !languageTag.MatchString(v) {
+				return nil, fmt.Errorf("%w: %q is not a language tag", ErrInvalidRule, v)
+			}
+			m = append(m, strings.ToLower(v))
+		}
+		return m, nil
+	case FieldDevice:
+		m := make(deviceMatcher, 0, len(values))
+		for _, v := range values {
+			v = strings.ToLower(v)
+			if !slices.Contains([]string{DeviceIOS, DeviceAndroid, DeviceMobile, DeviceDesktop}, v) {
+				return nil, fmt.Errorf("%w: device must be ios, android, mobile or desktop, got %q", ErrInvalidRule, v)
+			}
+			m = append(m, v)
+		}
+		return m, nil
+	case FieldCIDR:
+		m := make(cidrMatcher, 0, len(values))
+		for _, v := range values {
+			prefix, err := parsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not an IP network", ErrInvalidRule, v)
+			}
+			m = append(m, prefix)
+		}
+		return m, nil
+	case FieldCountry:
+		m := countryMatcher{countries: countries, codes: make([]string, 0, len(values))}
+		for _, v := range values {
+			if !countryCode.MatchString(v) {
+				return nil, fmt.Errorf("%w: %q is not a two-letter country code", ErrInvalidRule, v)
+			}
+			m.codes = append(m.codes, strings.ToUpper(v))
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("%w: field must be language, device, cidr or country, got %q", ErrInvalidRule, field)
+}
+
+// languageMatcher совпадает, если предпочтительный язык клиента равен значению или уточняет его
+type languageMatcher []string
+
+func (m languageMatcher) Match(req Request) bool {
+	lang := PreferredLanguage(req.AcceptLanguage)
+	if lang == "" {
+		return false
+	}
+
+	for _, v := range m {
+		if lang == v || strings.HasPrefix(lang, v+"-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PreferredLanguage возвращает язык с наибольшим весом q из заголовка Accept-Language
+// в нижнем регистре; при равных весах выигрывает указанный раньше
+func PreferredLanguage(header string) string {
+	var (
+		best  string
+		bestQ = 0.0
+	)
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name != "q" {
+				continue
+			}
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				q = 0
+			}
+		}
+
+		// q=0 означает, что язык клиенту не подходит
+		if q > bestQ {
+			best, bestQ = strings.ToLower(tag), q
+		}
+	}
+
+	return best
+}
+
+// deviceMatcher совпадает, если устройство клиента — одно из значений
+type deviceMatcher []string
+
+func (m deviceMatcher) Match(req Request) bool {
+	devices := Devices(req.UserAgent)
+	for _, v := range m {
+		if slices.Contains(devices, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Devices возвращает устройства, к которым относится User-Agent: iPhone — это ios и mobile,
+// компьютер — desktop. Пустой User-Agent не относится ни к одному устройству.
+func Devices(userAgent string) []string {
+	if userAgent == "" {
+		return nil
+	}
+
+	var devices []string
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		devices = append(devices, DeviceIOS, DeviceMobile)
+	case strings.Contains(userAgent, "Android"):
+		devices = append(devices, DeviceAndroid, DeviceMobile)
+	case strings.Contains(userAgent, "Mobile"):
+		devices = append(devices, DeviceMobile)
+	default:
+		devices = append(devices, DeviceDesktop)
+	}
+
+	return devices
+}
+
+// cidrMatcher совпадает, если адрес клиента входит в одну из сетей
+type cidrMatcher []netip.Prefix
+
+func (m cidrMatcher) Match(req Request) bool {
+	if !req.Addr.IsValid() {
+		return false
+	}
+
+	for _, prefix := range m {
+		if prefix.Contains(req.Addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsePrefix разбирает сеть в нотации CIDR; одиночный адрес считается сетью из одного адреса
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return prefix.Masked(), nil
+}
+
+// countryMatcher совпадает, если страна клиента — одна из codes
+type countryMatcher struct {
+	countries Countries
+	codes     []string
+}
+
+func (m countryMatcher) Match(req Request) bool {
+	if m.countries == nil || !req.Addr.IsValid() {
+		return false
+	}
+
+	country := m.countries.Country(req.Addr)
+	return country != "" && slices.Contains(m.codes, country)
+}
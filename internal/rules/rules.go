@@ -0,0 +1,112 @@
+// Package rules выбирает адрес перехода по правилам ссылки: язык браузера, тип устройства,
+// сеть или страна клиента. Правила проверяются по порядку, срабатывает первое совпавшее;
+// если не совпало ни одно, ссылка ведёт на свой обычный адрес.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Признаки запроса, которые проверяют правила
+const (
+	// FieldLanguage — предпочтительный язык из Accept-Language, значение совпадает с языком
+	// и всеми его уточнениями: ru совпадает с ru-RU
+	FieldLanguage = "language"
+	// FieldDevice — устройство по User-Agent: ios, android, mobile или desktop
+	FieldDevice = "device"
+	// FieldCIDR — адрес клиента входит в одну из сетей, например 10.0.0.0/8 или 2001:db8::/32
+	FieldCIDR = "cidr"
+	// FieldCountry — страна клиента по базе GeoIP, двухбуквенный код ISO 3166-1
+	FieldCountry = "country"
+)
+
+const (
+	// maxRules — наибольшее число правил одной ссылки
+	maxRules = 20
+	// maxValues — наибольшее число значений одного правила
+	maxValues = 100
+)
+
+// ErrInvalidRule указывает на неверное правило перенаправления
+var ErrInvalidRule = errors.New("invalid redirect rule")
+
+// Request — признаки запроса, по которым проверяются правила
+type Request struct {
+	AcceptLanguage string
+	UserAgent      string
+	// Addr — адрес клиента, нулевой, если его не удалось определить
+	Addr netip.Addr
+}
+
+// FromHTTP собирает признаки запроса r
+func FromHTTP(r *http.Request) Request {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+
+	return Request{
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		UserAgent:      r.UserAgent(),
+		Addr:           addr.Unmap(),
+	}
+}
+
+// Countries определяет страну клиента по адресу; пустая строка — страна неизвестна
+type Countries interface {
+	Country(addr netip.Addr) string
+}
+
+// Engine — правила ссылки, готовые к проверке
+type Engine struct {
+	rules []rule
+}
+
+type rule struct {
+	matcher Matcher
+	url     string
+}
+
+// Compile проверяет правила и готовит их к проверке. Без базы стран countries
+// правила по стране не совпадают ни с одним запросом.
+func Compile(rules []store.Rule, countries Countries) (*Engine, error) {
+	if len(rules) > maxRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidRule, maxRules)
+	}
+
+	e := &Engine{rules: make([]rule, 0, len(rules))}
+	for i, r := range rules {
+		if r.URL == "" {
+			return nil, fmt.Errorf("%w: rule %d has no url", ErrInvalidRule, i+1)
+		}
+		if len(r.Values) == 0 || len(r.Values) > maxValues {
+			return nil, fmt.Errorf("%w: rule %d must have 1-%d values", ErrInvalidRule, i+1, maxValues)
+		}
+
+		matcher, err := NewMatcher(r.Field, r.Values, countries)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		e.rules = append(e.rules, rule{matcher: matcher, url: r.URL})
+	}
+
+	return e, nil
+}
+
+// Match возвращает адрес первого правила, совпавшего с запросом req
+func (e *Engine) Match(req Request) (string, bool) {
+	for _, r := range e.rules {
+		if r.matcher.Match(req) {
+			return r.url, true
+		}
+	}
+
+	return "", false
+}
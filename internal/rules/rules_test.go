@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+)
+
+// countries — база стран для тестов
+type countries map[netip.Addr]string
+
+func (c countries) Country(addr netip.Addr) string {
+	return c[addr]
+}
+
+func TestMatchers(t *testing.T) {
+	db := countries{netip.MustParseAddr("5.255.255.5"): "RU"}
+
+	tests := []struct {
+		name   string
+		field  string
+		values []string
+		req    Request
+		want   bool
+	}{
+		{name: "language prefix", field: FieldLanguage, values: []string{"ru"}, req: Request{AcceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8"}, want: true},
+		{name: "language is case insensitive", field: FieldLanguage, values: []string{"PT-br"}, req: Request{AcceptLanguage: "pt-BR"}, want: true},
+		{name: "language uses preferred tag", field: FieldLanguage, values: []string{"ru"}, req: Request{AcceptLanguage: "en;q=0.5, ru;q=0.4"}, want: false},
+		{name: "language respects weights", field: FieldLanguage, values: []string{"ru"}, req: Request{AcceptLanguage: "en;q=0.5, ru"}, want: true},
+		{name: "language matches tag boundary", field: FieldLanguage, values: []string{"ru"}, req: Request{AcceptLanguage: "rue"}, want: false},
+		{name: "language missing", field: FieldLanguage, values: []string{"ru"}, req: Request{}, want: false},
+		{name: "ios", field: FieldDevice, values: []string{"ios"}, req: Request{UserAgent: iPhoneUA}, want: true},
+		{name: "android is mobile", field: FieldDevice, values: []string{"mobile"}, req: Request{UserAgent: androidUA}, want: true},
+		{name: "android is not ios", field: FieldDevice, values: []string{"ios"}, req: Request{UserAgent: androidUA}, want: false},
+		{name: "desktop", field: FieldDevice, values: []string{"ios", "desktop"}, req: Request{UserAgent: desktopUA}, want: true},
+		{name: "empty user agent", field: FieldDevice, values: []string{"desktop"}, req: Request{}, want: false},
+		{name: "cidr", field: FieldCIDR, values: []string{"192.168.0.0/16", "10.0.0.0/8"}, req: Request{Addr: netip.MustParseAddr("10.1.2.3")}, want: true},
+		{name: "cidr single address", field: FieldCIDR, values: []string{"2001:db8::1"}, req: Request{Addr: netip.MustParseAddr("2001:db8::1")}, want: true},
+		{name: "cidr miss", field: FieldCIDR, values: []string{"10.0.0.0/8"}, req: Request{Addr: netip.MustParseAddr("11.0.0.1")}, want: false},
+		{name: "cidr unknown address", field: FieldCIDR, values: []string{"0.0.0.0/0"}, req: Request{}, want: false},
+		{name: "country", field: FieldCountry, values: []string{"by", "ru"}, req: Request{Addr: netip.MustParseAddr("5.255.255.5")}, want: true},
+		{name: "country unknown", field: FieldCountry, values: []string{"RU"}, req: Request{Addr: netip.MustParseAddr("1.1.1.1")}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.field, tt.values, db)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m.Match(tt.req))
+		})
+	}
+
+	// без базы стран правило по стране не совпадает
+	m, err := NewMatcher(FieldCountry, []string{"RU"}, nil)
+	require.NoError(t, err)
+	assert.False(t, m.Match(Request{Addr: netip.MustParseAddr("5.255.255.5")}))
+}
+
+func TestNewMatcherErrors(t *testing.T) {
+	tests := []struct {
+		field  string
+		values []string
+	}{
+		{field: "referer", values: []string{"x"}},
+		{field: FieldLanguage, values: []string{"ru_RU"}},
+		{field: FieldDevice, values: []string{"tablet"}},
+		{field: FieldCIDR, values: []string{"10.0.0.0/33"}},
+		{field: FieldCountry, values: []string{"RUS"}},
+	}
+	for _, tt := range tests {
+		_, err := NewMatcher(tt.field, tt.values, nil)
+		assert.ErrorIs(t, err, ErrInvalidRule, tt.field)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	e, err := Compile([]store.Rule{
+		{Field: FieldCIDR, Values: []string{"10.0.0.0/8"}, URL: "https://intranet.example/"},
+		{Field: FieldDevice, Values: []string{"ios"}, URL: "https://apps.apple.com/app/id1"},
+		{Field: FieldLanguage, Values: []string{"ru"}, URL: "https://example.ru/"},
+	}, nil)
+	require.NoError(t, err)
+
+	// правила проверяются по порядку, срабатывает первое совпавшее
+	url, ok := e.Match(Request{AcceptLanguage: "ru", UserAgent: iPhoneUA, Addr: netip.MustParseAddr("10.0.0.1")})
+	assert.True(t, ok)
+	assert.Equal(t, "https://intranet.example/", url)
+
+	url, ok = e.Match(Request{AcceptLanguage: "ru", UserAgent: iPhoneUA})
+	assert.True(t, ok)
+	assert.Equal(t, "https://apps.apple.com/app/id1", url)
+
+	_, ok = e.Match(Request{AcceptLanguage: "en", UserAgent: desktopUA})
+	assert.False(t, ok)
+
+	_, err = Compile([]store.Rule{{Field: FieldLanguage, Values: []string{"ru"}}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	_, err = Compile([]store.Rule{{Field: FieldLanguage, URL: "https://example.ru/"}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestFromHTTP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	r.RemoteAddr = "[::ffff:10.0.0.1]:5555"
+	r.Header.Set("Accept-Language", "ru")
+	r.Header.Set("User-Agent", iPhoneUA)
+
+	req := FromHTTP(r)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), req.Addr)
+	assert.Equal(t, "ru", req.AcceptLanguage)
+	assert.Equal(t, iPhoneUA, req.UserAgent)
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(1)
+	first := []store.Rule{{Field: FieldLanguage, Values: []string{"ru"}, URL: "https://example.ru/"}}
+	key := Key{ID: "abc", Version: 1}
+
+	e, err := c.Engine(key, first, nil)
+	require.NoError(t, err)
+	// та же редакция берётся из кэша без повторной компиляции
+	cached, err := c.Engine(key, nil, nil)
+	require.NoError(t, err)
+	assert.Same(t, e, cached)
+
+	// новая редакция компилируется заново и вытесняет старую
+	second := []store.Rule{{Field: FieldLanguage, Values: []string{"en"}, URL: "https://example.com/"}}
+	e, err = c.Engine(Key{ID: "abc", Version: 2}, second, nil)
+	require.NoError(t, err)
+	url, ok := e.Match(Request{AcceptLanguage: "en"})
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/", url)
+	assert.Len(t, c.engines, 1)
+
+	_, err = c.Engine(Key{ID: "bad", Version: 1}, []store.Rule{{Field: "referer", Values: []string{"x"}, URL: "https://x/"}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
@@ -2,8 +2,6 @@ package saver
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"io"
 	"os"
 
@@ -21,24 +19,6 @@ type Consumer struct {
 	decoder *json.Decoder
 }
 
-var Events = []*models.Event{
-	{
-		UUID:        "1",
-		ShortURL:    "4rSPg8ap",
-		OriginalURL: "http://yandex.ru",
-	},
-	{
-		UUID:        "2",
-		ShortURL:    "edVPg3ks",
-		OriginalURL: "http://ya.ru",
-	},
-	{
-		UUID:        "3",
-		ShortURL:    "dG56Hqxm",
-		OriginalURL: "http://practicum.yandex.ru",
-	},
-}
-
 func NewProducer(fileName string) (*Producer, error) {
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
@@ -55,6 +35,11 @@ func (p *Producer) WriteEvent(event *models.Event) error {
 	return p.encoder.Encode(&event)
 }
 
+// Write дописывает в файл произвольную запись в формате JSON
+func (p *Producer) Write(v any) error {
+	return p.encoder.Encode(v)
+}
+
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
@@ -80,34 +65,11 @@ func (c *Consumer) ReadEvent() (*models.Event, error) {
 	return event, nil
 }
 
-func (c *Consumer) Close() error {
-	return c.file.Close()
+// Read читает из файла следующую запись в v
+func (c *Consumer) Read(v any) error {
+	return c.decoder.Decode(v)
 }
 
-func SaveFile(fileName string) error {
-	Producer, err := NewProducer(fileName)
-	if err != nil {
-		return errors.New("can't open file")
-	}
-	defer Producer.Close()
-
-	Consumer, err := NewConsumer(fileName)
-	if err != nil {
-		return errors.New("can't open file")
-	}
-	defer Consumer.Close()
-
-	for _, event := range Events {
-		if err := Producer.WriteEvent(event); err != nil {
-			return errors.New("can't write event")
-		}
-
-		readEvent, err := Consumer.ReadEvent()
-		if err != nil {
-			return errors.New("can't read file")
-		}
-
-		fmt.Println(readEvent)
-	}
-	return nil
+func (c *Consumer) Close() error {
+	return c.file.Close()
 }
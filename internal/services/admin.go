@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// ErrInvalidCursor указывает на повреждённый курсор страницы поиска
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SearchURLs возвращает страницу ссылок по фильтру и курсор следующей страницы
+func SearchURLs(ctx context.Context, registry *domains.Registry, storage store.Store, filter store.URLFilter) (models.AdminURLPage, error) {
+	limit := filter.Limit
+	// запрашиваем на одну ссылку больше, чтобы узнать, есть ли следующая страница
+	filter.Limit++
+
+	urls, err := storage.SearchURLs(ctx, filter)
+	if err != nil {
+		return models.AdminURLPage{}, err
+	}
+
+	page := models.AdminURLPage{URLs: make([]models.AdminURL, 0, min(len(urls), limit))}
+	if len(urls) > limit {
+		urls = urls[:limit]
+		last := urls[len(urls)-1]
+		page.NextCursor = EncodeCursor(store.URLRef{Namespace: last.Namespace, ID: last.GeneratedID})
+	}
+
+	for _, url := range urls {
+		page.URLs = append(page.URLs, models.AdminURL{
+			Namespace:   url.Namespace,
+			ID:          url.GeneratedID,
+			ShortURL:    registry.Namespace(url.Namespace).ShortURL(url.GeneratedID),
+			OriginalURL: url.OriginalURL,
+			UserID:      url.UserID,
+			Deleted:     url.DeletedFlag,
+			Disabled:    url.Disabled,
+		})
+	}
+
+	return page, nil
+}
+
+// EncodeCursor кодирует последнюю ссылку страницы в курсор
+func EncodeCursor(ref store.URLRef) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(ref.Namespace + "\x00" + ref.ID))
+}
+
+// DecodeCursor разбирает курсор, пустой курсор означает первую страницу
+func DecodeCursor(cursor string) (store.URLRef, error) {
+	if cursor == "" {
+		return store.URLRef{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return store.URLRef{}, ErrInvalidCursor
+	}
+	namespace, id, ok := strings.Cut(string(b), "\x00")
+	if !ok || id == "" {
+		return store.URLRef{}, ErrInvalidCursor
+	}
+
+	return store.URLRef{Namespace: namespace, ID: id}, nil
+}
+
+// SetDisabled отключает или включает ссылки; reason попадает в журнал аудита.
+// Возвращает найденные и ненайденные ссылки.
+func SetDisabled(ctx context.Context, storage store.Store, links []models.LinkRef, disabled bool, reason string) ([]models.LinkRef, []models.LinkRef, error) {
+	refs := make([]store.URLRef, 0, len(links))
+	for _, link := range links {
+		refs = append(refs, store.URLRef{Namespace: link.Namespace, ID: link.ID})
+	}
+
+	found, err := storage.SetDisabled(audit.WithReason(ctx, reason), refs, disabled)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isFound := make(map[store.URLRef]bool, len(found))
+	for _, ref := range found {
+		isFound[ref] = true
+	}
+
+	foundLinks := make([]models.LinkRef, 0, len(found))
+	notFound := make([]models.LinkRef, 0)
+	for _, link := range links {
+		if isFound[store.URLRef{Namespace: link.Namespace, ID: link.ID}] {
+			foundLinks = append(foundLinks, link)
+		} else {
+			notFound = append(notFound, link)
+		}
+	}
+
+	return foundLinks, notFound, nil
+}
+
+// ReassignURL передаёт ссылку пользователю userID; reason попадает в журнал аудита
+func ReassignURL(ctx context.Context, storage store.Store, link models.LinkRef, userID, reason string) error {
+	ref := store.URLRef{Namespace: link.Namespace, ID: link.ID}
+
+	return storage.ReassignURL(audit.WithReason(ctx, reason), ref, userID)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+)
+
+// QueryAudit возвращает страницу журнала аудита и курсор следующей страницы
+func QueryAudit(ctx context.Context, log audit.Log, q audit.Query) (models.AdminAuditPage, error) {
+	limit := q.Limit
+	// запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	q.Limit++
+
+	events, err := log.Query(ctx, q)
+	if err != nil {
+		return models.AdminAuditPage{}, err
+	}
+
+	page := models.AdminAuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = strconv.FormatInt(page.Events[limit-1].ID, 10)
+	}
+	if page.Events == nil {
+		page.Events = []audit.Event{}
+	}
+
+	return page, nil
+}
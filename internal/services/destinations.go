@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// maxDestinations — наибольшее число вариантов одной ссылки
+const maxDestinations = 10
+
+// variantName — допустимое имя варианта: оно хранится в cookie клиента
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ErrInvalidDestinations указывает на неверный список вариантов ссылки
+var ErrInvalidDestinations = errors.New("invalid destinations")
+
+// NewDestinations проверяет варианты ссылки, пришедшие от клиента; безымянные варианты
+// получают имена a, b, c по своему месту в списке
+func NewDestinations(in []models.Destination) ([]store.Destination, error) {
+	if len(in) > maxDestinations {
+		return nil, fmt.Errorf("%w: at most %d destinations are allowed", ErrInvalidDestinations, maxDestinations)
+	}
+
+	destinations := make([]store.Destination, 0, len(in))
+	seen := make(map[string]bool, len(in))
+	for i, d := range in {
+		variant := d.Variant
+		if variant == "" {
+			variant = string(rune('a' + i))
+		}
+
+		switch {
+		case !variantName.MatchString(variant):
+			return nil, fmt.Errorf("%w: variant %q must be 1-32 letters, digits, - or _", ErrInvalidDestinations, variant)
+		case seen[variant]:
+			return nil, fmt.Errorf("%w: duplicate variant %q", ErrInvalidDestinations, variant)
+		case d.URL == "":
+			return nil, fmt.Errorf("%w: variant %q has no url", ErrInvalidDestinations, variant)
+		case d.Weight < 1:
+			return nil, fmt.Errorf("%w: variant %q must have a positive weight", ErrInvalidDestinations, variant)
+		}
+		seen[variant] = true
+
+		destinations = append(destinations, store.Destination{Variant: variant, URL: d.URL, Weight: d.Weight})
+	}
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	return destinations, nil
+}
+
+func toModelDestinations(destinations []store.Destination) []models.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	out := make([]models.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		out = append(out, models.Destination(d))
+	}
+
+	return out
+}
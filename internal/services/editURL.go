@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// AnyVersion — явный отказ клиента от проверки версии (If-Match: *):
+// изменение применяется к текущей редакции ссылки
+const AnyVersion int64 = -1
+
+var (
+	// ErrVersionRequired указывает на изменение без версии, которую прочитал клиент
+	ErrVersionRequired = errors.New("url version is required")
+	// ErrEmptyURL указывает на попытку заменить адрес назначения пустым
+	ErrEmptyURL = errors.New("url must not be empty")
+	// ErrInvalidExpiry указывает на срок действия не в формате RFC 3339
+	ErrInvalidExpiry = errors.New("expires_at must be an RFC 3339 time or empty")
+)
+
+// GetUserURL возвращает неудалённую ссылку id пользователя userID из пространства имён namespace,
+// в том числе отключённую или истёкшую; ErrNotFound — такой ссылки у пользователя нет
+func GetUserURL(ctx context.Context, storage store.Store, namespace, userID, id string) (store.URL, error) {
+	urls, err := storage.SearchURLs(ctx, store.URLFilter{
+		UserID: userID,
+		Refs:   []store.URLRef{{Namespace: namespace, ID: id}},
+		Limit:  1,
+	})
+	if err != nil {
+		return store.URL{}, err
+	}
+	if len(urls) == 0 || urls[0].DeletedFlag {
+		return store.URL{}, store.ErrNotFound
+	}
+
+	return urls[0], nil
+}
+
+// UpdateURL применяет к ссылке изменения patch, если её версия всё ещё равна version.
+// Без версии изменение отклоняется с ErrVersionRequired, проверку отключает только AnyVersion
+func UpdateURL(ctx context.Context, storage store.Store, namespace, userID, id string, version int64, patch models.URLPatch) (store.URL, error) {
+	if version < 1 && version != AnyVersion {
+		return store.URL{}, ErrVersionRequired
+	}
+
+	url, err := GetUserURL(ctx, storage, namespace, userID, id)
+	if err != nil {
+		return store.URL{}, err
+	}
+	if version != AnyVersion && version != url.Version {
+		return store.URL{}, store.ErrVersionMismatch
+	}
+
+	if patch.URL != nil {
+		if *patch.URL == "" {
+			return store.URL{}, ErrEmptyURL
+		}
+		url.OriginalURL = *patch.URL
+	}
+	if patch.RedirectMode != nil {
+		if url.RedirectMode, err = store.ParseRedirectMode(*patch.RedirectMode); err != nil {
+			return store.URL{}, err
+		}
+	}
+	if patch.QueryPassthrough != nil {
+		if url.QueryMode, err = store.ParseQueryMode(*patch.QueryPassthrough); err != nil {
+			return store.URL{}, err
+		}
+	}
+	if patch.Destinations != nil {
+		if url.Destinations, err = NewDestinations(*patch.Destinations); err != nil {
+			return store.URL{}, err
+		}
+	}
+	if patch.Rules != nil {
+		if url.Rules, err = NewRules(*patch.Rules); err != nil {
+			return store.URL{}, err
+		}
+	}
+	if patch.ExpiresAt != nil {
+		url.ExpiresAt = nil
+		if *patch.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, *patch.ExpiresAt)
+			if err != nil {
+				return store.URL{}, ErrInvalidExpiry
+			}
+			url.ExpiresAt = &expiresAt
+		}
+	}
+
+	// хранилище ещё раз сравнит версию: ссылку могли изменить после чтения,
+	// в том числе при AnyVersion — тогда с только что прочитанной
+	return storage.UpdateURL(ctx, url)
+}
+
+// NewURLDetails описывает ссылку владельцу
+func NewURLDetails(domain domains.Domain, url store.URL) models.URLDetails {
+	return models.URLDetails{
+		ID:               url.GeneratedID,
+		ShortURL:         domain.ShortURL(url.GeneratedID),
+		OriginalURL:      url.OriginalURL,
+		RedirectMode:     string(url.RedirectMode),
+		ExpiresAt:        url.ExpiresAt,
+		Disabled:         url.Disabled,
+		Version:          url.Version,
+		QueryPassthrough: string(url.QueryMode),
+		Destinations:     toModelDestinations(url.Destinations),
+		Rules:            toModelRules(url.Rules),
+	}
+}
+
+// URLHistory возвращает прежние редакции ссылки из журнала аудита, от старых к новым
+func URLHistory(ctx context.Context, log audit.Log, namespace, id string) ([]models.URLRevision, error) {
+	events, err := log.Query(ctx, audit.Query{Namespace: &namespace, URLID: id, Action: audit.ActionUpdate})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]models.URLRevision, 0, len(events))
+	for _, e := range events {
+		if e.Before == nil {
+			continue
+		}
+		revisions = append(revisions, models.URLRevision{
+			Version:          e.Before.Version,
+			OriginalURL:      e.Before.OriginalURL,
+			RedirectMode:     e.Before.RedirectMode,
+			ExpiresAt:        e.Before.ExpiresAt,
+			QueryPassthrough: e.Before.QueryPassthrough,
+			ReplacedAt:       e.Time,
+			ReplacedBy:       e.Actor,
+			Destinations:     fromAuditDestinations(e.Before.Destinations),
+			Rules:            fromAuditRules(e.Before.Rules),
+		})
+	}
+
+	return revisions, nil
+}
+
+func fromAuditDestinations(destinations []audit.Destination) []models.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	out := make([]models.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		out = append(out, models.Destination{Variant: d.Variant, URL: d.URL, Weight: d.Weight})
+	}
+
+	return out
+}
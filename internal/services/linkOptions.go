@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// ErrInvalidCacheMaxAge указывает на отрицательное время кэширования
+var ErrInvalidCacheMaxAge = errors.New("cache_max_age must not be negative")
+
+// LinkOptions — настройки ссылки, задаваемые клиентом при создании
+type LinkOptions struct {
+	RedirectMode store.RedirectMode
+	CacheMaxAge  *int
+	// QueryMode — перенос параметров перехода в адрес назначения
+	QueryMode store.QueryMode
+	// Destinations, если заданы, делят переходы между адресами с первого перехода
+	Destinations []store.Destination
+	// Rules, если заданы, проверяются до выбора адреса с первого перехода
+	Rules []store.Rule
+}
+
+// NewLinkOptions проверяет настройки ссылки, пришедшие от клиента
+func NewLinkOptions(redirectMode string, cacheMaxAge *int) (LinkOptions, error) {
+	mode, err := store.ParseRedirectMode(redirectMode)
+	if err != nil {
+		return LinkOptions{}, err
+	}
+
+	if cacheMaxAge != nil && *cacheMaxAge < 0 {
+		return LinkOptions{}, ErrInvalidCacheMaxAge
+	}
+
+	return LinkOptions{RedirectMode: mode, CacheMaxAge: cacheMaxAge}, nil
+}
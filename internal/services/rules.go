@@ -0,0 +1,53 @@
+package services
+
+import (
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/rules"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// NewRules проверяет правила перенаправления, пришедшие от клиента;
+// ошибки оборачивают rules.ErrInvalidRule
+func NewRules(in []models.Rule) ([]store.Rule, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+
+	out := make([]store.Rule, 0, len(in))
+	for _, r := range in {
+		out = append(out, store.Rule(r))
+	}
+	// база стран для проверки не нужна: коды стран проверяются по формату
+	if _, err := rules.Compile(out, nil); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func toModelRules(in []store.Rule) []models.Rule {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make([]models.Rule, 0, len(in))
+	for _, r := range in {
+		out = append(out, models.Rule(r))
+	}
+
+	return out
+}
+
+func fromAuditRules(in []audit.Rule) []models.Rule {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make([]models.Rule, 0, len(in))
+	for _, r := range in {
+		out = append(out, models.Rule(r))
+	}
+
+	return out
+}
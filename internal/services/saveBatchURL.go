@@ -4,30 +4,43 @@ import (
 	"context"
 
 	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/domains"
 	"github.com/Nastez/shortener/internal/logger"
 	"github.com/Nastez/shortener/internal/store"
 )
 
-func SaveBatchURL(ctx context.Context, requestBatch models.PayloadBatch, baseAddr string, storage store.Store) models.ResponseBodyBatch {
+// SaveBatchURL сохраняет пакет URL в пространстве имён домена. Варианты и правила элементов
+// проверяются до сохранения; ошибки оборачивают ErrInvalidDestinations или rules.ErrInvalidRule
+func SaveBatchURL(ctx context.Context, requestBatch models.PayloadBatch, domain domains.Domain, storage store.Store, userID string) (models.ResponseBodyBatch, error) {
 	var responseBatch models.ResponseBodyBatch
 
-	for _, request := range requestBatch {
+	for i, request := range requestBatch {
+		destinations, err := NewDestinations(request.Destinations)
+		if err != nil {
+			return nil, err
+		}
+		// хранилище получает варианты с уже присвоенными именами
+		requestBatch[i].Destinations = toModelDestinations(destinations)
+		if _, err = NewRules(request.Rules); err != nil {
+			return nil, err
+		}
+
 		var response = models.ResponseBatch{
 			CorrelationID: request.CorrelationID,
-			ShortURL:      baseAddr + "/" + request.CorrelationID,
+			ShortURL:      domain.ShortURL(request.CorrelationID),
 		}
 		responseBatch = append(responseBatch, response)
 	}
 
 	if len(responseBatch) > 0 {
-		err := storage.SaveBatch(ctx, requestBatch, responseBatch)
+		err := storage.SaveBatch(ctx, domain.Namespace, userID, requestBatch)
 		if err != nil {
 			logger.Log.Info("can't save batch in store")
-			return nil
+			return nil, err
 		}
 	} else {
 		logger.Log.Info("responseBatch is empty")
 	}
 
-	return responseBatch
+	return responseBatch, nil
 }
@@ -3,19 +3,32 @@ package services
 import (
 	"context"
 
+	"github.com/Nastez/shortener/internal/domains"
 	"github.com/Nastez/shortener/internal/store"
 	"github.com/Nastez/shortener/utils"
 )
 
-func SaveURL(ctx context.Context, baseAddr string, storage store.Store, originalURL string) (string, string, error) {
-	generatedID := utils.GenerateID()
-	shortURL := baseAddr + "/" + generatedID
+// SaveURL сохраняет URL в пространстве имён домена и возвращает его короткий URL;
+// при конфликте первым значением возвращается короткий URL уже существующей ссылки
+func SaveURL(ctx context.Context, domain domains.Domain, storage store.Store, originalURL string, userID string, opts LinkOptions) (string, string, error) {
+	generatedID := utils.GenerateIDLength(domain.IDLength)
 
-	oldShortURL, err := storage.Save(ctx, store.URL{
-		OriginalURL: originalURL,
-		ShortURL:    shortURL,
-		GeneratedID: generatedID,
+	oldID, err := storage.Save(ctx, store.URL{
+		Namespace:    domain.Namespace,
+		OriginalURL:  originalURL,
+		GeneratedID:  generatedID,
+		UserID:       userID,
+		RedirectMode: opts.RedirectMode,
+		CacheMaxAge:  opts.CacheMaxAge,
+		QueryMode:    opts.QueryMode,
+		Destinations: opts.Destinations,
+		Rules:        opts.Rules,
 	})
 
-	return oldShortURL, shortURL, err
+	var oldShortURL string
+	if oldID != "" {
+		oldShortURL = domain.ShortURL(oldID)
+	}
+
+	return oldShortURL, domain.ShortURL(generatedID), err
 }
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// GetUserURLs возвращает все URL, сокращённые пользователем на любом из доменов
+func GetUserURLs(ctx context.Context, registry *domains.Registry, storage store.Store, userID string) ([]models.UserURL, error) {
+	urls, err := storage.GetUserURLs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	userURLs := make([]models.UserURL, 0, len(urls))
+	for _, url := range urls {
+		userURLs = append(userURLs, models.UserURL{
+			ShortURL:    registry.Namespace(url.Namespace).ShortURL(url.GeneratedID),
+			OriginalURL: url.OriginalURL,
+		})
+	}
+
+	return userURLs, nil
+}
+
+// DeleteUserURLs помечает удалёнными URL пользователя с переданными идентификаторами
+// в пространстве имён namespace
+func DeleteUserURLs(ctx context.Context, storage store.Store, namespace, userID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return storage.DeleteURLs(ctx, namespace, userID, ids)
+}
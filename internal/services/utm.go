@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/Nastez/shortener/internal/domains"
+	"github.com/Nastez/shortener/internal/utm"
+)
+
+// ErrUnknownUTMTemplate указывает на шаблон UTM-меток, которого нет в конфигурации
+var ErrUnknownUTMTemplate = errors.New("unknown utm template")
+
+// ApplyUTMTemplate добавляет к адресу originalURL метки шаблона name. Пустое имя выбирает
+// шаблон utm.DefaultTemplate, если он настроен, а utm.NoTemplate оставляет адрес без меток.
+func ApplyUTMTemplate(originalURL, name string, templates map[string]string, domain domains.Domain) (string, error) {
+	switch name {
+	case utm.NoTemplate:
+		return originalURL, nil
+	case "":
+		name = utm.DefaultTemplate
+		if _, ok := templates[name]; !ok {
+			return originalURL, nil
+		}
+	}
+
+	template, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownUTMTemplate, name)
+	}
+
+	// в шаблон подставляется хост короткого домена без порта
+	host := domain.Host
+	if u, err := url.Parse(domain.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	return utm.Apply(originalURL, template, host), nil
+}
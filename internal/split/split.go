@@ -0,0 +1,78 @@
+// Package split распределяет переходы по ссылке между несколькими адресами назначения по весам.
+// Выбор закреплён за клиентом: сначала по варианту из cookie, затем по хешу клиента,
+// поэтому повторные переходы без cookie тоже попадают в тот же вариант.
+package split
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"net/http"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// CookiePrefix — префикс cookie с вариантом; имя cookie дополняется идентификатором ссылки
+const CookiePrefix = "shv_"
+
+// CookieMaxAge — сколько клиент остаётся в выбранном варианте, 30 дней
+const CookieMaxAge = 30 * 24 * 60 * 60
+
+// Choose возвращает вариант sticky, если он ещё есть среди destinations, иначе выбирает
+// вариант по весам детерминированно по clientKey. destinations не должен быть пустым.
+func Choose(destinations []store.Destination, sticky, clientKey string) store.Destination {
+	total := 0
+	for _, d := range destinations {
+		if sticky != "" && d.Variant == sticky {
+			return d
+		}
+		total += d.Weight
+	}
+	if total <= 0 {
+		return destinations[0]
+	}
+
+	sum := sha256.Sum256([]byte(clientKey))
+	point := binary.BigEndian.Uint64(sum[:8]) % uint64(total)
+	for _, d := range destinations {
+		if point < uint64(d.Weight) {
+			return d
+		}
+		point -= uint64(d.Weight)
+	}
+
+	return destinations[len(destinations)-1]
+}
+
+// ClientKey возвращает ключ клиента для ссылки id: адрес клиента и User-Agent.
+// Ссылка входит в ключ, чтобы варианты разных ссылок выбирались независимо.
+func ClientKey(r *http.Request, namespace, id string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return namespace + "\x00" + id + "\x00" + host + "\x00" + r.UserAgent()
+}
+
+// Sticky возвращает вариант ссылки id, запомненный клиенту
+func Sticky(r *http.Request, id string) string {
+	cookie, err := r.Cookie(CookiePrefix + id)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// Remember запоминает клиенту вариант ссылки id; cookie действует только для пути ссылки
+func Remember(w http.ResponseWriter, id, variant string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookiePrefix + id,
+		Value:    variant,
+		Path:     "/" + id,
+		MaxAge:   CookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
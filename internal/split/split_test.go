@@ -0,0 +1,60 @@
+package split
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+func TestChoose(t *testing.T) {
+	destinations := []store.Destination{
+		{Variant: "a", URL: "https://a.example/", Weight: 1},
+		{Variant: "b", URL: "https://b.example/", Weight: 3},
+	}
+
+	// вариант из cookie побеждает, пропавший вариант выбирается заново по весам
+	assert.Equal(t, "b", Choose(destinations, "b", "client").Variant)
+	assert.Equal(t, Choose(destinations, "", "client"), Choose(destinations, "gone", "client"))
+
+	// один и тот же клиент всегда попадает в один вариант
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, Choose(destinations, "", "client"), Choose(destinations, "", "client"))
+	}
+
+	// переходы делятся пропорционально весам
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[Choose(destinations, "", strconv.Itoa(i)).Variant]++
+	}
+	assert.InDelta(t, 1000, counts["a"], 150)
+	assert.InDelta(t, 3000, counts["b"], 150)
+
+	assert.Equal(t, "only", Choose([]store.Destination{{Variant: "only", Weight: 5}}, "", "client").Variant)
+}
+
+func TestStickyCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	Remember(w, "abc", "b")
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "/abc", cookies[0].Path)
+
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	assert.Empty(t, Sticky(r, "abc"))
+	r.AddCookie(cookies[0])
+	assert.Equal(t, "b", Sticky(r, "abc"))
+	assert.Empty(t, Sticky(r, "other"))
+
+	// ключ клиента не зависит от порта, но зависит от ссылки
+	r.RemoteAddr = "10.0.0.1:1234"
+	key := ClientKey(r, "", "abc")
+	r.RemoteAddr = "10.0.0.1:5678"
+	assert.Equal(t, key, ClientKey(r, "", "abc"))
+	assert.NotEqual(t, key, ClientKey(r, "", "other"))
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+func (m *MemoryStorage) SearchURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	refs := make(map[key]bool, len(filter.Refs))
+	for _, ref := range filter.Refs {
+		refs[key{namespace: ref.Namespace, id: ref.ID}] = true
+	}
+
+	var urls []store.URL
+	for k, u := range m.urls {
+		if len(refs) > 0 && !refs[k] {
+			continue
+		}
+		if k.namespace < filter.After.Namespace || k.namespace == filter.After.Namespace && k.id <= filter.After.ID {
+			continue
+		}
+		if filter.UserID != "" && u.UserID != filter.UserID {
+			continue
+		}
+		if filter.Disabled != nil && u.Disabled != *filter.Disabled {
+			continue
+		}
+		if filter.Host != "" && !strings.EqualFold(destinationHost(u.OriginalURL), filter.Host) {
+			continue
+		}
+		urls = append(urls, u)
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if urls[i].Namespace != urls[j].Namespace {
+			return urls[i].Namespace < urls[j].Namespace
+		}
+		return urls[i].GeneratedID < urls[j].GeneratedID
+	})
+	if filter.Limit > 0 && len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+	}
+
+	return urls, nil
+}
+
+func (m *MemoryStorage) SetDisabled(ctx context.Context, refs []store.URLRef, disabled bool) ([]store.URLRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found []store.URLRef
+	for _, ref := range refs {
+		k := key{namespace: ref.Namespace, id: ref.ID}
+		u, ok := m.urls[k]
+		if !ok {
+			continue
+		}
+		u.Disabled = disabled
+		m.urls[k] = u
+		found = append(found, ref)
+	}
+
+	return found, nil
+}
+
+func (m *MemoryStorage) ReassignURL(ctx context.Context, ref store.URLRef, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{namespace: ref.Namespace, id: ref.ID}
+	u, ok := m.urls[k]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.UserID = userID
+	m.urls[k] = u
+
+	return nil
+}
+
+func (f *FileStorage) SetDisabled(ctx context.Context, refs []store.URLRef, disabled bool) ([]store.URLRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	found, err := f.MemoryStorage.SetDisabled(ctx, refs, disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	return found, f.writeRefs(found)
+}
+
+func (f *FileStorage) ReassignURL(ctx context.Context, ref store.URLRef, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.MemoryStorage.ReassignURL(ctx, ref, userID); err != nil {
+		return err
+	}
+
+	return f.writeRefs([]store.URLRef{ref})
+}
+
+// writeRefs дописывает в журнал текущее состояние ссылок refs, вызывается под f.mu
+func (f *FileStorage) writeRefs(refs []store.URLRef) error {
+	f.MemoryStorage.mu.RLock()
+	defer f.MemoryStorage.mu.RUnlock()
+
+	for _, ref := range refs {
+		if err := f.write(f.urls[key{namespace: ref.Namespace, id: ref.ID}]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destinationHost возвращает хост адреса назначения или пустую строку
+func destinationHost(originalURL string) string {
+	u, err := url.Parse(originalURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/saver"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+func (m *MemoryStorage) SaveKey(ctx context.Context, key store.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.Scopes = slices.Clone(key.Scopes)
+	m.keys[key.ID] = key
+
+	return nil
+}
+
+func (m *MemoryStorage) GetKey(ctx context.Context, id string) (store.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return store.APIKey{}, store.ErrKeyNotFound
+	}
+	key.Scopes = slices.Clone(key.Scopes)
+
+	return key, nil
+}
+
+func (m *MemoryStorage) RevokeKey(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return store.ErrKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		m.keys[id] = key
+	}
+
+	return nil
+}
+
+func (m *MemoryStorage) ListKeys(ctx context.Context, userID string) ([]store.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []store.APIKey
+	for _, key := range m.keys {
+		if userID == "" || key.UserID == userID {
+			key.Scopes = slices.Clone(key.Scopes)
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b store.APIKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return keys, nil
+}
+
+// keysPath — журнал ключей API рядом с журналом ссылок
+func keysPath(path string) string {
+	return path + ".keys"
+}
+
+// loadKeys проигрывает журнал ключей: каждая запись — полное состояние ключа
+func (f *FileStorage) loadKeys(path string) error {
+	consumer, err := saver.NewConsumer(path)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for {
+		var event models.KeyEvent
+		err = consumer.Read(&event)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.keys[event.ID] = store.APIKey(event)
+	}
+}
+
+func (f *FileStorage) SaveKey(ctx context.Context, key store.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.MemoryStorage.SaveKey(ctx, key); err != nil {
+		return err
+	}
+
+	return f.keysProducer.Write(models.KeyEvent(key))
+}
+
+func (f *FileStorage) RevokeKey(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.MemoryStorage.RevokeKey(ctx, id); err != nil {
+		return err
+	}
+
+	key, err := f.MemoryStorage.GetKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return f.keysProducer.Write(models.KeyEvent(key))
+}
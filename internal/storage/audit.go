@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/saver"
+)
+
+// Record добавляет записи в журнал аудита и назначает им порядковые номера
+func (m *MemoryStorage) Record(ctx context.Context, events ...audit.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.appendAudit(events)
+
+	return nil
+}
+
+// appendAudit назначает записям номера и добавляет их в журнал, вызывается под m.mu
+func (m *MemoryStorage) appendAudit(events []audit.Event) {
+	for i := range events {
+		events[i].ID = int64(len(m.audit)) + 1
+		m.audit = append(m.audit, events[i])
+	}
+}
+
+// Query возвращает записи журнала аудита по условиям q в порядке номеров
+func (m *MemoryStorage) Query(ctx context.Context, q audit.Query) ([]audit.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []audit.Event
+	// номер записи на единицу больше её индекса
+	for _, e := range m.audit[min(max(q.AfterID, 0), int64(len(m.audit))):] {
+		if !q.Match(e) {
+			continue
+		}
+		events = append(events, e)
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// Record добавляет записи в память и в журнал аудита с суффиксом .audit
+func (f *FileStorage) Record(ctx context.Context, events ...audit.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.MemoryStorage.mu.Lock()
+	f.appendAudit(events)
+	f.MemoryStorage.mu.Unlock()
+
+	for _, e := range events {
+		if err := f.auditProducer.Write(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func auditPath(path string) string {
+	return path + ".audit"
+}
+
+// loadAudit читает журнал аудита
+func (f *FileStorage) loadAudit(path string) error {
+	consumer, err := saver.NewConsumer(path)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for {
+		var event audit.Event
+		err = consumer.Read(&event)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.audit = append(f.audit, event)
+	}
+}
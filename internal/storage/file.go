@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/saver"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// FileStorage хранит URL в памяти и дописывает каждое изменение в журнал событий.
+// При старте журнал проигрывается заново, последнее событие по паре namespace и url_id побеждает;
+// события переходов только увеличивают счётчик варианта.
+// Ключи API пишутся в отдельный журнал с суффиксом .keys, записи аудита — с суффиксом .audit.
+type FileStorage struct {
+	*MemoryStorage
+
+	// mu упорядочивает запись в память и в журнал
+	mu       sync.Mutex
+	producer *saver.Producer
+	seq      int
+	// keysProducer — журнал ключей API, хранится отдельно от журнала ссылок
+	keysProducer *saver.Producer
+	// auditProducer — журнал аудита, записи только дописываются
+	auditProducer *saver.Producer
+}
+
+func init() {
+	store.Register(store.BackendMemory, func(context.Context, store.Options) (store.Backend, error) {
+		return New(), nil
+	})
+	store.Register(store.BackendFile, func(_ context.Context, opts store.Options) (store.Backend, error) {
+		return NewFile(opts.File)
+	})
+}
+
+// NewFile восстанавливает состояние из журнала и открывает его на дозапись
+func NewFile(opts store.FileOptions) (*FileStorage, error) {
+	if opts.Path == "" {
+		return nil, errors.New("file storage path is empty")
+	}
+
+	f := &FileStorage{MemoryStorage: New()}
+
+	consumer, err := saver.NewConsumer(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	for {
+		event, err := consumer.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		f.seq++
+		if event.Click != "" {
+			// переход без ссылки или варианта бывает только в повреждённом журнале и пропускается
+			_, _ = f.countClick(store.URLRef{Namespace: event.Namespace, ID: event.URLID}, event.Click)
+			continue
+		}
+
+		url := eventToURL(event)
+		f.urls[urlKey(url)] = url
+	}
+
+	if err = f.loadKeys(keysPath(opts.Path)); err != nil {
+		return nil, err
+	}
+	if err = f.loadAudit(auditPath(opts.Path)); err != nil {
+		return nil, err
+	}
+
+	f.producer, err = saver.NewProducer(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	f.keysProducer, err = saver.NewProducer(keysPath(opts.Path))
+	if err != nil {
+		f.producer.Close()
+		return nil, err
+	}
+	f.auditProducer, err = saver.NewProducer(auditPath(opts.Path))
+	if err != nil {
+		f.producer.Close()
+		f.keysProducer.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *FileStorage) Save(ctx context.Context, url store.URL) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.MemoryStorage.Save(ctx, url); err != nil {
+		return "", err
+	}
+
+	return "", f.write(url)
+}
+
+func (f *FileStorage) SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.MemoryStorage.SaveBatch(ctx, namespace, userID, requestBatch); err != nil {
+		return err
+	}
+
+	for _, req := range requestBatch {
+		url, err := f.MemoryStorage.Get(ctx, namespace, req.CorrelationID)
+		if err != nil {
+			return err
+		}
+		if err = f.write(url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FileStorage) DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.MemoryStorage.DeleteURLs(ctx, namespace, userID, ids); err != nil {
+		return err
+	}
+
+	f.MemoryStorage.mu.RLock()
+	defer f.MemoryStorage.mu.RUnlock()
+
+	for _, id := range ids {
+		url, ok := f.urls[key{namespace: namespace, id: id}]
+		if !ok || url.UserID != userID {
+			continue
+		}
+		if err := f.write(url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FileStorage) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	updated, err := f.MemoryStorage.UpdateURL(ctx, url)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	return updated, f.write(updated)
+}
+
+// CountClick дописывает в журнал короткое событие перехода по варианту вместо всего состояния ссылки
+func (f *FileStorage) CountClick(ctx context.Context, ref store.URLRef, variant string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.MemoryStorage.mu.Lock()
+	_, err := f.MemoryStorage.countClick(ref, variant)
+	f.MemoryStorage.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f.seq++
+
+	return f.producer.WriteEvent(&models.Event{
+		UUID:      strconv.Itoa(f.seq),
+		Namespace: ref.Namespace,
+		URLID:     ref.ID,
+		Click:     variant,
+	})
+}
+
+// Close закрывает журнал событий
+func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return errors.Join(f.producer.Close(), f.keysProducer.Close(), f.auditProducer.Close())
+}
+
+// write дописывает состояние URL в журнал, вызывается под f.mu
+func (f *FileStorage) write(url store.URL) error {
+	f.seq++
+
+	return f.producer.WriteEvent(&models.Event{
+		UUID:             strconv.Itoa(f.seq),
+		Namespace:        url.Namespace,
+		OriginalURL:      url.OriginalURL,
+		URLID:            url.GeneratedID,
+		UserID:           url.UserID,
+		DeletedFlag:      url.DeletedFlag,
+		Disabled:         url.Disabled,
+		RedirectMode:     string(url.RedirectMode),
+		CacheMaxAge:      url.CacheMaxAge,
+		ExpiresAt:        url.ExpiresAt,
+		Version:          url.Version,
+		QueryPassthrough: string(url.QueryMode),
+		Destinations:     toEventDestinations(url.Destinations),
+		Rules:            toEventRules(url.Rules),
+	})
+}
+
+func eventToURL(event *models.Event) store.URL {
+	id := event.URLID
+	if id == "" {
+		// старые журналы хранят только полный короткий URL
+		id = path.Base(event.ShortURL)
+	}
+
+	return store.URL{
+		Namespace:    event.Namespace,
+		OriginalURL:  event.OriginalURL,
+		GeneratedID:  id,
+		UserID:       event.UserID,
+		DeletedFlag:  event.DeletedFlag,
+		Disabled:     event.Disabled,
+		RedirectMode: store.RedirectMode(event.RedirectMode),
+		CacheMaxAge:  event.CacheMaxAge,
+		ExpiresAt:    event.ExpiresAt,
+		// журналы до появления версий не хранят её, такие ссылки ещё не изменялись
+		Version:      max(event.Version, 1),
+		QueryMode:    store.QueryMode(event.QueryPassthrough),
+		Destinations: fromEventDestinations(event.Destinations),
+		Rules:        fromEventRules(event.Rules),
+	}
+}
+
+func toEventDestinations(destinations []store.Destination) []models.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	events := make([]models.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		events = append(events, models.Destination(d))
+	}
+
+	return events
+}
+
+func fromEventDestinations(events []models.Destination) []store.Destination {
+	if len(events) == 0 {
+		return nil
+	}
+
+	destinations := make([]store.Destination, 0, len(events))
+	for _, d := range events {
+		destinations = append(destinations, store.Destination(d))
+	}
+
+	return destinations
+}
+
+func toEventRules(rules []store.Rule) []models.Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	events := make([]models.Rule, 0, len(rules))
+	for _, r := range rules {
+		events = append(events, models.Rule(r))
+	}
+
+	return events
+}
+
+func fromEventRules(events []models.Rule) []store.Rule {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rules := make([]store.Rule, 0, len(events))
+	for _, r := range events {
+		rules = append(rules, store.Rule(r))
+	}
+
+	return rules
+}
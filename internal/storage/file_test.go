@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/store"
+	"github.com/Nastez/shortener/internal/store/audited"
+)
+
+func TestFileStorageReplay(t *testing.T) {
+	ctx := context.Background()
+	opts := store.FileOptions{Path: filepath.Join(t.TempDir(), "events.log")}
+
+	s, err := NewFile(opts)
+	require.NoError(t, err)
+
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://yoga.org", GeneratedID: "yoga", UserID: "user"})
+	require.NoError(t, err)
+	require.NoError(t, s.SaveBatch(ctx, "", "user",
+		models.PayloadBatch{{CorrelationID: "tea", OriginalURL: "https://tea.org", RedirectMode: "301"}},
+	))
+	// тот же идентификатор в пространстве имён другого домена
+	require.NoError(t, s.SaveBatch(ctx, "brand.example", "user",
+		models.PayloadBatch{{CorrelationID: "tea", OriginalURL: "https://brand.example/tea"}},
+	))
+	require.NoError(t, s.DeleteURLs(ctx, "", "user", []string{"yoga"}))
+	require.NoError(t, s.SaveKey(ctx, store.APIKey{ID: "k1", UserID: "user", Hash: "h1", Scopes: []string{"create"}}))
+	require.NoError(t, s.SaveKey(ctx, store.APIKey{ID: "k2", UserID: "user", Hash: "h2", Scopes: []string{"delete"}}))
+	require.NoError(t, s.RevokeKey(ctx, "k2"))
+	require.NoError(t, s.Close())
+
+	s, err = NewFile(opts)
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Get(ctx, "", "yoga")
+	assert.ErrorIs(t, err, store.ErrDeleted)
+
+	url, err := s.Get(ctx, "", "tea")
+	require.NoError(t, err)
+	assert.Equal(t, "https://tea.org", url.OriginalURL)
+	assert.Equal(t, store.RedirectMovedPermanently, url.RedirectMode)
+	assert.Equal(t, "user", url.UserID)
+
+	url, err = s.Get(ctx, "brand.example", "tea")
+	require.NoError(t, err)
+	assert.Equal(t, "https://brand.example/tea", url.OriginalURL)
+
+	key, err := s.GetKey(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"create"}, key.Scopes)
+	assert.Nil(t, key.RevokedAt)
+
+	key, err = s.GetKey(ctx, "k2")
+	require.NoError(t, err)
+	assert.NotNil(t, key.RevokedAt)
+
+	_, err = s.GetKey(ctx, "k3")
+	assert.ErrorIs(t, err, store.ErrKeyNotFound)
+}
+
+func TestFileStorageDuplicateID(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFile(store.FileOptions{Path: filepath.Join(t.TempDir(), "events.log")})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://yoga.org", GeneratedID: "yoga", UserID: "user"})
+	require.NoError(t, err)
+
+	// занятый идентификатор не перезаписывает чужую ссылку
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://tea.org", GeneratedID: "yoga", UserID: "other"})
+	assert.ErrorIs(t, err, store.ErrConflict)
+	err = s.SaveBatch(ctx, "", "other", models.PayloadBatch{{CorrelationID: "yoga", OriginalURL: "https://tea.org"}})
+	assert.ErrorIs(t, err, store.ErrConflict)
+
+	// повтор внутри пакета отклоняет пакет целиком
+	err = s.SaveBatch(ctx, "", "user", models.PayloadBatch{
+		{CorrelationID: "tea", OriginalURL: "https://tea.org"},
+		{CorrelationID: "tea", OriginalURL: "https://coffee.org"},
+	})
+	assert.ErrorIs(t, err, store.ErrConflict)
+	_, err = s.Get(ctx, "", "tea")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	url, err := s.Get(ctx, "", "yoga")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yoga.org", url.OriginalURL)
+}
+
+func TestFileStorageLegacyJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	// журнал до появления url_id: идентификатор есть только в short_url
+	require.NoError(t, os.WriteFile(path, []byte(`{"uuid":"1","short_url":"http://old.host:8080/yoga","original_url":"https://yoga.org"}`+"\n"), 0o600))
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	url, err := s.Get(context.Background(), "", "yoga")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yoga.org", url.OriginalURL)
+}
+
+func TestFileStorageModeration(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b"} {
+		_, err = s.Save(ctx, store.URL{OriginalURL: "https://evil.example/" + id, GeneratedID: id, UserID: "alice"})
+		require.NoError(t, err)
+	}
+
+	found, err := s.SetDisabled(ctx, []store.URLRef{{ID: "a"}, {ID: "zzz"}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []store.URLRef{{ID: "a"}}, found)
+	require.NoError(t, s.ReassignURL(ctx, store.URLRef{ID: "b"}, "bob"))
+	assert.ErrorIs(t, s.ReassignURL(ctx, store.URLRef{ID: "zzz"}, "bob"), store.ErrNotFound)
+	require.NoError(t, s.Close())
+
+	// состояние модерации восстанавливается из журнала
+	s, err = NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Get(ctx, "", "a")
+	assert.ErrorIs(t, err, store.ErrDisabled)
+	assert.ErrorIs(t, err, store.ErrDeleted)
+
+	disabled := true
+	urls, err := s.SearchURLs(ctx, store.URLFilter{Host: "EVIL.example", Disabled: &disabled})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "a", urls[0].GeneratedID)
+
+	urls, err = s.SearchURLs(ctx, store.URLFilter{UserID: "bob"})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "b", urls[0].GeneratedID)
+
+	urls, err = s.SearchURLs(ctx, store.URLFilter{After: store.URLRef{ID: "a"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "b", urls[0].GeneratedID)
+}
+
+func TestFileStorageAudit(t *testing.T) {
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	linked := audited.New(s, s)
+
+	_, err = linked.Save(ctx, store.URL{OriginalURL: "https://yoga.org/", GeneratedID: "a", UserID: "alice"})
+	require.NoError(t, err)
+	_, err = linked.SetDisabled(ctx, []store.URLRef{{ID: "a"}}, true)
+	require.NoError(t, err)
+	// уже отключённая ссылка не даёт новой записи
+	_, err = linked.SetDisabled(ctx, []store.URLRef{{ID: "a"}}, true)
+	require.NoError(t, err)
+	require.NoError(t, linked.DeleteURLs(ctx, "", "alice", []string{"a"}))
+	require.NoError(t, s.Close())
+
+	// журнал аудита восстанавливается при старте и продолжает нумерацию
+	s, err = NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	events, err := s.Query(ctx, audit.Query{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	for i, action := range []string{audit.ActionCreate, audit.ActionDisable, audit.ActionDelete} {
+		assert.Equal(t, int64(i+1), events[i].ID)
+		assert.Equal(t, action, events[i].Action)
+		assert.Equal(t, "req-1", events[i].RequestID)
+		assert.Equal(t, "anonymous", events[i].Actor)
+	}
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, "https://yoga.org/", events[0].After.OriginalURL)
+	assert.True(t, events[2].Before.Disabled)
+	assert.True(t, events[2].After.Deleted)
+
+	require.NoError(t, s.Record(ctx, audit.Event{Time: time.Now(), Action: audit.ActionUpdate, URLID: "a"}))
+	events, err = s.Query(ctx, audit.Query{AfterID: 3})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(4), events[0].ID)
+
+	// полуинтервал [From, To) и ограничение выборки
+	events, err = s.Query(ctx, audit.Query{To: events[0].Time})
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+	events, err = s.Query(ctx, audit.Query{From: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = s.Query(ctx, audit.Query{Action: audit.ActionDisable, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(2), events[0].ID)
+}
+
+func TestFileStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://old.example/", GeneratedID: "a", UserID: "alice"})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	updated, err := s.UpdateURL(ctx, store.URL{OriginalURL: "https://new.example/", GeneratedID: "a", UserID: "alice", ExpiresAt: &expiresAt, Version: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	_, err = s.UpdateURL(ctx, store.URL{OriginalURL: "https://lost.example/", GeneratedID: "a", UserID: "alice", Version: 1})
+	assert.ErrorIs(t, err, store.ErrVersionMismatch)
+	_, err = s.UpdateURL(ctx, store.URL{OriginalURL: "https://lost.example/", GeneratedID: "a", UserID: "bob", Version: 2})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	require.NoError(t, s.Close())
+
+	// новая редакция и срок действия восстанавливаются из журнала
+	s, err = NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	url, err := s.Get(ctx, "", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example/", url.OriginalURL)
+	assert.Equal(t, int64(2), url.Version)
+	require.NotNil(t, url.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*url.ExpiresAt))
+
+	past := time.Now().Add(-time.Minute)
+	_, err = s.UpdateURL(ctx, store.URL{OriginalURL: url.OriginalURL, GeneratedID: "a", UserID: "alice", ExpiresAt: &past, Version: 2})
+	require.NoError(t, err)
+	_, err = s.Get(ctx, "", "a")
+	assert.ErrorIs(t, err, store.ErrExpired)
+	assert.ErrorIs(t, err, store.ErrDeleted)
+
+	_, err = s.Get(ctx, "", "missing")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestFileStorageDestinations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://landing.example/", GeneratedID: "a", UserID: "alice"})
+	require.NoError(t, err)
+	_, err = s.UpdateURL(ctx, store.URL{
+		OriginalURL: "https://landing.example/",
+		GeneratedID: "a",
+		UserID:      "alice",
+		Version:     1,
+		Destinations: []store.Destination{
+			{Variant: "a", URL: "https://a.example/", Weight: 1},
+			{Variant: "b", URL: "https://b.example/", Weight: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.CountClick(ctx, store.URLRef{ID: "a"}, "b"))
+	require.NoError(t, s.CountClick(ctx, store.URLRef{ID: "a"}, "b"))
+	assert.ErrorIs(t, s.CountClick(ctx, store.URLRef{ID: "a"}, "zzz"), store.ErrNotFound)
+	require.NoError(t, s.Close())
+
+	// переход записывается коротким событием, а не всем состоянием ссылки
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 4)
+	assert.JSONEq(t, `{"uuid":"4","url_id":"a","click":"b"}`, lines[3])
+
+	// варианты и счётчики переходов восстанавливаются из журнала
+	s, err = NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	url, err := s.Get(ctx, "", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []store.Destination{
+		{Variant: "a", URL: "https://a.example/", Weight: 1},
+		{Variant: "b", URL: "https://b.example/", Weight: 2, Clicks: 2},
+	}, url.Destinations)
+}
+
+func TestFileStorageRules(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.log")
+	rules := []store.Rule{
+		{Field: "device", Values: []string{"ios"}, URL: "https://apps.apple.com/app/id1"},
+		{Field: "cidr", Values: []string{"10.0.0.0/8", "192.168.0.0/16"}, URL: "https://intranet.example/"},
+	}
+
+	s, err := NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://app.example/", GeneratedID: "a", UserID: "alice"})
+	require.NoError(t, err)
+	_, err = s.UpdateURL(ctx, store.URL{OriginalURL: "https://app.example/", GeneratedID: "a", UserID: "alice", Version: 1, Rules: rules})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// правила восстанавливаются из журнала в прежнем порядке
+	s, err = NewFile(store.FileOptions{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	url, err := s.Get(ctx, "", "a")
+	require.NoError(t, err)
+	assert.Equal(t, rules, url.Rules)
+}
@@ -2,39 +2,181 @@ package storage
 
 import (
 	"context"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
 	"github.com/Nastez/shortener/internal/store"
 )
 
-type MemoryStorage map[string]string
+// MemoryStorage хранит URL в памяти процесса
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	urls map[key]store.URL
+	keys map[string]store.APIKey
+	// audit — журнал аудита, номер записи на единицу больше её индекса
+	audit []audit.Event
+}
+
+// key — идентификатор ссылки в пространстве имён домена
+type key struct {
+	namespace string
+	id        string
+}
+
+func urlKey(url store.URL) key {
+	return key{namespace: url.Namespace, id: url.GeneratedID}
+}
 
 func New() *MemoryStorage {
-	return &MemoryStorage{}
+	return &MemoryStorage{urls: make(map[key]store.URL), keys: make(map[string]store.APIKey)}
 }
 
-func (m MemoryStorage) Save(ctx context.Context, url store.URL) (string, error) {
-	m[url.GeneratedID] = url.OriginalURL
+// Close ничего не делает: данные в памяти пропадают вместе с процессом
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+func (m *MemoryStorage) Save(ctx context.Context, url store.URL) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := urlKey(url)
+	if _, ok := m.urls[k]; ok {
+		// идентификатор уже занят другой ссылкой пространства имён
+		return "", store.ErrConflict
+	}
+	url.Version = 1
+	m.urls[k] = url
 
 	return "", nil
 }
 
-func (m MemoryStorage) Get(ctx context.Context, id string) (string, error) {
-	var originalURL = m[id]
+func (m *MemoryStorage) Get(ctx context.Context, namespace, id string) (store.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	url, ok := m.urls[key{namespace: namespace, id: id}]
+	if !ok {
+		return store.URL{}, store.ErrNotFound
+	}
+	if url.DeletedFlag {
+		return store.URL{}, store.ErrDeleted
+	}
+	if url.Disabled {
+		return store.URL{}, store.ErrDisabled
+	}
+	if url.Expired(time.Now()) {
+		return store.URL{}, store.ErrExpired
+	}
 
-	return originalURL, nil
+	return url, nil
 }
 
-func (m MemoryStorage) SaveBatch(ctx context.Context, requestBatch models.PayloadBatch, shortURLBatch models.ResponseBodyBatch) error {
-	var originalURL string
+func (m *MemoryStorage) SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	// пакет сохраняется целиком или не сохраняется вовсе, как в транзакции
+	seen := make(map[key]bool, len(requestBatch))
 	for _, req := range requestBatch {
-		originalURL = req.OriginalURL
+		k := key{namespace: namespace, id: req.CorrelationID}
+		if _, ok := m.urls[k]; ok || seen[k] {
+			return store.ErrConflict
+		}
+		seen[k] = true
 	}
 
-	for _, b := range shortURLBatch {
-		m[b.CorrelationID] = originalURL
+	for _, req := range requestBatch {
+		url := store.BatchURL(namespace, userID, req)
+		m.urls[urlKey(url)] = url
 	}
 
 	return nil
 }
+
+func (m *MemoryStorage) GetUserURLs(ctx context.Context, userID string) ([]store.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var urls []store.URL
+	for _, url := range m.urls {
+		if url.UserID == userID && !url.DeletedFlag {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+func (m *MemoryStorage) DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		k := key{namespace: namespace, id: id}
+		url, ok := m.urls[k]
+		if !ok || url.UserID != userID {
+			continue
+		}
+		url.DeletedFlag = true
+		m.urls[k] = url
+	}
+
+	return nil
+}
+
+func (m *MemoryStorage) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := urlKey(url)
+	current, ok := m.urls[k]
+	if !ok || current.DeletedFlag || current.UserID != url.UserID {
+		return store.URL{}, store.ErrNotFound
+	}
+	if current.Version != url.Version {
+		return store.URL{}, store.ErrVersionMismatch
+	}
+
+	current.OriginalURL = url.OriginalURL
+	current.RedirectMode = url.RedirectMode
+	current.ExpiresAt = url.ExpiresAt
+	current.QueryMode = url.QueryMode
+	current.Destinations = store.KeepClicks(current.Destinations, url.Destinations)
+	current.Rules = url.Rules
+	current.Version++
+	m.urls[k] = current
+
+	return current, nil
+}
+
+func (m *MemoryStorage) CountClick(ctx context.Context, ref store.URLRef, variant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.countClick(ref, variant)
+	return err
+}
+
+// countClick увеличивает счётчик варианта и возвращает ссылку, вызывается под m.mu
+func (m *MemoryStorage) countClick(ref store.URLRef, variant string) (store.URL, error) {
+	k := key{namespace: ref.Namespace, id: ref.ID}
+	url, ok := m.urls[k]
+	if !ok {
+		return store.URL{}, store.ErrNotFound
+	}
+
+	// варианты копируются, чтобы не менять срез, уже отданный читателям
+	url.Destinations = slices.Clone(url.Destinations)
+	i := slices.IndexFunc(url.Destinations, func(d store.Destination) bool { return d.Variant == variant })
+	if i < 0 {
+		return store.URL{}, store.ErrNotFound
+	}
+	url.Destinations[i].Clicks++
+	m.urls[k] = url
+
+	return url, nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrKeyNotFound указывает на то, что ключ API не найден
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey — ключ API, выданный пользователю. Секрет ключа не хранится, только его хэш.
+type APIKey struct {
+	// ID — открытая часть ключа, по ней ключ ищется при проверке
+	ID     string
+	UserID string
+	// Name — описание ключа для администратора, например имя сервиса
+	Name string
+	// Hash — SHA-256 секрета в шестнадцатеричном виде
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	// RevokedAt — время отзыва, nil у действующего ключа
+	RevokedAt *time.Time
+}
+
+// KeyStore хранит ключи API
+type KeyStore interface {
+	SaveKey(ctx context.Context, key APIKey) error
+	// GetKey возвращает ключ по ID, в том числе отозванный; ErrKeyNotFound, если ключа нет
+	GetKey(ctx context.Context, id string) (APIKey, error)
+	// RevokeKey отзывает ключ; ErrKeyNotFound, если ключа нет
+	RevokeKey(ctx context.Context, id string) error
+	// ListKeys возвращает ключи пользователя или все ключи при пустом userID
+	ListKeys(ctx context.Context, userID string) ([]APIKey, error)
+}
@@ -0,0 +1,233 @@
+// Package audited оборачивает хранилище ссылок и записывает каждое изменение в журнал аудита
+package audited
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/auth"
+	"github.com/Nastez/shortener/internal/logger"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Store записывает создание, изменение, удаление, модерацию и смену владельца ссылок
+// вместе с состоянием до и после действия. Чтение передаётся хранилищу без изменений.
+type Store struct {
+	store.Store
+	log audit.Recorder
+	// now подменяется в тестах
+	now func() time.Time
+}
+
+// New оборачивает хранилище s, записи пишутся в log
+func New(s store.Store, log audit.Recorder) *Store {
+	return &Store{Store: s, log: log, now: time.Now}
+}
+
+func (s *Store) Save(ctx context.Context, url store.URL) (string, error) {
+	id, err := s.Store.Save(ctx, url)
+	if err != nil {
+		// при конфликте ссылка не создаётся
+		return id, err
+	}
+
+	// новая ссылка начинается с первой редакции
+	url.Version = 1
+	s.record(ctx, s.event(ctx, audit.ActionCreate, url, nil, snapshot(url)))
+
+	return id, nil
+}
+
+func (s *Store) SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error {
+	if err := s.Store.SaveBatch(ctx, namespace, userID, requestBatch); err != nil {
+		return err
+	}
+
+	events := make([]audit.Event, 0, len(requestBatch))
+	for _, req := range requestBatch {
+		url := store.BatchURL(namespace, userID, req)
+		events = append(events, s.event(ctx, audit.ActionCreate, url, nil, snapshot(url)))
+	}
+	s.record(ctx, events...)
+
+	return nil
+}
+
+func (s *Store) DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error {
+	before, err := s.lookup(ctx, refs(namespace, ids), userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Store.DeleteURLs(ctx, namespace, userID, ids); err != nil {
+		return err
+	}
+
+	events := make([]audit.Event, 0, len(before))
+	for _, url := range before {
+		if url.DeletedFlag {
+			continue
+		}
+		after := url
+		after.DeletedFlag = true
+		events = append(events, s.event(ctx, audit.ActionDelete, url, snapshot(url), snapshot(after)))
+	}
+	s.record(ctx, events...)
+
+	return nil
+}
+
+func (s *Store) SetDisabled(ctx context.Context, refs []store.URLRef, disabled bool) ([]store.URLRef, error) {
+	before, err := s.lookup(ctx, refs, "")
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := s.Store.SetDisabled(ctx, refs, disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	action := audit.ActionEnable
+	if disabled {
+		action = audit.ActionDisable
+	}
+
+	byRef := make(map[store.URLRef]store.URL, len(before))
+	for _, url := range before {
+		byRef[store.URLRef{Namespace: url.Namespace, ID: url.GeneratedID}] = url
+	}
+
+	events := make([]audit.Event, 0, len(found))
+	for _, ref := range found {
+		url, ok := byRef[ref]
+		if !ok || url.Disabled == disabled {
+			// состояние не изменилось
+			continue
+		}
+		after := url
+		after.Disabled = disabled
+		events = append(events, s.event(ctx, action, url, snapshot(url), snapshot(after)))
+	}
+	s.record(ctx, events...)
+
+	return found, nil
+}
+
+func (s *Store) ReassignURL(ctx context.Context, ref store.URLRef, userID string) error {
+	before, err := s.lookup(ctx, []store.URLRef{ref}, "")
+	if err != nil {
+		return err
+	}
+
+	if err = s.Store.ReassignURL(ctx, ref, userID); err != nil {
+		return err
+	}
+
+	if len(before) == 0 || before[0].UserID == userID {
+		return nil
+	}
+	url := before[0]
+	after := url
+	after.UserID = userID
+	s.record(ctx, s.event(ctx, audit.ActionReassign, url, snapshot(url), snapshot(after)))
+
+	return nil
+}
+
+func (s *Store) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	before, err := s.lookup(ctx, []store.URLRef{{Namespace: url.Namespace, ID: url.GeneratedID}}, url.UserID)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	updated, err := s.Store.UpdateURL(ctx, url)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	var prev *audit.Link
+	if len(before) > 0 {
+		prev = snapshot(before[0])
+	}
+	s.record(ctx, s.event(ctx, audit.ActionUpdate, updated, prev, snapshot(updated)))
+
+	return updated, nil
+}
+
+// lookup возвращает текущее состояние ссылок refs, включая удалённые и отключённые
+func (s *Store) lookup(ctx context.Context, refs []store.URLRef, userID string) ([]store.URL, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	return s.Store.SearchURLs(ctx, store.URLFilter{Refs: refs, UserID: userID, Limit: len(refs)})
+}
+
+func (s *Store) event(ctx context.Context, action string, url store.URL, before, after *audit.Link) audit.Event {
+	e := audit.Event{
+		Time:      s.now().UTC(),
+		RequestID: audit.RequestIDFromContext(ctx),
+		Actor:     auth.Actor(ctx),
+		Action:    action,
+		Namespace: url.Namespace,
+		URLID:     url.GeneratedID,
+		Before:    before,
+		After:     after,
+	}
+	if reason := audit.ReasonFromContext(ctx); reason != "" {
+		e.Details = map[string]string{"reason": reason}
+	}
+
+	return e
+}
+
+// record пишет события аудита; действие к этому моменту уже выполнено,
+// поэтому ошибка записи не отменяет его, а попадает в журнал сервиса
+func (s *Store) record(ctx context.Context, events ...audit.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	if err := s.log.Record(ctx, events...); err != nil {
+		logger.Log.Error("can't record audit events", zap.Int("events", len(events)), zap.Error(err))
+	}
+}
+
+func snapshot(url store.URL) *audit.Link {
+	var destinations []audit.Destination
+	for _, d := range url.Destinations {
+		destinations = append(destinations, audit.Destination{Variant: d.Variant, URL: d.URL, Weight: d.Weight})
+	}
+	var rules []audit.Rule
+	for _, r := range url.Rules {
+		rules = append(rules, audit.Rule(r))
+	}
+
+	return &audit.Link{
+		OriginalURL:      url.OriginalURL,
+		UserID:           url.UserID,
+		Deleted:          url.DeletedFlag,
+		Disabled:         url.Disabled,
+		RedirectMode:     string(url.RedirectMode),
+		CacheMaxAge:      url.CacheMaxAge,
+		ExpiresAt:        url.ExpiresAt,
+		Version:          url.Version,
+		QueryPassthrough: string(url.QueryMode),
+		Destinations:     destinations,
+		Rules:            rules,
+	}
+}
+
+func refs(namespace string, ids []string) []store.URLRef {
+	refs := make([]store.URLRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, store.URLRef{Namespace: namespace, ID: id})
+	}
+
+	return refs
+}
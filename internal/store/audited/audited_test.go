@@ -0,0 +1,228 @@
+package audited
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/audit"
+	"github.com/Nastez/shortener/internal/services"
+	"github.com/Nastez/shortener/internal/storage"
+	"github.com/Nastez/shortener/internal/store"
+	storeMock "github.com/Nastez/shortener/internal/store/mocks"
+)
+
+// recorder запоминает записанные события
+type recorder struct {
+	events []audit.Event
+}
+
+func (r *recorder) Record(_ context.Context, events ...audit.Event) error {
+	r.events = append(r.events, events...)
+	return nil
+}
+
+var errStore = errors.New("store is unavailable")
+
+func newTestStore(t *testing.T) (*Store, *storeMock.MockStore, *recorder) {
+	ctrl := gomock.NewController(t)
+	inner := storeMock.NewMockStore(ctrl)
+	log := &recorder{}
+
+	s := New(inner, log)
+	s.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	return s, inner, log
+}
+
+func TestStoreRecordsChanges(t *testing.T) {
+	link := store.URL{Namespace: "ru", GeneratedID: "abc", OriginalURL: "https://yoga.org", UserID: "alice", Version: 1}
+	ref := store.URLRef{Namespace: "ru", ID: "abc"}
+
+	tests := []struct {
+		name   string
+		call   func(ctx context.Context, s *Store, inner *storeMock.MockStore) error
+		action string
+		before *audit.Link
+		after  *audit.Link
+	}{
+		{
+			name: "save",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				url := link
+				url.Version = 0
+				inner.EXPECT().Save(ctx, url).Return("", nil)
+				_, err := s.Save(ctx, url)
+				return err
+			},
+			action: audit.ActionCreate,
+			after:  &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1},
+		},
+		{
+			name: "update",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				changed := link
+				changed.OriginalURL = "https://pilates.org"
+				updated := changed
+				updated.Version = 2
+
+				inner.EXPECT().SearchURLs(ctx, store.URLFilter{Refs: []store.URLRef{ref}, UserID: "alice", Limit: 1}).Return([]store.URL{link}, nil)
+				inner.EXPECT().UpdateURL(ctx, changed).Return(updated, nil)
+				_, err := s.UpdateURL(ctx, changed)
+				return err
+			},
+			action: audit.ActionUpdate,
+			before: &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1},
+			after:  &audit.Link{OriginalURL: "https://pilates.org", UserID: "alice", Version: 2},
+		},
+		{
+			name: "delete",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, store.URLFilter{Refs: []store.URLRef{ref}, UserID: "alice", Limit: 1}).Return([]store.URL{link}, nil)
+				inner.EXPECT().DeleteURLs(ctx, "ru", "alice", []string{"abc"}).Return(nil)
+				return s.DeleteURLs(ctx, "ru", "alice", []string{"abc"})
+			},
+			action: audit.ActionDelete,
+			before: &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1},
+			after:  &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1, Deleted: true},
+		},
+		{
+			name: "disable",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, store.URLFilter{Refs: []store.URLRef{ref}, Limit: 1}).Return([]store.URL{link}, nil)
+				inner.EXPECT().SetDisabled(ctx, []store.URLRef{ref}, true).Return([]store.URLRef{ref}, nil)
+				_, err := s.SetDisabled(ctx, []store.URLRef{ref}, true)
+				return err
+			},
+			action: audit.ActionDisable,
+			before: &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1},
+			after:  &audit.Link{OriginalURL: "https://yoga.org", UserID: "alice", Version: 1, Disabled: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, inner, log := newTestStore(t)
+			ctx := audit.WithReason(audit.WithRequestID(context.Background(), "req-1"), "spam")
+
+			require.NoError(t, tt.call(ctx, s, inner))
+
+			require.Len(t, log.events, 1)
+			assert.Equal(t, audit.Event{
+				Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				RequestID: "req-1",
+				Actor:     "anonymous",
+				Action:    tt.action,
+				Namespace: "ru",
+				URLID:     "abc",
+				Before:    tt.before,
+				After:     tt.after,
+				Details:   map[string]string{"reason": "spam"},
+			}, log.events[0])
+		})
+	}
+}
+
+func TestStoreSkipsFailedChanges(t *testing.T) {
+	link := store.URL{Namespace: "ru", GeneratedID: "abc", OriginalURL: "https://yoga.org", UserID: "alice", Version: 1}
+	ref := store.URLRef{Namespace: "ru", ID: "abc"}
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context, s *Store, inner *storeMock.MockStore) error
+	}{
+		{
+			name: "save conflict",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().Save(ctx, link).Return("xyz", store.ErrConflict)
+				_, err := s.Save(ctx, link)
+				return err
+			},
+		},
+		{
+			name: "update with stale version",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, gomock.Any()).Return([]store.URL{link}, nil)
+				inner.EXPECT().UpdateURL(ctx, link).Return(store.URL{}, store.ErrVersionMismatch)
+				_, err := s.UpdateURL(ctx, link)
+				return err
+			},
+		},
+		{
+			name: "delete failed",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, gomock.Any()).Return([]store.URL{link}, nil)
+				inner.EXPECT().DeleteURLs(ctx, "ru", "alice", []string{"abc"}).Return(errStore)
+				return s.DeleteURLs(ctx, "ru", "alice", []string{"abc"})
+			},
+		},
+		{
+			name: "disable failed",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, gomock.Any()).Return([]store.URL{link}, nil)
+				inner.EXPECT().SetDisabled(ctx, []store.URLRef{ref}, true).Return(nil, errStore)
+				_, err := s.SetDisabled(ctx, []store.URLRef{ref}, true)
+				return err
+			},
+		},
+		{
+			name: "lookup failed",
+			call: func(ctx context.Context, s *Store, inner *storeMock.MockStore) error {
+				inner.EXPECT().SearchURLs(ctx, gomock.Any()).Return(nil, errStore)
+				_, err := s.SetDisabled(ctx, []store.URLRef{ref}, true)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, inner, log := newTestStore(t)
+
+			assert.Error(t, tt.call(context.Background(), s, inner))
+			assert.Empty(t, log.events)
+		})
+	}
+}
+
+func TestAuditPaging(t *testing.T) {
+	ctx := context.Background()
+	memory := storage.New()
+	s := New(memory, memory)
+
+	for i := range 5 {
+		_, err := s.Save(ctx, store.URL{OriginalURL: fmt.Sprintf("https://yoga.org/%d", i), GeneratedID: fmt.Sprintf("id%d", i)})
+		require.NoError(t, err)
+	}
+	// отключение не попадает в выборку по действию create, но занимает номер
+	_, err := s.SetDisabled(ctx, []store.URLRef{{ID: "id0"}}, true)
+	require.NoError(t, err)
+	_, err = s.Save(ctx, store.URL{OriginalURL: "https://yoga.org/5", GeneratedID: "id5"})
+	require.NoError(t, err)
+
+	var (
+		ids     []int64
+		cursors []string
+	)
+	q := audit.Query{Action: audit.ActionCreate, Limit: 2}
+	for {
+		page, err := services.QueryAudit(ctx, memory, q)
+		require.NoError(t, err)
+		for _, e := range page.Events {
+			ids = append(ids, e.ID)
+		}
+		cursors = append(cursors, page.NextCursor)
+		if page.NextCursor == "" {
+			break
+		}
+		_, err = fmt.Sscan(page.NextCursor, &q.AfterID)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 7}, ids)
+	assert.Equal(t, []string{"2", "4", ""}, cursors)
+}
@@ -36,33 +36,76 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
-// Bootstrap mocks base method.
-func (m *MockStore) Bootstrap(ctx context.Context) error {
+// CountClick mocks base method.
+func (m *MockStore) CountClick(ctx context.Context, ref store.URLRef, variant string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Bootstrap", ctx)
+	ret := m.ctrl.Call(m, "CountClick", ctx, ref, variant)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Bootstrap indicates an expected call of Bootstrap.
-func (mr *MockStoreMockRecorder) Bootstrap(ctx interface{}) *gomock.Call {
+// CountClick indicates an expected call of CountClick.
+func (mr *MockStoreMockRecorder) CountClick(ctx, ref, variant interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Bootstrap", reflect.TypeOf((*MockStore)(nil).Bootstrap), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountClick", reflect.TypeOf((*MockStore)(nil).CountClick), ctx, ref, variant)
+}
+
+// DeleteURLs mocks base method.
+func (m *MockStore) DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteURLs", ctx, namespace, userID, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteURLs indicates an expected call of DeleteURLs.
+func (mr *MockStoreMockRecorder) DeleteURLs(ctx, namespace, userID, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteURLs", reflect.TypeOf((*MockStore)(nil).DeleteURLs), ctx, namespace, userID, ids)
 }
 
 // Get mocks base method.
-func (m *MockStore) Get(ctx context.Context, id string) (string, error) {
+func (m *MockStore) Get(ctx context.Context, namespace, id string) (store.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", ctx, id)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "Get", ctx, namespace, id)
+	ret0, _ := ret[0].(store.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockStoreMockRecorder) Get(ctx, id interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) Get(ctx, namespace, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), ctx, namespace, id)
+}
+
+// GetUserURLs mocks base method.
+func (m *MockStore) GetUserURLs(ctx context.Context, userID string) ([]store.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserURLs", ctx, userID)
+	ret0, _ := ret[0].([]store.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserURLs indicates an expected call of GetUserURLs.
+func (mr *MockStoreMockRecorder) GetUserURLs(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLs", reflect.TypeOf((*MockStore)(nil).GetUserURLs), ctx, userID)
+}
+
+// ReassignURL mocks base method.
+func (m *MockStore) ReassignURL(ctx context.Context, ref store.URLRef, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReassignURL", ctx, ref, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReassignURL indicates an expected call of ReassignURL.
+func (mr *MockStoreMockRecorder) ReassignURL(ctx, ref, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReassignURL", reflect.TypeOf((*MockStore)(nil).ReassignURL), ctx, ref, userID)
 }
 
 // Save mocks base method.
@@ -81,15 +124,60 @@ func (mr *MockStoreMockRecorder) Save(ctx, url interface{}) *gomock.Call {
 }
 
 // SaveBatch mocks base method.
-func (m *MockStore) SaveBatch(ctx context.Context, requestBatch models.PayloadBatch, shortURLBatch models.ResponseBodyBatch) error {
+func (m *MockStore) SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveBatch", ctx, requestBatch, shortURLBatch)
+	ret := m.ctrl.Call(m, "SaveBatch", ctx, namespace, userID, requestBatch)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SaveBatch indicates an expected call of SaveBatch.
-func (mr *MockStoreMockRecorder) SaveBatch(ctx, requestBatch, shortURLBatch interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) SaveBatch(ctx, namespace, userID, requestBatch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBatch", reflect.TypeOf((*MockStore)(nil).SaveBatch), ctx, namespace, userID, requestBatch)
+}
+
+// SearchURLs mocks base method.
+func (m *MockStore) SearchURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchURLs", ctx, filter)
+	ret0, _ := ret[0].([]store.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchURLs indicates an expected call of SearchURLs.
+func (mr *MockStoreMockRecorder) SearchURLs(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchURLs", reflect.TypeOf((*MockStore)(nil).SearchURLs), ctx, filter)
+}
+
+// SetDisabled mocks base method.
+func (m *MockStore) SetDisabled(ctx context.Context, refs []store.URLRef, disabled bool) ([]store.URLRef, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisabled", ctx, refs, disabled)
+	ret0, _ := ret[0].([]store.URLRef)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetDisabled indicates an expected call of SetDisabled.
+func (mr *MockStoreMockRecorder) SetDisabled(ctx, refs, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisabled", reflect.TypeOf((*MockStore)(nil).SetDisabled), ctx, refs, disabled)
+}
+
+// UpdateURL mocks base method.
+func (m *MockStore) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateURL", ctx, url)
+	ret0, _ := ret[0].(store.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateURL indicates an expected call of UpdateURL.
+func (mr *MockStoreMockRecorder) UpdateURL(ctx, url interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBatch", reflect.TypeOf((*MockStore)(nil).SaveBatch), ctx, requestBatch, shortURLBatch)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateURL", reflect.TypeOf((*MockStore)(nil).UpdateURL), ctx, url)
 }
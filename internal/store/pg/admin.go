@@ -0,0 +1,138 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// hostPattern выделяет хост из адреса назначения; адрес, не похожий на URL, не совпадёт ни с одним хостом
+const hostPattern = `^[A-Za-z][A-Za-z0-9+.-]*://([^/?#]*@)?([^/:?#]+).*$`
+
+func (s Store) SearchURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	limit := sql.NullInt64{Int64: int64(filter.Limit), Valid: filter.Limit > 0}
+	disabled := sql.NullBool{}
+	if filter.Disabled != nil {
+		disabled = sql.NullBool{Bool: *filter.Disabled, Valid: true}
+	}
+
+	namespaces := make([]string, 0, len(filter.Refs))
+	ids := make([]string, 0, len(filter.Refs))
+	for _, ref := range filter.Refs {
+		namespaces = append(namespaces, ref.Namespace)
+		ids = append(ids, ref.ID)
+	}
+
+	// постраничная выборка по ключу (namespace, url_id) использует индекс namespace_url_idx
+	rows, err := s.conn.QueryContext(ctx, `
+        SELECT
+            namespace,
+            original_url,
+            url_id,
+            user_id,
+            is_deleted,
+            is_disabled,
+            redirect_mode,
+            cache_max_age,
+            expires_at,
+            version,
+            query_passthrough,
+            rules,`+destinationsColumn+`
+        FROM urls
+        WHERE
+            ($1 = '' OR lower(regexp_replace(original_url, '`+hostPattern+`', '\2')) = lower($1))
+            AND ($2 = '' OR user_id = $2)
+            AND ($3::boolean IS NULL OR is_disabled = $3)
+            AND (namespace, url_id) > ($4, $5)
+            AND (cardinality($7::text[]) = 0 OR (namespace, url_id) IN (SELECT * FROM unnest($7::text[], $8::text[])))
+        ORDER BY namespace, url_id
+        LIMIT $6
+    `, filter.Host, filter.UserID, disabled, filter.After.Namespace, filter.After.ID, limit, namespaces, ids)
+	if err != nil {
+		return nil, fmt.Errorf("search error: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []store.URL
+	for rows.Next() {
+		var (
+			url          store.URL
+			userID       sql.NullString
+			cacheMaxAge  sql.NullInt32
+			expiresAt    sql.NullTime
+			rules        []byte
+			destinations []byte
+		)
+		err = rows.Scan(&url.Namespace, &url.OriginalURL, &url.GeneratedID, &userID, &url.DeletedFlag, &url.Disabled, &url.RedirectMode, &cacheMaxAge, &expiresAt, &url.Version, &url.QueryMode, &rules, &destinations)
+		if err != nil {
+			return nil, err
+		}
+		setNullable(&url, userID, cacheMaxAge, expiresAt)
+		if err = setRules(&url, rules); err != nil {
+			return nil, err
+		}
+		if err = setDestinations(&url, destinations); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+func (s Store) SetDisabled(ctx context.Context, refs []store.URLRef, disabled bool) ([]store.URLRef, error) {
+	namespaces := make([]string, 0, len(refs))
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		namespaces = append(namespaces, ref.Namespace)
+		ids = append(ids, ref.ID)
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `
+        UPDATE urls
+        SET is_disabled = $3
+        FROM unnest($1::text[], $2::text[]) AS refs (namespace, url_id)
+        WHERE
+            urls.namespace = refs.namespace AND urls.url_id = refs.url_id
+        RETURNING urls.namespace, urls.url_id
+    `, namespaces, ids, disabled)
+	if err != nil {
+		return nil, fmt.Errorf("disable error: %w", err)
+	}
+	defer rows.Close()
+
+	var found []store.URLRef
+	for rows.Next() {
+		var ref store.URLRef
+		if err = rows.Scan(&ref.Namespace, &ref.ID); err != nil {
+			return nil, err
+		}
+		found = append(found, ref)
+	}
+
+	return found, rows.Err()
+}
+
+func (s Store) ReassignURL(ctx context.Context, ref store.URLRef, userID string) error {
+	res, err := s.conn.ExecContext(ctx, `
+        UPDATE urls
+        SET user_id = $3
+        WHERE
+            namespace = $1 AND url_id = $2
+    `, ref.Namespace, ref.ID, userID)
+	if err != nil {
+		return fmt.Errorf("reassign error: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
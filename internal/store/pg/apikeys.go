@@ -0,0 +1,104 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+func (s Store) SaveKey(ctx context.Context, key store.APIKey) error {
+	_, err := s.conn.ExecContext(ctx, `
+        INSERT INTO api_keys (id, user_id, name, hash, scopes, created_at, revoked_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, key.ID, key.UserID, key.Name, key.Hash, strings.Join(key.Scopes, ","), key.CreatedAt, key.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("insert api key error: %w", err)
+	}
+
+	return nil
+}
+
+func (s Store) GetKey(ctx context.Context, id string) (store.APIKey, error) {
+	row := s.conn.QueryRowContext(ctx, `
+        SELECT id, user_id, name, hash, scopes, created_at, revoked_at
+        FROM api_keys
+        WHERE id = $1
+    `, id)
+
+	key, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.APIKey{}, store.ErrKeyNotFound
+	}
+
+	return key, err
+}
+
+func (s Store) RevokeKey(ctx context.Context, id string) error {
+	// повторный отзыв не меняет время первого
+	res, err := s.conn.ExecContext(ctx, `
+        UPDATE api_keys
+        SET revoked_at = COALESCE(revoked_at, now())
+        WHERE id = $1
+    `, id)
+	if err != nil {
+		return fmt.Errorf("revoke api key error: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("RowsAffected error: %w", err)
+	}
+	if rowsAffected == 0 {
+		return store.ErrKeyNotFound
+	}
+
+	return nil
+}
+
+func (s Store) ListKeys(ctx context.Context, userID string) ([]store.APIKey, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+        SELECT id, user_id, name, hash, scopes, created_at, revoked_at
+        FROM api_keys
+        WHERE $1 = '' OR user_id = $1
+        ORDER BY created_at
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []store.APIKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// scanKey разбирает строку таблицы api_keys
+func scanKey(row interface{ Scan(dest ...any) error }) (store.APIKey, error) {
+	var (
+		key       store.APIKey
+		scopes    string
+		revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &scopes, &key.CreatedAt, &revokedAt); err != nil {
+		return store.APIKey{}, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,142 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Nastez/shortener/internal/audit"
+)
+
+// Record добавляет записи в таблицу audit_log одной транзакцией
+func (s Store) Record(ctx context.Context, events ...audit.Event) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, e := range events {
+		before, after, details, err := encodeAudit(e)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+            INSERT INTO audit_log (created_at, request_id, actor, action, namespace, url_id, before, after, details)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+            RETURNING id
+        `, e.Time, e.RequestID, e.Actor, e.Action, e.Namespace, e.URLID, before, after, details).Scan(&events[i].ID)
+		if err != nil {
+			return fmt.Errorf("audit insert error: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Query возвращает записи audit_log по условиям q в порядке id
+func (s Store) Query(ctx context.Context, q audit.Query) ([]audit.Event, error) {
+	namespace := sql.NullString{}
+	if q.Namespace != nil {
+		namespace = sql.NullString{String: *q.Namespace, Valid: true}
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `
+        SELECT
+            id,
+            created_at,
+            request_id,
+            actor,
+            action,
+            namespace,
+            url_id,
+            before,
+            after,
+            details
+        FROM audit_log
+        WHERE
+            ($1::timestamptz IS NULL OR created_at >= $1)
+            AND ($2::timestamptz IS NULL OR created_at < $2)
+            AND ($3::text IS NULL OR namespace = $3)
+            AND ($4 = '' OR url_id = $4)
+            AND ($5 = '' OR actor = $5)
+            AND ($6 = '' OR action = $6)
+            AND id > $7
+        ORDER BY id
+        LIMIT $8
+    `, nullTime(q.From), nullTime(q.To), namespace, q.URLID, q.Actor, q.Action, q.AfterID,
+		sql.NullInt64{Int64: int64(q.Limit), Valid: q.Limit > 0})
+	if err != nil {
+		return nil, fmt.Errorf("audit query error: %w", err)
+	}
+	defer rows.Close()
+
+	var events []audit.Event
+	for rows.Next() {
+		var (
+			e                      audit.Event
+			before, after, details []byte
+		)
+		err = rows.Scan(&e.ID, &e.Time, &e.RequestID, &e.Actor, &e.Action, &e.Namespace, &e.URLID, &before, &after, &details)
+		if err != nil {
+			return nil, err
+		}
+		if err = decodeAudit(&e, before, after, details); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// encodeAudit кодирует состояния и параметры записи в jsonb; пустые значения хранятся как NULL
+func encodeAudit(e audit.Event) (before, after, details []byte, err error) {
+	if e.Before != nil {
+		if before, err = json.Marshal(e.Before); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if e.After != nil {
+		if after, err = json.Marshal(e.After); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(e.Details) > 0 {
+		if details, err = json.Marshal(e.Details); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return before, after, details, nil
+}
+
+func decodeAudit(e *audit.Event, before, after, details []byte) error {
+	if before != nil {
+		e.Before = &audit.Link{}
+		if err := json.Unmarshal(before, e.Before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		e.After = &audit.Link{}
+		if err := json.Unmarshal(after, e.After); err != nil {
+			return err
+		}
+	}
+	if details != nil {
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nullTime передаёт нулевое время как NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,64 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/audit"
+)
+
+func TestAuditQuery(t *testing.T) {
+	s, _ := openTest(t)
+	ctx := context.Background()
+
+	id := fmt.Sprintf("audit-%d", testRun)
+	namespace := ""
+	start := time.Now().UTC().Truncate(time.Microsecond)
+
+	events := make([]audit.Event, 0, 5)
+	for i := range 5 {
+		events = append(events, audit.Event{
+			Time:    start.Add(time.Duration(i) * time.Second),
+			Actor:   "user:alice",
+			Action:  audit.ActionUpdate,
+			URLID:   id,
+			Before:  &audit.Link{OriginalURL: "https://yoga.org", Version: int64(i + 1)},
+			After:   &audit.Link{OriginalURL: "https://yoga.org", Version: int64(i + 2)},
+			Details: map[string]string{"reason": "edit"},
+		})
+	}
+	require.NoError(t, s.Record(ctx, events...))
+	for i := 1; i < len(events); i++ {
+		assert.Greater(t, events[i].ID, events[i-1].ID, "ids grow in insertion order")
+	}
+
+	// страницы по два события продолжаются с номера последнего события
+	var versions []int64
+	q := audit.Query{Namespace: &namespace, URLID: id, Limit: 2}
+	for {
+		page, err := s.Query(ctx, q)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		require.LessOrEqual(t, len(page), 2)
+		for _, e := range page {
+			versions = append(versions, e.Before.Version)
+		}
+		q.AfterID = page[len(page)-1].ID
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, versions)
+
+	// полуинтервал [From, To) отбирает второе и третье событие
+	page, err := s.Query(ctx, audit.Query{URLID: id, From: start.Add(time.Second), To: start.Add(3 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, events[1].ID, page[0].ID)
+	assert.Equal(t, map[string]string{"reason": "edit"}, page[0].Details)
+	assert.Equal(t, events[1].After, page[0].After)
+}
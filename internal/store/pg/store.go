@@ -3,88 +3,243 @@ package pg
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
 	"github.com/Nastez/shortener/internal/app/models"
-	"github.com/Nastez/shortener/internal/logger"
 	"github.com/Nastez/shortener/internal/store"
+	"github.com/Nastez/shortener/internal/storeconfig"
 )
 
 // Store реализует интерфейс store.Store и позволяет взаимодействовать с СУБД PostgreSQL
 type Store struct {
 	// Поле conn содержит объект соединения с СУБД
 	conn *sql.DB
+	// stmts — запросы горячего пути, подготовленные один раз при создании хранилища
+	stmts *statements
 }
 
-// NewStore возвращает новый экземпляр PostgreSQL-хранилища
-func NewStore(conn *sql.DB) *Store {
-	return &Store{conn: conn}
+// statements — подготовленные запросы; database/sql сам подготавливает их
+// на каждом соединении пула при первом использовании
+type statements struct {
+	get         *sql.Stmt
+	save        *sql.Stmt
+	insertBatch *sql.Stmt
 }
 
-func (s Store) Get(ctx context.Context, id string) (string, error) {
-	// запрашиваем originalURL по сгенерированному id
-	row := s.conn.QueryRowContext(ctx, `
+const (
+	// destinationsColumn собирает варианты ссылки из url_destinations в JSON-массив
+	destinationsColumn = `
+            COALESCE((
+                SELECT json_agg(json_build_object(
+                    'variant', d.variant,
+                    'url', d.destination,
+                    'weight', d.weight,
+                    'clicks', d.clicks
+                ) ORDER BY d.position)
+                FROM url_destinations d
+                WHERE d.namespace = urls.namespace AND d.url_id = urls.url_id
+            ), '[]')`
+	getQuery = `
         SELECT
-            original_url
+            original_url,
+            user_id,
+            is_deleted,
+            is_disabled,
+            redirect_mode,
+            cache_max_age,
+            expires_at,
+            version,
+            query_passthrough,
+            rules,` + destinationsColumn + `
         FROM urls 
         WHERE
-            url_id = $1
-    `,
-		id,
-	)
+            namespace = $1 AND url_id = $2
+    `
+	// saveQuery вставляет запись или возвращает уже существующую с тем же original_url.
+	// DO UPDATE, в отличие от DO NOTHING, блокирует конкурирующую строку и возвращает её
+	// даже при одновременной вставке того же URL; фиктивное обновление не меняет данных.
+	// xmax = 0 только у строки, созданной этим запросом. Варианты из JSON-массива $8
+	// вставляются тем же запросом и только для новой ссылки, правила $9 — вместе с ней.
+	saveQuery = `
+        WITH link AS (
+            INSERT INTO urls (namespace, original_url, url_id, user_id, redirect_mode, cache_max_age, query_passthrough, rules)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $9)
+            ON CONFLICT (namespace, original_url) DO UPDATE
+            SET original_url = EXCLUDED.original_url
+            RETURNING url_id, xmax = 0 AS inserted
+        ), variants AS (
+            INSERT INTO url_destinations (namespace, url_id, variant, position, destination, weight)
+            SELECT $1, link.url_id, d.value->>'variant', d.position - 1, d.value->>'url', (d.value->>'weight')::integer
+            FROM link, json_array_elements($8::json) WITH ORDINALITY AS d(value, position)
+            WHERE link.inserted
+        )
+        SELECT url_id, inserted FROM link
+    `
+	insertBatchQuery = "INSERT INTO urls (namespace, original_url, url_id, user_id, redirect_mode, cache_max_age, query_passthrough, rules) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+)
+
+// NewStore возвращает новый экземпляр PostgreSQL-хранилища и подготавливает запросы
+func NewStore(ctx context.Context, conn *sql.DB) (*Store, error) {
+	s := &Store{conn: conn, stmts: &statements{}}
+
+	for _, q := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{stmt: &s.stmts.get, query: getQuery},
+		{stmt: &s.stmts.save, query: saveQuery},
+		{stmt: &s.stmts.insertBatch, query: insertBatchQuery},
+	} {
+		stmt, err := conn.PrepareContext(ctx, q.query)
+		if err != nil {
+			s.stmts.close()
+			return nil, fmt.Errorf("can't prepare statement: %w", err)
+		}
+		*q.stmt = stmt
+	}
+
+	return s, nil
+}
+
+func (st *statements) close() {
+	for _, stmt := range []*sql.Stmt{st.get, st.save, st.insertBatch} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+func init() {
+	store.Register(store.BackendPostgres, func(ctx context.Context, opts store.Options) (store.Backend, error) {
+		return Open(ctx, opts.Postgres)
+	})
+}
+
+// Open подключается к СУБД и подготавливает схему
+func Open(ctx context.Context, opts store.PostgresOptions) (*Store, error) {
+	if opts.DSN == "" {
+		return nil, errors.New("database dsn is empty")
+	}
+
+	conn, err := sql.Open("pgx", opts.DSN)
+	if err != nil {
+		return nil, err
+	}
+	applyPool(conn, opts.Pool)
+
+	if err = storeconfig.NewStoreConfig(conn).Bootstrap(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("can't bootstrap database: %w", err)
+	}
+
+	s, err := NewStore(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// applyPool настраивает пул соединений conn
+func applyPool(conn *sql.DB, opts store.PoolOptions) {
+	if opts.MaxOpenConns > 0 {
+		conn.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		conn.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		conn.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// Close закрывает подготовленные запросы и соединения с СУБД
+func (s Store) Close() error {
+	s.stmts.close()
+	return s.conn.Close()
+}
+
+func (s Store) Get(ctx context.Context, namespace, id string) (store.URL, error) {
+	// запрашиваем originalURL по сгенерированному id
+	row := s.stmts.get.QueryRowContext(ctx, namespace, id)
 
 	// считываем значения из записи БД в соответствующие поля структуры
-	var originalURL string
-	err := row.Scan(&originalURL) // разбираем результат
+	url := store.URL{Namespace: namespace, GeneratedID: id}
+	var userID sql.NullString
+	var cacheMaxAge sql.NullInt32
+	var expiresAt sql.NullTime
+	var rules, destinations []byte
+	err := row.Scan(&url.OriginalURL, &userID, &url.DeletedFlag, &url.Disabled, &url.RedirectMode, &cacheMaxAge, &expiresAt, &url.Version, &url.QueryMode, &rules, &destinations) // разбираем результат
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.URL{}, store.ErrNotFound
+	}
 	if err != nil {
-		return "", err
+		return store.URL{}, err
+	}
+	setNullable(&url, userID, cacheMaxAge, expiresAt)
+	if err = setRules(&url, rules); err != nil {
+		return store.URL{}, err
+	}
+	if err = setDestinations(&url, destinations); err != nil {
+		return store.URL{}, err
 	}
 
-	return originalURL, nil
+	if url.DeletedFlag {
+		return store.URL{}, store.ErrDeleted
+	}
+	if url.Disabled {
+		return store.URL{}, store.ErrDisabled
+	}
+	if url.Expired(time.Now()) {
+		return store.URL{}, store.ErrExpired
+	}
+
+	return url, nil
 }
 
 func (s Store) Save(ctx context.Context, urls store.URL) (string, error) {
-	// добавляем новую запись с URLs в БД
-	res, err := s.conn.ExecContext(ctx, `
-        INSERT INTO urls (original_url, short_url, url_id)
-        VALUES ($1, $2, $3)
-        ON CONFLICT (original_url) DO NOTHING
-    `, urls.OriginalURL, urls.ShortURL, urls.GeneratedID)
+	// добавляем новую запись с URLs в БД одним запросом вместе с проверкой конфликта
+	destinations, err := destinationsValue(urls.Destinations)
 	if err != nil {
-		return "", fmt.Errorf("insert error: %w", err)
+		return "", err
 	}
-
-	rowsAffected, err := res.RowsAffected()
+	rules, err := rulesValue(urls.Rules)
 	if err != nil {
-		return "", fmt.Errorf("RowsAffected error: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		// проверяем, что ошибка сигнализирует о потенциальном нарушении целостности данных
-		dataConflictErr := store.ErrConflict
-		row := s.conn.QueryRowContext(ctx, `
-			   SELECT
-			       short_url
-			   FROM urls
-			   WHERE
-			       original_url = $1
-			`,
-			urls.OriginalURL,
-		)
-		// считываем значения из записи БД в соответствующие поля структуры
-		var oldShortURL string
-		err = row.Scan(&oldShortURL) // разбираем результат
-		if err != nil {
-			logger.Log.Error("scan error")
-		}
+		return "", err
+	}
 
-		return oldShortURL, dataConflictErr
+	var (
+		id       string
+		inserted bool
+	)
+	err = s.stmts.save.QueryRowContext(ctx, urls.Namespace, urls.OriginalURL, urls.GeneratedID, urls.UserID, urls.RedirectMode, urls.CacheMaxAge, urls.QueryMode, destinations, rules).
+		Scan(&id, &inserted)
+	if isUniqueViolation(err) {
+		// original_url разрешается через ON CONFLICT, сюда попадает только занятый url_id
+		return "", store.ErrConflict
+	}
+	if err != nil {
+		return "", fmt.Errorf("insert error: %w", err)
+	}
 
+	if !inserted {
+		// URL уже сокращён, возвращаем идентификатор существующей ссылки
+		return id, store.ErrConflict
 	}
 
-	return "", err
+	return "", nil
 }
 
-func (s Store) SaveBatch(ctx context.Context, requestBatch models.PayloadBatch, shortURLBatch models.ResponseBodyBatch) error {
+func (s Store) SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error {
 	// запускаем транзакцию
 	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
@@ -94,34 +249,134 @@ func (s Store) SaveBatch(ctx context.Context, requestBatch models.PayloadBatch,
 	// в случае неуспешного коммита все изменения транзакции будут отменены
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx,
-		"INSERT INTO urls (short_url, url_id) VALUES ($1, $2)")
-	if err != nil {
-		return err
-	}
+	// подготовленный при старте запрос привязывается к соединению транзакции
+	stmt := tx.StmtContext(ctx, s.stmts.insertBatch)
 	defer stmt.Close()
 
-	stmtOriginalURL, err := tx.PrepareContext(ctx,
-		"UPDATE urls SET original_url = $1 WHERE url_id = $2")
-	if err != nil {
-		return err
-	}
-	defer stmtOriginalURL.Close()
-
-	for _, b := range shortURLBatch {
-		_, err = stmt.ExecContext(ctx, b.ShortURL, b.CorrelationID)
+	for _, req := range requestBatch {
+		url := store.BatchURL(namespace, userID, req)
+		rules, err := rulesValue(url.Rules)
 		if err != nil {
 			return err
 		}
-		for _, req := range requestBatch {
-			_, err = stmtOriginalURL.ExecContext(ctx, req.OriginalURL, req.CorrelationID)
-			if err != nil {
-				return err
 
-			}
+		_, err = stmt.ExecContext(ctx, namespace, req.OriginalURL, req.CorrelationID, userID, req.RedirectMode, req.CacheMaxAge, req.QueryPassthrough, rules)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		// варианты пишутся в той же транзакции, что и ссылка
+		if len(req.Destinations) == 0 {
+			continue
+		}
+		if _, err = replaceDestinations(ctx, tx, url); err != nil {
+			return err
 		}
 	}
 
 	// коммитим транзакцию
 	return tx.Commit()
 }
+
+func (s Store) GetUserURLs(ctx context.Context, userID string) ([]store.URL, error) {
+	// запрашиваем все неудалённые URL пользователя
+	rows, err := s.conn.QueryContext(ctx, `
+        SELECT
+            namespace,
+            original_url,
+            url_id
+        FROM urls
+        WHERE
+            user_id = $1 AND NOT is_deleted
+    `,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []store.URL
+	for rows.Next() {
+		url := store.URL{UserID: userID}
+		if err = rows.Scan(&url.Namespace, &url.OriginalURL, &url.GeneratedID); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+func (s Store) DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error {
+	// помечаем URL удалёнными, чужие URL не затрагиваются
+	_, err := s.conn.ExecContext(ctx, `
+        UPDATE urls
+        SET is_deleted = true
+        WHERE
+            namespace = $1 AND user_id = $2 AND url_id = ANY($3)
+    `, namespace, userID, ids)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+
+	return nil
+}
+
+// setNullable переносит в url значения столбцов, допускающих NULL
+func setNullable(url *store.URL, userID sql.NullString, cacheMaxAge sql.NullInt32, expiresAt sql.NullTime) {
+	url.UserID = userID.String
+	if cacheMaxAge.Valid {
+		age := int(cacheMaxAge.Int32)
+		url.CacheMaxAge = &age
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		url.ExpiresAt = &t
+	}
+}
+
+// setDestinations разбирает варианты ссылки, собранные destinationsColumn
+func setDestinations(url *store.URL, destinations []byte) error {
+	if err := json.Unmarshal(destinations, &url.Destinations); err != nil {
+		return fmt.Errorf("can't decode destinations: %w", err)
+	}
+	if len(url.Destinations) == 0 {
+		url.Destinations = nil
+	}
+
+	return nil
+}
+
+// setRules разбирает правила перенаправления из столбца rules, NULL — правил нет
+func setRules(url *store.URL, rules []byte) error {
+	url.Rules = nil
+	if len(rules) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(rules, &url.Rules); err != nil {
+		return fmt.Errorf("can't decode rules: %w", err)
+	}
+
+	return nil
+}
+
+// destinationsValue возвращает варианты для saveQuery JSON-массивом, пустой список — NULL
+func destinationsValue(destinations []store.Destination) ([]byte, error) {
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(destinations)
+}
+
+// rulesValue возвращает правила для записи в столбец rules, пустой список хранится как NULL
+func rulesValue(rules []store.Rule) ([]byte, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(rules)
+}
@@ -0,0 +1,134 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Бенчмарки сравнивают database/sql поверх pgx/stdlib с нативным pgxpool на запросах
+// горячего пути:
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run '^$' -bench . ./internal/store/pg/
+
+func openBench(b *testing.B) (*Store, *pgxpool.Pool) {
+	b.Helper()
+
+	s, dsn := openTest(b)
+	pool := store.PoolOptions{MaxOpenConns: 25, MaxIdleConns: 25}
+	applyPool(s.conn, pool)
+
+	ctx := context.Background()
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg.MaxConns = int32(pool.MaxOpenConns)
+	p, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(p.Close)
+
+	return s, p
+}
+
+func BenchmarkGet(b *testing.B) {
+	s, pool := openBench(b)
+	ctx := context.Background()
+
+	id := fmt.Sprintf("bench-get-%d", testRun)
+	_, err := s.Save(ctx, store.URL{OriginalURL: "https://example.com/" + id, GeneratedID: id})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("database/sql/prepared", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := s.Get(ctx, "", id); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("database/sql/adhoc", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				var originalURL string
+				var userID *string
+				var deleted bool
+				var mode string
+				var cacheMaxAge *int32
+				err := s.conn.QueryRowContext(ctx, getQuery, "", id).Scan(&originalURL, &userID, &deleted, &mode, &cacheMaxAge)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("pgxpool", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				var originalURL string
+				var userID *string
+				var deleted bool
+				var mode string
+				var cacheMaxAge *int32
+				err := pool.QueryRow(ctx, getQuery, "", id).Scan(&originalURL, &userID, &deleted, &mode, &cacheMaxAge)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkSave(b *testing.B) {
+	s, pool := openBench(b)
+	ctx := context.Background()
+
+	var seq atomic.Int64
+	next := func(prefix string) string {
+		return fmt.Sprintf("bench-%s-%d-%d", prefix, testRun, seq.Add(1))
+	}
+
+	b.Run("database/sql/prepared", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := next("sql")
+				_, err := s.Save(ctx, store.URL{OriginalURL: "https://example.com/" + id, GeneratedID: id})
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("pgxpool", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := next("pgx")
+				var existingID string
+				var inserted bool
+				err := pool.QueryRow(ctx, saveQuery, "", "https://example.com/"+id, id, "", "", nil, "").Scan(&existingID, &inserted)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// Тесты и бенчмарки пакета работают с настоящей СУБД и пропускаются,
+// если не задана переменная окружения TEST_DATABASE_DSN
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+// testRun отличает данные разных запусков, чтобы не упираться в уникальность original_url
+var testRun = time.Now().UnixNano()
+
+func openTest(tb testing.TB) (*Store, string) {
+	tb.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSNEnv)
+	}
+
+	s, err := Open(context.Background(), store.PostgresOptions{DSN: dsn})
+	require.NoError(tb, err)
+	tb.Cleanup(func() { s.Close() })
+
+	return s, dsn
+}
+
+func TestSaveConcurrent(t *testing.T) {
+	s, _ := openTest(t)
+	ctx := context.Background()
+
+	const writers = 16
+	originalURL := fmt.Sprintf("https://example.com/concurrent-%d", testRun)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		inserted  []string
+		conflicts []string
+	)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id := fmt.Sprintf("concurrent-%d-%d", testRun, i)
+			existingID, err := s.Save(ctx, store.URL{OriginalURL: originalURL, GeneratedID: id})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				inserted = append(inserted, id)
+			case errors.Is(err, store.ErrConflict):
+				conflicts = append(conflicts, existingID)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// ровно одна вставка, остальные получают её идентификатор
+	require.Len(t, inserted, 1)
+	require.Len(t, conflicts, writers-1)
+	for _, id := range conflicts {
+		assert.Equal(t, inserted[0], id)
+	}
+}
+
+func TestSaveDuplicateID(t *testing.T) {
+	s, _ := openTest(t)
+	ctx := context.Background()
+
+	id := fmt.Sprintf("dup-%d", testRun)
+	_, err := s.Save(ctx, store.URL{OriginalURL: fmt.Sprintf("https://example.com/dup-%d-a", testRun), GeneratedID: id})
+	require.NoError(t, err)
+
+	// тот же url_id для другого адреса нарушает уникальный индекс пространства имён
+	existingID, err := s.Save(ctx, store.URL{OriginalURL: fmt.Sprintf("https://example.com/dup-%d-b", testRun), GeneratedID: id})
+	assert.ErrorIs(t, err, store.ErrConflict)
+	assert.Empty(t, existingID)
+
+	err = s.SaveBatch(ctx, "", "", models.PayloadBatch{
+		{CorrelationID: id + "-batch", OriginalURL: fmt.Sprintf("https://example.com/dup-%d-c", testRun)},
+		{CorrelationID: id + "-batch", OriginalURL: fmt.Sprintf("https://example.com/dup-%d-d", testRun)},
+	})
+	assert.ErrorIs(t, err, store.ErrConflict)
+	_, err = s.Get(ctx, "", id+"-batch")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
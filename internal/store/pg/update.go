@@ -0,0 +1,152 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Nastez/shortener/internal/store"
+)
+
+// uniqueViolation — код ошибки PostgreSQL при нарушении уникального индекса
+const uniqueViolation = "23505"
+
+// isUniqueViolation сообщает, нарушает ли запрос уникальный индекс
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func (s Store) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	rules, err := rulesValue(url.Rules)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return store.URL{}, err
+	}
+	defer tx.Rollback()
+
+	// версия сравнивается и увеличивается одним запросом, поэтому из двух одновременных
+	// изменений одной версии применится только одно
+	row := tx.QueryRowContext(ctx, `
+        UPDATE urls
+        SET
+            original_url = $4,
+            redirect_mode = $5,
+            expires_at = $6,
+            rules = $8,
+            query_passthrough = $9,
+            version = version + 1
+        WHERE
+            namespace = $1 AND url_id = $2 AND user_id = $3 AND NOT is_deleted AND version = $7
+        RETURNING is_disabled, cache_max_age, version
+    `, url.Namespace, url.GeneratedID, url.UserID, url.OriginalURL, url.RedirectMode, url.ExpiresAt, url.Version, rules, url.QueryMode)
+
+	updated := url
+	var cacheMaxAge sql.NullInt32
+	err = row.Scan(&updated.Disabled, &cacheMaxAge, &updated.Version)
+	if isUniqueViolation(err) {
+		return store.URL{}, store.ErrConflict
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.URL{}, s.updateMiss(ctx, url)
+	}
+	if err != nil {
+		return store.URL{}, fmt.Errorf("update error: %w", err)
+	}
+	updated.CacheMaxAge = nil
+	if cacheMaxAge.Valid {
+		age := int(cacheMaxAge.Int32)
+		updated.CacheMaxAge = &age
+	}
+
+	if updated.Destinations, err = replaceDestinations(ctx, tx, url); err != nil {
+		return store.URL{}, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// replaceDestinations заменяет варианты ссылки, сохраняя счётчики одноимённых вариантов
+func replaceDestinations(ctx context.Context, tx *sql.Tx, url store.URL) ([]store.Destination, error) {
+	variants := make([]string, 0, len(url.Destinations))
+	for _, d := range url.Destinations {
+		variants = append(variants, d.Variant)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+        DELETE FROM url_destinations
+        WHERE
+            namespace = $1 AND url_id = $2 AND NOT variant = ANY($3)
+    `, url.Namespace, url.GeneratedID, variants)
+	if err != nil {
+		return nil, fmt.Errorf("delete destinations error: %w", err)
+	}
+
+	destinations := make([]store.Destination, 0, len(url.Destinations))
+	for i, d := range url.Destinations {
+		err = tx.QueryRowContext(ctx, `
+            INSERT INTO url_destinations (namespace, url_id, variant, position, destination, weight)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (namespace, url_id, variant) DO UPDATE
+            SET position = EXCLUDED.position, destination = EXCLUDED.destination, weight = EXCLUDED.weight
+            RETURNING clicks
+        `, url.Namespace, url.GeneratedID, d.Variant, i, d.URL, d.Weight).Scan(&d.Clicks)
+		if err != nil {
+			return nil, fmt.Errorf("insert destination error: %w", err)
+		}
+		destinations = append(destinations, d)
+	}
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	return destinations, nil
+}
+
+// updateMiss объясняет, почему UpdateURL не изменил ни одной строки
+func (s Store) updateMiss(ctx context.Context, url store.URL) error {
+	var version int64
+	err := s.conn.QueryRowContext(ctx, `
+        SELECT version
+        FROM urls
+        WHERE
+            namespace = $1 AND url_id = $2 AND user_id = $3 AND NOT is_deleted
+    `, url.Namespace, url.GeneratedID, url.UserID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return store.ErrVersionMismatch
+}
+
+func (s Store) CountClick(ctx context.Context, ref store.URLRef, variant string) error {
+	res, err := s.conn.ExecContext(ctx, `
+        UPDATE url_destinations
+        SET clicks = clicks + 1
+        WHERE
+            namespace = $1 AND url_id = $2 AND variant = $3
+    `, ref.Namespace, ref.ID, variant)
+	if err != nil {
+		return fmt.Errorf("count click error: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
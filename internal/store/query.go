@@ -0,0 +1,28 @@
+package store
+
+import "errors"
+
+// ErrInvalidQueryMode указывает на неизвестный режим передачи параметров запроса
+var ErrInvalidQueryMode = errors.New("invalid query passthrough mode, must be one of override, keep")
+
+// QueryMode описывает, что делать с параметрами запроса к короткой ссылке при перенаправлении
+type QueryMode string
+
+const (
+	// QueryDrop отбрасывает параметры запроса, режим по умолчанию
+	QueryDrop QueryMode = ""
+	// QueryOverride добавляет параметры запроса к адресу назначения, заменяя одноимённые
+	QueryOverride QueryMode = "override"
+	// QueryKeep добавляет только параметры, которых ещё нет в адресе назначения
+	QueryKeep QueryMode = "keep"
+)
+
+// ParseQueryMode проверяет режим передачи параметров, пришедший от клиента
+func ParseQueryMode(mode string) (QueryMode, error) {
+	switch m := QueryMode(mode); m {
+	case QueryDrop, QueryOverride, QueryKeep:
+		return m, nil
+	}
+
+	return "", ErrInvalidQueryMode
+}
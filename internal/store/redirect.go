@@ -0,0 +1,75 @@
+package store
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrInvalidRedirectMode указывает на неизвестный режим перенаправления
+var ErrInvalidRedirectMode = errors.New("invalid redirect mode, must be one of 301, 302, 307, 308, interstitial")
+
+// RedirectMode описывает, как короткая ссылка перенаправляет на оригинальный URL
+type RedirectMode string
+
+const (
+	// RedirectDefault — режим сервера по умолчанию
+	RedirectDefault          RedirectMode = ""
+	RedirectMovedPermanently RedirectMode = "301"
+	RedirectFound            RedirectMode = "302"
+	RedirectTemporary        RedirectMode = "307"
+	RedirectPermanent        RedirectMode = "308"
+	// RedirectInterstitial показывает страницу с адресом назначения вместо перенаправления
+	RedirectInterstitial RedirectMode = "interstitial"
+)
+
+// DefaultCacheMaxAge — время кэширования постоянных перенаправлений по умолчанию, 30 дней
+const DefaultCacheMaxAge = 30 * 24 * 60 * 60
+
+// ParseRedirectMode проверяет режим перенаправления, пришедший от клиента
+func ParseRedirectMode(mode string) (RedirectMode, error) {
+	switch m := RedirectMode(mode); m {
+	case RedirectDefault, RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent, RedirectInterstitial:
+		return m, nil
+	}
+
+	return "", ErrInvalidRedirectMode
+}
+
+// StatusCode возвращает код ответа для прямого перенаправления
+func (m RedirectMode) StatusCode() int {
+	switch m {
+	case RedirectMovedPermanently:
+		return http.StatusMovedPermanently
+	case RedirectFound:
+		return http.StatusFound
+	case RedirectPermanent:
+		return http.StatusPermanentRedirect
+	}
+
+	return http.StatusTemporaryRedirect
+}
+
+// IsPermanent сообщает, что перенаправление постоянное и может кэшироваться браузером
+func (m RedirectMode) IsPermanent() bool {
+	return m == RedirectMovedPermanently || m == RedirectPermanent
+}
+
+// CacheControl возвращает заголовок Cache-Control для перенаправления.
+// Время кэширования ссылки имеет приоритет, 0 запрещает кэширование.
+// Без него постоянные перенаправления кэшируются на defaultMaxAge секунд,
+// а временные не кэшируются, чтобы каждый переход доходил до сервера.
+func (m RedirectMode) CacheControl(maxAge *int, defaultMaxAge int) string {
+	age := 0
+	if maxAge != nil {
+		age = *maxAge
+	} else if m.IsPermanent() {
+		age = defaultMaxAge
+	}
+
+	if age <= 0 {
+		return "no-store"
+	}
+
+	return "public, max-age=" + strconv.Itoa(age)
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nastez/shortener/internal/audit"
+)
+
+// Имена встроенных хранилищ
+const (
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+	BackendPostgres = "postgres"
+)
+
+// Backend — хранилище ссылок, ключей API и журнала аудита, которое нужно закрыть при остановке сервера
+type Backend interface {
+	Store
+	KeyStore
+	audit.Log
+	io.Closer
+}
+
+// Options — параметры всех хранилищ; каждое хранилище читает только свою часть
+type Options struct {
+	File     FileOptions
+	Postgres PostgresOptions
+}
+
+// FileOptions — параметры хранилища в памяти с сохранением в файл
+type FileOptions struct {
+	// Path — файл журнала событий в формате JSON Lines
+	Path string
+}
+
+// PostgresOptions — параметры хранилища PostgreSQL
+type PostgresOptions struct {
+	DSN  string
+	Pool PoolOptions
+}
+
+// PoolOptions — параметры пула соединений; нулевые значения оставляют настройки database/sql
+type PoolOptions struct {
+	// MaxOpenConns — наибольшее число открытых соединений
+	MaxOpenConns int
+	// MaxIdleConns — число простаивающих соединений, которые пул держит открытыми
+	MaxIdleConns int
+	// ConnMaxLifetime — время, после которого соединение закрывается и открывается заново
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime — время простоя, после которого соединение закрывается
+	ConnMaxIdleTime time.Duration
+}
+
+// Factory создаёт хранилище по параметрам
+type Factory func(ctx context.Context, opts Options) (Backend, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register делает хранилище доступным по имени; вызывается из init пакета хранилища
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic("store: Register called twice for backend " + name)
+	}
+	factories[name] = factory
+}
+
+// Open создаёт зарегистрированное хранилище по имени
+func Open(ctx context.Context, name string, opts Options) (Backend, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q (registered: %s)", name, strings.Join(Backends(), ", "))
+	}
+
+	return factory(ctx, opts)
+}
+
+// Backends возвращает отсортированные имена зарегистрированных хранилищ
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -4,21 +4,177 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
+
 	"github.com/Nastez/shortener/internal/app/models"
 )
 
 // ErrConflict указывает на конфликт данных в хранилище.
 var ErrConflict = errors.New("data conflict")
 
-// Store описывает абстрактное хранилище сообщений пользователей
+// ErrDeleted указывает на то, что запрошенный URL удалён пользователем.
+var ErrDeleted = errors.New("url is deleted")
+
+// ErrDisabled указывает на то, что URL отключён модератором.
+// Для клиентов отключённый URL выглядит удалённым: errors.Is(ErrDisabled, ErrDeleted).
+var ErrDisabled = fmt.Errorf("%w: disabled by moderator", ErrDeleted)
+
+// ErrExpired указывает на то, что срок действия URL истёк.
+// Для клиентов истёкший URL тоже выглядит удалённым: errors.Is(ErrExpired, ErrDeleted).
+var ErrExpired = fmt.Errorf("%w: expired", ErrDeleted)
+
+// ErrNotFound указывает на то, что URL нет в хранилище.
+var ErrNotFound = errors.New("url not found")
+
+// ErrVersionMismatch указывает на то, что URL изменили после того, как клиент прочитал его версию.
+var ErrVersionMismatch = errors.New("url version mismatch")
+
+// Store описывает абстрактное хранилище сообщений пользователей.
+// Идентификаторы ссылок уникальны в пределах пространства имён домена,
+// пустое пространство имён принадлежит домену по умолчанию.
 type Store interface {
-	Get(ctx context.Context, id string) (string, error)
+	// Get возвращает действующую ссылку; ErrNotFound — ссылки нет,
+	// ErrDeleted (в том числе ErrDisabled и ErrExpired) — она больше не работает
+	Get(ctx context.Context, namespace, id string) (URL, error)
+	// Save сохраняет URL; если такой original_url уже сокращён в пространстве имён url,
+	// возвращает идентификатор существующей записи и ErrConflict.
+	// ErrConflict с пустым идентификатором — url.GeneratedID уже занят другой ссылкой
 	Save(ctx context.Context, url URL) (string, error)
-	SaveBatch(ctx context.Context, requestBatch models.PayloadBatch, shortURLBatch models.ResponseBodyBatch) error
+	// SaveBatch сохраняет пакет URL, идентификатором служит correlation_id;
+	// ErrConflict — идентификатор уже занят или повторяется в пакете, пакет не сохраняется
+	SaveBatch(ctx context.Context, namespace, userID string, requestBatch models.PayloadBatch) error
+	// GetUserURLs возвращает URL пользователя из всех пространств имён
+	GetUserURLs(ctx context.Context, userID string) ([]URL, error)
+	DeleteURLs(ctx context.Context, namespace, userID string, ids []string) error
+	// SearchURLs возвращает ссылки всех пользователей по фильтру, включая удалённые
+	// и отключённые, в порядке namespace, url_id
+	SearchURLs(ctx context.Context, filter URLFilter) ([]URL, error)
+	// SetDisabled отключает или включает ссылки и возвращает те из refs, что нашлись
+	SetDisabled(ctx context.Context, refs []URLRef, disabled bool) ([]URLRef, error)
+	// ReassignURL передаёт ссылку пользователю userID, ErrNotFound — ссылки нет
+	ReassignURL(ctx context.Context, ref URLRef, userID string) error
+	// UpdateURL заменяет адрес назначения, варианты, режим перенаправления и срок действия неудалённой ссылки
+	// пользователя url.UserID, если её версия всё ещё равна url.Version, и возвращает ссылку с новой версией.
+	// Версия сравнивается всегда; клиент, отказавшийся от проверки (If-Match: *), передаёт сюда
+	// версию, только что прочитанную services.UpdateURL.
+	// Счётчики переходов вариантов, оставшихся под тем же именем, сохраняются.
+	// ErrNotFound — ссылки нет, ErrVersionMismatch — её уже изменили,
+	// ErrConflict — такой адрес назначения уже сокращён в пространстве имён
+	UpdateURL(ctx context.Context, url URL) (URL, error)
+	// CountClick учитывает переход по варианту variant ссылки с несколькими адресами назначения
+	CountClick(ctx context.Context, ref URLRef, variant string) error
 }
 
+// URLRef — ссылка на URL в пространстве имён домена
+type URLRef struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+}
+
+// URLFilter — условия поиска ссылок; пустые поля не ограничивают выборку
+type URLFilter struct {
+	// Host — хост адреса назначения без учёта регистра
+	Host   string
+	UserID string
+	// Disabled, если задан, оставляет только отключённые или только включённые ссылки
+	Disabled *bool
+	// Refs, если заданы, ограничивают выборку этими ссылками
+	Refs []URLRef
+	// After — последняя ссылка предыдущей страницы
+	After URLRef
+	Limit int
+}
+
+// URL — сокращённая ссылка. Хранилище не знает базовый адрес сервиса:
+// короткий URL собирается из GeneratedID при выдаче ответа.
 type URL struct {
+	// Namespace — пространство имён домена, которому принадлежит ссылка
+	Namespace   string
 	OriginalURL string
-	ShortURL    string
 	GeneratedID string
+	UserID      string
+	DeletedFlag bool
+	// Disabled — ссылка отключена модератором
+	Disabled     bool
+	RedirectMode RedirectMode
+	// CacheMaxAge — время кэширования перенаправления в секундах, nil — политика сервера
+	CacheMaxAge *int
+	// ExpiresAt — момент, после которого ссылка перестаёт работать, nil — бессрочная ссылка
+	ExpiresAt *time.Time
+	// Version — номер редакции ссылки: 1 при создании, растёт с каждым изменением
+	Version int64
+	// Destinations, если заданы, делят переходы между адресами по весам вместо OriginalURL
+	Destinations []Destination
+	// QueryMode — перенос параметров запроса к короткой ссылке в адрес назначения
+	QueryMode QueryMode
+	// Rules проверяются по порядку до выбора адреса: первое сработавшее правило задаёт адрес
+	// перехода, если ни одно не сработало, действуют Destinations или OriginalURL
+	Rules []Rule
+}
+
+// Destination — вариант ссылки с несколькими адресами назначения
+type Destination struct {
+	// Variant — имя варианта, уникально в пределах ссылки и запоминается клиенту в cookie
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+	// Weight — доля переходов варианта относительно суммы весов всех вариантов
+	Weight int `json:"weight"`
+	// Clicks — число переходов, отданных варианту
+	Clicks int64 `json:"clicks"`
+}
+
+// Rule — правило перенаправления: переход ведёт на URL, если признак запроса Field
+// совпадает с одним из значений Values
+type Rule struct {
+	// Field — проверяемый признак: language, device, cidr или country
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+	URL    string   `json:"url"`
+}
+
+// Expired сообщает, истёк ли срок действия ссылки к моменту now
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// BatchURL возвращает ссылку, которую создаёт элемент пакета req
+func BatchURL(namespace, userID string, req models.RequestBatch) URL {
+	var destinations []Destination
+	for _, d := range req.Destinations {
+		destinations = append(destinations, Destination{Variant: d.Variant, URL: d.URL, Weight: d.Weight})
+	}
+	var rules []Rule
+	for _, r := range req.Rules {
+		rules = append(rules, Rule(r))
+	}
+
+	return URL{
+		Namespace:    namespace,
+		OriginalURL:  req.OriginalURL,
+		GeneratedID:  req.CorrelationID,
+		UserID:       userID,
+		RedirectMode: RedirectMode(req.RedirectMode),
+		CacheMaxAge:  req.CacheMaxAge,
+		QueryMode:    QueryMode(req.QueryPassthrough),
+		Version:      1,
+		Destinations: destinations,
+		Rules:        rules,
+	}
+}
+
+// KeepClicks возвращает варианты next со счётчиками переходов одноимённых вариантов из prev
+func KeepClicks(prev, next []Destination) []Destination {
+	clicks := make(map[string]int64, len(prev))
+	for _, d := range prev {
+		clicks[d.Variant] = d.Clicks
+	}
+
+	merged := make([]Destination, 0, len(next))
+	for _, d := range next {
+		d.Clicks = clicks[d.Variant]
+		merged = append(merged, d)
+	}
+
+	return merged
 }
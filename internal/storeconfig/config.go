@@ -3,6 +3,7 @@ package storeconfig
 import (
 	"context"
 	"database/sql"
+	"fmt"
 )
 
 // StoreConfig реализует интерфейс store.Store и позволяет взаимодействовать с СУБД PostgreSQL
@@ -27,16 +28,140 @@ func (s StoreConfig) Bootstrap(ctx context.Context) error {
 	defer tx.Rollback()
 
 	// создаём таблицу urls и необходимые индексы
-	tx.ExecContext(ctx, `
+	_, err = tx.ExecContext(ctx, `
        CREATE TABLE if NOT EXISTS urls (
            id SERIAL PRIMARY KEY,
-           original_url text UNIQUE,
-           short_url text,
+           original_url text,
            url_id text
        )
     `)
+	if err != nil {
+		return fmt.Errorf("can't create urls: %w", err)
+	}
+
+	// ошибка любого шага прерывает транзакцию, поэтому каждую возвращаем сразу,
+	// а не получаем позже как "current transaction is aborted"
+	for _, column := range []string{
+		`user_id text`,
+		`is_deleted boolean NOT NULL DEFAULT false`,
+		`redirect_mode text NOT NULL DEFAULT ''`,
+		`cache_max_age integer`,
+		`is_disabled boolean NOT NULL DEFAULT false`,
+		`expires_at timestamptz`,
+		`version bigint NOT NULL DEFAULT 1`,
+		`rules jsonb`,
+		`query_passthrough text NOT NULL DEFAULT ''`,
+	} {
+		if _, err = tx.ExecContext(ctx, `ALTER TABLE urls ADD COLUMN IF NOT EXISTS `+column); err != nil {
+			return fmt.Errorf("can't add column %q to urls: %w", column, err)
+		}
+	}
+
+	// короткий URL больше не хранится, а собирается из url_id и текущего базового адреса:
+	// переносим идентификатор из short_url в строках, где url_id не заполнен, и удаляем столбец
+	_, err = tx.ExecContext(ctx, `
+       DO $$
+       BEGIN
+           IF EXISTS (
+               SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'urls' AND column_name = 'short_url'
+           ) THEN
+               UPDATE urls
+               SET url_id = substring(short_url FROM '[^/]+$')
+               WHERE (url_id IS NULL OR url_id = '') AND short_url IS NOT NULL;
+
+               ALTER TABLE urls DROP COLUMN short_url;
+           END IF;
+       END
+       $$
+    `)
+	if err != nil {
+		return fmt.Errorf("can't migrate short_url to url_id: %w", err)
+	}
+
+	// ссылки принадлежат пространству имён домена, пустое — домену по умолчанию;
+	// original_url и url_id уникальны в пределах пространства имён
+	for _, query := range []string{
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS namespace text NOT NULL DEFAULT ''`,
+		`ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS namespace_original_url_idx ON urls (namespace, original_url)`,
+		`DROP INDEX IF EXISTS url_idx`,
+		`DROP INDEX IF EXISTS namespace_url_idx`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS namespace_url_id_idx ON urls (namespace, url_id)`,
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("can't add namespace to urls: %w", err)
+		}
+	}
 
-	tx.ExecContext(ctx, `CREATE INDEX url_idx ON urls (url_id)`)
+	if _, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS user_idx ON urls (user_id)`); err != nil {
+		return fmt.Errorf("can't create user_idx: %w", err)
+	}
+
+	// ключи API: хранится только хэш секрета, области действия — через запятую
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS api_keys (
+           id text PRIMARY KEY,
+           user_id text NOT NULL,
+           name text NOT NULL DEFAULT '',
+           hash text NOT NULL,
+           scopes text NOT NULL DEFAULT '',
+           created_at timestamptz NOT NULL DEFAULT now(),
+           revoked_at timestamptz
+       )`,
+		`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id)`,
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("can't create api_keys: %w", err)
+		}
+	}
+
+	// варианты ссылок с несколькими адресами назначения и счётчики их переходов
+	_, err = tx.ExecContext(ctx, `
+       CREATE TABLE IF NOT EXISTS url_destinations (
+           namespace text NOT NULL,
+           url_id text NOT NULL,
+           variant text NOT NULL,
+           position integer NOT NULL,
+           destination text NOT NULL,
+           weight integer NOT NULL CHECK (weight > 0),
+           clicks bigint NOT NULL DEFAULT 0,
+           PRIMARY KEY (namespace, url_id, variant)
+       )
+    `)
+	if err != nil {
+		return fmt.Errorf("can't create url_destinations: %w", err)
+	}
+
+	// журнал аудита только дополняется: изменение и удаление записей запрещены триггером
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (
+           id bigserial PRIMARY KEY,
+           created_at timestamptz NOT NULL,
+           request_id text NOT NULL DEFAULT '',
+           actor text NOT NULL,
+           action text NOT NULL,
+           namespace text NOT NULL,
+           url_id text NOT NULL,
+           before jsonb,
+           after jsonb,
+           details jsonb
+       )`,
+		`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_url_idx ON audit_log (namespace, url_id)`,
+		`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger LANGUAGE plpgsql AS $$
+       BEGIN
+           RAISE EXCEPTION 'audit_log is append-only';
+       END
+       $$`,
+		`DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log`,
+		`CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+       FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("can't create audit_log: %w", err)
+		}
+	}
 
 	// коммитим транзакцию
 	return tx.Commit()
@@ -0,0 +1,112 @@
+// Package utm добавляет к адресу назначения параметры запроса: пришедшие к короткой ссылке
+// при переходе или UTM-метки из шаблона при создании ссылки. Адрес не разбирается целиком,
+// поэтому его путь, фрагмент и кодировка имеющихся параметров не меняются.
+package utm
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// DefaultTemplate — имя шаблона, который добавляется к ссылке, если клиент не выбрал другой
+const DefaultTemplate = "default"
+
+// NoTemplate — имя, которым клиент отказывается от шаблона по умолчанию
+const NoTemplate = "none"
+
+// ErrInvalidTemplate указывает на шаблон, который не разбирается как строка запроса
+var ErrInvalidTemplate = errors.New("utm template must be a query string like utm_source=x&utm_medium=y")
+
+// Merge добавляет к адресу destination параметры из строки запроса query. При override
+// параметры query заменяют одноимённые параметры адреса, иначе адрес сохраняет свои.
+func Merge(destination, query string, override bool) string {
+	incoming := pairs(query)
+	if len(incoming) == 0 {
+		return destination
+	}
+
+	base, fragment, hasFragment := strings.Cut(destination, "#")
+	base, rawQuery, _ := strings.Cut(base, "?")
+	existing := pairs(rawQuery)
+
+	merged := make([]string, 0, len(existing)+len(incoming))
+	for _, p := range existing {
+		if override && contains(incoming, name(p)) {
+			continue
+		}
+		merged = append(merged, p)
+	}
+	for _, p := range incoming {
+		if !override && contains(existing, name(p)) {
+			continue
+		}
+		merged = append(merged, p)
+	}
+
+	if len(merged) > 0 {
+		base += "?" + strings.Join(merged, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+
+	return base
+}
+
+// ValidateTemplate проверяет шаблон UTM-меток
+func ValidateTemplate(template string) error {
+	values, err := url.ParseQuery(Expand(template, ""))
+	if err != nil || len(values) == 0 {
+		return ErrInvalidTemplate
+	}
+	for key := range values {
+		if key == "" {
+			return ErrInvalidTemplate
+		}
+	}
+
+	return nil
+}
+
+// Expand подставляет в шаблон хост короткого домена вместо {domain}
+func Expand(template, domain string) string {
+	return strings.ReplaceAll(template, "{domain}", url.QueryEscape(domain))
+}
+
+// Apply добавляет к адресу destination метки шаблона, не заменяя уже указанные в адресе
+func Apply(destination, template, domain string) string {
+	return Merge(destination, Expand(template, domain), false)
+}
+
+// pairs разбивает строку запроса на пары name=value, пропуская пустые
+func pairs(query string) []string {
+	var out []string
+	for _, p := range strings.Split(query, "&") {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// name возвращает раскодированное имя параметра пары
+func name(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+
+	return key
+}
+
+func contains(pairs []string, key string) bool {
+	for _, p := range pairs {
+		if name(p) == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,43 @@
+package utm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		query       string
+		override    bool
+		want        string
+	}{
+		{name: "no query", destination: "https://example.com/a?x=1", query: "", want: "https://example.com/a?x=1"},
+		{name: "adds query", destination: "https://example.com/a", query: "utm_source=x", want: "https://example.com/a?utm_source=x"},
+		{name: "keeps existing", destination: "https://example.com/a?utm_source=site&b=2", query: "utm_source=x&utm_medium=y", want: "https://example.com/a?utm_source=site&b=2&utm_medium=y"},
+		{name: "overrides existing", destination: "https://example.com/a?utm_source=site&b=2", query: "utm_source=x&utm_medium=y", override: true, want: "https://example.com/a?b=2&utm_source=x&utm_medium=y"},
+		{name: "overrides every value", destination: "https://example.com/?tag=a&tag=b", query: "tag=c", override: true, want: "https://example.com/?tag=c"},
+		{name: "keeps fragment", destination: "https://example.com/a?b=2#top", query: "c=3", want: "https://example.com/a?b=2&c=3#top"},
+		{name: "compares decoded names", destination: "https://example.com/?utm%5Fsource=site", query: "utm_source=x", want: "https://example.com/?utm%5Fsource=site"},
+		{name: "keeps encoding", destination: "https://example.com/%D0%BF%D1%83%D1%82%D1%8C?q=a%20b", query: "r=c+d", want: "https://example.com/%D0%BF%D1%83%D1%82%D1%8C?q=a%20b&r=c+d"},
+		{name: "empty destination query", destination: "https://example.com/?", query: "a=1", want: "https://example.com/?a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Merge(tt.destination, tt.query, tt.override))
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	assert.NoError(t, ValidateTemplate("utm_source=short&utm_medium={domain}"))
+	assert.ErrorIs(t, ValidateTemplate(""), ErrInvalidTemplate)
+	assert.ErrorIs(t, ValidateTemplate("utm_source=%zz"), ErrInvalidTemplate)
+	assert.ErrorIs(t, ValidateTemplate("=x"), ErrInvalidTemplate)
+
+	assert.Equal(t,
+		"https://example.com/?utm_source=site&utm_medium=go.example",
+		Apply("https://example.com/?utm_source=site", "utm_source=short&utm_medium={domain}", "go.example"))
+}
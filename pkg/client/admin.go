@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Nastez/shortener/internal/app/models"
+)
+
+// Модели API модерации
+type (
+	LinkRef          = models.LinkRef
+	AdminURL         = models.AdminURL
+	AdminURLPage     = models.AdminURLPage
+	AdminBulkDisable = models.AdminBulkDisable
+	AdminBulkResult  = models.AdminBulkResult
+	AdminAuditPage   = models.AdminAuditPage
+)
+
+// AdminSearchOptions — отбор ссылок модератором; нулевые значения не ограничивают поиск
+type AdminSearchOptions struct {
+	Host     string
+	UserID   string
+	Disabled *bool
+	// Limit — размер страницы, 0 — размер сервера по умолчанию
+	Limit int
+	// Cursor — NextCursor предыдущей страницы
+	Cursor string
+}
+
+// AdminAuditOptions — отбор записей журнала аудита; нулевые значения не ограничивают выборку
+type AdminAuditOptions struct {
+	// Namespace — пространство имён ссылки, nil — любое
+	Namespace *string
+	ID        string
+	Actor     string
+	Action    string
+	// From и To задают полуинтервал времени [From, To)
+	From time.Time
+	To   time.Time
+	// Limit — размер страницы, 0 — размер сервера по умолчанию
+	Limit int
+	// Cursor — NextCursor предыдущей страницы
+	Cursor string
+}
+
+// AdminSearch ищет ссылки всех пользователей; требует ключ API с областью действия admin
+func (c *Client) AdminSearch(ctx context.Context, opts AdminSearchOptions) (AdminURLPage, error) {
+	query := url.Values{}
+	setQuery(query, "host", opts.Host)
+	setQuery(query, "user_id", opts.UserID)
+	if opts.Disabled != nil {
+		query.Set("disabled", strconv.FormatBool(*opts.Disabled))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	setQuery(query, "cursor", opts.Cursor)
+
+	resp, body, err := c.do(ctx, http.MethodGet, withQuery("/admin/urls", query), nil)
+	if err != nil {
+		return AdminURLPage{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return AdminURLPage{}, statusError(resp, body)
+	}
+
+	var page AdminURLPage
+	err = decode(body, &page)
+	return page, err
+}
+
+// AdminDisable отключает ссылку link, reason попадает в журнал аудита
+func (c *Client) AdminDisable(ctx context.Context, link LinkRef, reason string) error {
+	return c.adminAction(ctx, link, "disable", models.AdminAction{Reason: reason})
+}
+
+// AdminEnable снова включает отключённую ссылку link
+func (c *Client) AdminEnable(ctx context.Context, link LinkRef, reason string) error {
+	return c.adminAction(ctx, link, "enable", models.AdminAction{Reason: reason})
+}
+
+// AdminReassign передаёт ссылку link пользователю userID
+func (c *Client) AdminReassign(ctx context.Context, link LinkRef, userID, reason string) error {
+	return c.adminAction(ctx, link, "reassign", models.AdminReassign{UserID: userID, Reason: reason})
+}
+
+// AdminBulkDisable отключает несколько ссылок одним запросом
+func (c *Client) AdminBulkDisable(ctx context.Context, req AdminBulkDisable) (AdminBulkResult, error) {
+	resp, body, err := c.do(ctx, http.MethodPost, "/admin/urls/disable", req)
+	if err != nil {
+		return AdminBulkResult{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return AdminBulkResult{}, statusError(resp, body)
+	}
+
+	var result AdminBulkResult
+	err = decode(body, &result)
+	return result, err
+}
+
+// AdminAudit возвращает страницу журнала аудита
+func (c *Client) AdminAudit(ctx context.Context, opts AdminAuditOptions) (AdminAuditPage, error) {
+	query := url.Values{}
+	if opts.Namespace != nil {
+		query.Set("namespace", *opts.Namespace)
+	}
+	setQuery(query, "id", opts.ID)
+	setQuery(query, "actor", opts.Actor)
+	setQuery(query, "action", opts.Action)
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.Format(time.RFC3339))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	setQuery(query, "cursor", opts.Cursor)
+
+	resp, body, err := c.do(ctx, http.MethodGet, withQuery("/admin/audit", query), nil)
+	if err != nil {
+		return AdminAuditPage{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return AdminAuditPage{}, statusError(resp, body)
+	}
+
+	var page AdminAuditPage
+	err = decode(body, &page)
+	return page, err
+}
+
+// adminAction выполняет действие модератора action над ссылкой link
+func (c *Client) adminAction(ctx context.Context, link LinkRef, action string, payload any) error {
+	path := "/admin/urls/" + url.PathEscape(link.ID) + "/" + action
+	if link.Namespace != "" {
+		path = withQuery(path, url.Values{"namespace": {link.Namespace}})
+	}
+
+	resp, body, err := c.do(ctx, http.MethodPost, path, payload)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return statusError(resp, body)
+	}
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
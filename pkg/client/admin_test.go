@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/app/models"
+	"github.com/Nastez/shortener/internal/audit"
+)
+
+func TestClientAdmin(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/urls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "disabled=true&host=yoga.org&limit=10", r.URL.RawQuery)
+		json.NewEncoder(w).Encode(models.AdminURLPage{
+			URLs:       []models.AdminURL{{ID: "abc", OriginalURL: "https://yoga.org"}},
+			NextCursor: "next",
+		})
+	})
+	mux.HandleFunc("POST /admin/urls/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "ru", r.URL.Query().Get("namespace"))
+
+		var req models.AdminReassign
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "spam", req.Reason)
+		if r.PathValue("action") == "reassign" {
+			assert.Equal(t, "user-2", req.UserID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /admin/urls/disable", func(w http.ResponseWriter, r *http.Request) {
+		var req models.AdminBulkDisable
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		json.NewEncoder(w).Encode(models.AdminBulkResult{Disabled: req.URLs[:1], NotFound: req.URLs[1:]})
+	})
+	mux.HandleFunc("GET /admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "action=disable&cursor=5&namespace=", r.URL.RawQuery)
+		json.NewEncoder(w).Encode(models.AdminAuditPage{Events: []audit.Event{{ID: 6, Action: audit.ActionDisable}}})
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer admin-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	anonymous, err := New(srv.URL)
+	require.NoError(t, err)
+	_, err = anonymous.AdminSearch(ctx, AdminSearchOptions{})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+	c, err := New(srv.URL, WithAPIKey("admin-key"))
+	require.NoError(t, err)
+
+	disabled := true
+	page, err := c.AdminSearch(ctx, AdminSearchOptions{Host: "yoga.org", Disabled: &disabled, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, "next", page.NextCursor)
+
+	link := LinkRef{Namespace: "ru", ID: "abc"}
+	require.NoError(t, c.AdminDisable(ctx, link, "spam"))
+	require.NoError(t, c.AdminEnable(ctx, link, "spam"))
+	require.NoError(t, c.AdminReassign(ctx, link, "user-2", "spam"))
+	assert.ErrorIs(t, c.AdminDisable(ctx, LinkRef{Namespace: "ru", ID: "missing"}, "spam"), ErrNotFound)
+
+	result, err := c.AdminBulkDisable(ctx, AdminBulkDisable{URLs: []LinkRef{link, {ID: "missing"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []LinkRef{link}, result.Disabled)
+	assert.Equal(t, []LinkRef{{ID: "missing"}}, result.NotFound)
+
+	defaultNamespace := ""
+	events, err := c.AdminAudit(ctx, AdminAuditOptions{Namespace: &defaultNamespace, Action: audit.ActionDisable, Cursor: "5"})
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	assert.Equal(t, int64(6), events.Events[0].ID)
+}
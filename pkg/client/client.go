@@ -0,0 +1,533 @@
+// Package client — HTTP-клиент API сервиса сокращения URL: сокращение, переходы,
+// ссылки пользователя, их изменение и история, QR-коды и модерация /admin
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nastez/shortener/internal/app/models"
+)
+
+// ErrConflict — признак ConflictError для errors.Is
+var ErrConflict = errors.New("url already shortened")
+
+// ConflictError возвращается, если URL уже был сокращён, и содержит существующую короткую ссылку
+type ConflictError struct {
+	ShortURL string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("url already shortened: %s", e.ShortURL)
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrConflict)
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ErrDeleted возвращается для ссылки, удалённой владельцем
+var ErrDeleted = errors.New("url is deleted")
+
+// ErrNotFound возвращается для неизвестной ссылки
+var ErrNotFound = errors.New("url not found")
+
+// ErrVersionMismatch возвращается, если ссылку изменили после того, как клиент прочитал её версию
+var ErrVersionMismatch = errors.New("url version mismatch")
+
+// ErrVersionRequired возвращается на изменение ссылки без версии
+var ErrVersionRequired = errors.New("url version is required")
+
+// AnyVersion отключает проверку версии при изменении ссылки (If-Match: *)
+const AnyVersion int64 = -1
+
+// StatusError — ответ сервера с неожиданным кодом
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// Модели API, общие с сервером
+type (
+	Request           = models.Request
+	Response          = models.Response
+	RequestBatch      = models.RequestBatch
+	PayloadBatch      = models.PayloadBatch
+	ResponseBatch     = models.ResponseBatch
+	ResponseBodyBatch = models.ResponseBodyBatch
+	UserURL           = models.UserURL
+	URLDetails        = models.URLDetails
+	URLPatch          = models.URLPatch
+	URLRevision       = models.URLRevision
+	Destination       = models.Destination
+	Rule              = models.Rule
+)
+
+// Client вызывает API сервиса сокращения URL
+type Client struct {
+	endpoint   *url.URL
+	httpClient *http.Client
+	gzip       bool
+	retry      RetryPolicy
+	apiKey     string
+}
+
+// Option настраивает Client
+type Option func(*Client)
+
+// WithHTTPClient задаёт HTTP-клиент. Клиент копируется; если в нём не задана политика
+// перенаправлений, клиент не следует им, чтобы Resolve мог вернуть адрес назначения.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		hc := *httpClient
+		if hc.CheckRedirect == nil {
+			hc.CheckRedirect = noRedirect
+		}
+		c.httpClient = &hc
+	}
+}
+
+// WithCookieJar задаёт хранилище cookie, в котором сохраняется токен пользователя
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) {
+		c.httpClient.Jar = jar
+	}
+}
+
+// WithAPIKey задаёт ключ API, который передаётся в заголовке Authorization: Bearer
+// вместо cookie; методы /admin требуют ключ с областью действия admin
+func WithAPIKey(token string) Option {
+	return func(c *Client) {
+		c.apiKey = token
+	}
+}
+
+// WithGzip включает сжатие тел запросов и ответов
+func WithGzip(enabled bool) Option {
+	return func(c *Client) {
+		c.gzip = enabled
+	}
+}
+
+// New возвращает клиент для сервера по адресу endpoint, например http://localhost:8080
+func New(endpoint string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint scheme must be http or https: %q", endpoint)
+	}
+
+	c := &Client{
+		endpoint:   u,
+		httpClient: &http.Client{CheckRedirect: noRedirect},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Shorten сокращает URL. Для уже сокращённого URL возвращает существующую ссылку
+// и *ConflictError с ней же.
+func (c *Client) Shorten(ctx context.Context, req Request) (string, error) {
+	resp, body, err := c.do(ctx, http.MethodPost, "/api/shorten", req)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict:
+		var r Response
+		if err = json.Unmarshal(body, &r); err != nil {
+			return "", fmt.Errorf("can't decode response: %w", err)
+		}
+		if resp.StatusCode == http.StatusConflict {
+			return r.Result, &ConflictError{ShortURL: r.Result}
+		}
+		return r.Result, nil
+	default:
+		return "", statusError(resp, body)
+	}
+}
+
+// ShortenText сокращает URL через POST / с телом text/plain.
+// Для уже сокращённого URL возвращает существующую ссылку и *ConflictError.
+func (c *Client) ShortenText(ctx context.Context, originalURL string) (string, error) {
+	resp, body, err := c.doRaw(ctx, http.MethodPost, "/", nil, "text/plain", []byte(originalURL))
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return string(body), nil
+	case http.StatusConflict:
+		return string(body), &ConflictError{ShortURL: string(body)}
+	default:
+		return "", statusError(resp, body)
+	}
+}
+
+// ShortenBatch сокращает несколько URL одним запросом
+func (c *Client) ShortenBatch(ctx context.Context, batch PayloadBatch) (ResponseBodyBatch, error) {
+	resp, body, err := c.do(ctx, http.MethodPost, "/api/shorten/batch", batch)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, statusError(resp, body)
+	}
+
+	var result ResponseBodyBatch
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("can't decode response: %w", err)
+	}
+
+	return result, nil
+}
+
+// Resolve возвращает адрес назначения короткой ссылки по её идентификатору
+func (c *Client) Resolve(ctx context.Context, id string) (string, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return "", ErrDeleted
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return "", ErrNotFound
+		}
+		return location, nil
+	default:
+		return "", statusError(resp, body)
+	}
+}
+
+// UserURLs возвращает ссылки текущего пользователя
+func (c *Client) UserURLs(ctx context.Context) ([]UserURL, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/api/user/urls", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+		var urls []UserURL
+		if err = json.Unmarshal(body, &urls); err != nil {
+			return nil, fmt.Errorf("can't decode response: %w", err)
+		}
+		return urls, nil
+	default:
+		return nil, statusError(resp, body)
+	}
+}
+
+// DeleteURLs ставит в очередь удаление ссылок текущего пользователя
+func (c *Client) DeleteURLs(ctx context.Context, ids []string) error {
+	resp, body, err := c.do(ctx, http.MethodDelete, "/api/user/urls", models.DeleteRequest(ids))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		return statusError(resp, body)
+	}
+
+	return nil
+}
+
+// QROptions — параметры QR-кода; нулевые значения означают значения сервера по умолчанию
+type QROptions struct {
+	// Size — размер стороны PNG в пикселях
+	Size int
+	// Format — png или svg
+	Format string
+}
+
+// QR возвращает изображение QR-кода короткой ссылки и его Content-Type
+func (c *Client) QR(ctx context.Context, id string, opts QROptions) ([]byte, string, error) {
+	path := "/" + url.PathEscape(id) + "/qr"
+	query := url.Values{}
+	if opts.Size > 0 {
+		query.Set("size", strconv.Itoa(opts.Size))
+	}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	resp, body, err := c.do(ctx, http.MethodGet, withQuery(path, query), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, resp.Header.Get("Content-Type"), nil
+	case http.StatusGone:
+		return nil, "", ErrDeleted
+	case http.StatusNotFound:
+		return nil, "", ErrNotFound
+	default:
+		return nil, "", statusError(resp, body)
+	}
+}
+
+// GetURL возвращает ссылку текущего пользователя вместе с версией, по которой её можно изменить
+func (c *Client) GetURL(ctx context.Context, id string) (URLDetails, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/api/urls/"+url.PathEscape(id), nil)
+	if err != nil {
+		return URLDetails{}, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var details URLDetails
+		err = decode(body, &details)
+		return details, err
+	case http.StatusNotFound:
+		return URLDetails{}, ErrNotFound
+	default:
+		return URLDetails{}, statusError(resp, body)
+	}
+}
+
+// UpdateURL применяет к ссылке текущего пользователя изменения patch, если её версия всё ещё
+// равна version. Версия передаётся в If-Match; AnyVersion отключает проверку, а 0 оставляет
+// версию из patch.Version. Возвращает ссылку с новой версией.
+func (c *Client) UpdateURL(ctx context.Context, id string, version int64, patch URLPatch) (URLDetails, error) {
+	header := http.Header{}
+	switch {
+	case version == AnyVersion:
+		header.Set("If-Match", "*")
+	case version > 0:
+		header.Set("If-Match", `"`+strconv.FormatInt(version, 10)+`"`)
+	}
+
+	resp, body, err := c.doHeader(ctx, http.MethodPatch, "/api/urls/"+url.PathEscape(id), header, patch)
+	if err != nil {
+		return URLDetails{}, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var details URLDetails
+		err = decode(body, &details)
+		return details, err
+	case http.StatusNotFound:
+		return URLDetails{}, ErrNotFound
+	case http.StatusConflict:
+		return URLDetails{}, ErrConflict
+	case http.StatusPreconditionFailed:
+		return URLDetails{}, ErrVersionMismatch
+	case http.StatusPreconditionRequired:
+		return URLDetails{}, ErrVersionRequired
+	default:
+		return URLDetails{}, statusError(resp, body)
+	}
+}
+
+// URLHistory возвращает прежние редакции ссылки текущего пользователя, от старых к новым
+func (c *Client) URLHistory(ctx context.Context, id string) ([]URLRevision, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/api/urls/"+url.PathEscape(id)+"/history", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var revisions []URLRevision
+		err = decode(body, &revisions)
+		return revisions, err
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, statusError(resp, body)
+	}
+}
+
+// Ping проверяет соединение сервера с базой данных
+func (c *Client) Ping(ctx context.Context) error {
+	resp, body, err := c.do(ctx, http.MethodGet, "/ping", nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, body)
+	}
+
+	return nil
+}
+
+// OpenAPI возвращает спецификацию API сервера
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, body)
+	}
+
+	return body, nil
+}
+
+// do выполняет запрос с телом payload в JSON и возвращает ответ с прочитанным телом
+func (c *Client) do(ctx context.Context, method, path string, payload any) (*http.Response, []byte, error) {
+	return c.doHeader(ctx, method, path, nil, payload)
+}
+
+// doHeader выполняет запрос, как do, с дополнительными заголовками header
+func (c *Client) doHeader(ctx context.Context, method, path string, header http.Header, payload any) (*http.Response, []byte, error) {
+	if payload == nil {
+		return c.doRaw(ctx, method, path, header, "", nil)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.doRaw(ctx, method, path, header, "application/json", data)
+}
+
+// doRaw выполняет запрос, повторяя его по политике c.retry
+func (c *Client) doRaw(ctx context.Context, method, path string, header http.Header, contentType string, data []byte) (*http.Response, []byte, error) {
+	if data != nil && c.gzip {
+		var err error
+		if data, err = compress(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	target, err := c.endpoint.Parse(strings.TrimSuffix(c.endpoint.Path, "/") + path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, body, err := c.send(ctx, method, target.String(), header, contentType, data)
+
+		delay, retry := c.retry.next(attempt, resp, err)
+		if !retry || ctx.Err() != nil {
+			return resp, body, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send выполняет одну попытку запроса
+func (c *Client) send(ctx context.Context, method, target string, header http.Header, contentType string, data []byte) (*http.Response, []byte, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", contentType)
+		if c.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if c.gzip {
+		// заголовок выставлен явно, поэтому ответ распаковывается вручную
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't decompress response: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	respBody, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, respBody, nil
+}
+
+// noRedirect запрещает выполнять перенаправления: Resolve возвращает адрес назначения
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decode(body []byte, v any) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("can't decode response: %w", err)
+	}
+
+	return nil
+}
+
+func statusError(resp *http.Response, body []byte) error {
+	return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nastez/shortener/internal/app/models"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+
+		var req models.Request
+		require.NoError(t, json.NewDecoder(body).Decode(&req))
+
+		w.Header().Set("Content-Type", "application/json")
+		status := http.StatusCreated
+		if req.URL == "https://exists.org" {
+			status = http.StatusConflict
+		}
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(status)
+			zw := gzip.NewWriter(w)
+			defer zw.Close()
+			json.NewEncoder(zw).Encode(models.Response{Result: "http://short/abc"})
+			return
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.Response{Result: "http://short/abc"})
+	})
+	mux.HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case "abc":
+			w.Header().Set("Location", "https://yoga.org")
+			w.WriteHeader(http.StatusTemporaryRedirect)
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("GET /api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	for _, gz := range []bool{false, true} {
+		c, err := New(srv.URL, WithGzip(gz))
+		require.NoError(t, err)
+
+		short, err := c.Shorten(ctx, models.Request{URL: "https://yoga.org"})
+		require.NoError(t, err)
+		assert.Equal(t, "http://short/abc", short)
+
+		short, err = c.Shorten(ctx, models.Request{URL: "https://exists.org"})
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, "http://short/abc", short)
+
+		var conflict *ConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, "http://short/abc", conflict.ShortURL)
+	}
+
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+
+	original, err := c.Resolve(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yoga.org", original)
+
+	_, err = c.Resolve(ctx, "gone")
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	_, err = c.Resolve(ctx, "broken")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+
+	urls, err := c.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "https://yoga.org", string(body), "body is resent on every attempt")
+
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("http://short/abc"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	c, err := New(srv.URL, WithRetry(policy))
+	require.NoError(t, err)
+
+	short, err := c.ShortenText(ctx, "https://yoga.org")
+	require.NoError(t, err)
+	assert.Equal(t, "http://short/abc", short)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// без повторов возвращается ответ первой попытки
+	calls.Store(0)
+	c, err = New(srv.URL)
+	require.NoError(t, err)
+
+	_, err = c.ShortenText(ctx, "https://yoga.org")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+
+	// отмена контекста прерывает ожидание перед повтором
+	calls.Store(0)
+	c, err = New(srv.URL, WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = c.ShortenText(ctx, "https://yoga.org")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClientUserURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/urls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"3"`)
+		json.NewEncoder(w).Encode(models.URLDetails{ID: "abc", OriginalURL: "https://yoga.org", Version: 3})
+	})
+	mux.HandleFunc("PATCH /api/urls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var patch models.URLPatch
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+
+		switch r.Header.Get("If-Match") {
+		case "":
+			w.WriteHeader(http.StatusPreconditionRequired)
+		case `"3"`, "*":
+			json.NewEncoder(w).Encode(models.URLDetails{ID: "abc", OriginalURL: *patch.URL, Version: 4})
+		default:
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+	})
+	mux.HandleFunc("GET /api/urls/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.URLRevision{{Version: 3, OriginalURL: "https://yoga.org"}})
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+
+	details, err := c.GetURL(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), details.Version)
+
+	_, err = c.GetURL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	newURL := "https://pilates.org"
+	tests := []struct {
+		name    string
+		version int64
+		wantErr error
+	}{
+		{name: "current version", version: 3},
+		{name: "any version", version: AnyVersion},
+		{name: "stale version", version: 2, wantErr: ErrVersionMismatch},
+		{name: "no version", version: 0, wantErr: ErrVersionRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := c.UpdateURL(ctx, "abc", tt.version, URLPatch{URL: &newURL})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, newURL, details.OriginalURL)
+			assert.Equal(t, int64(4), details.Version)
+		})
+	}
+
+	revisions, err := c.URLHistory(ctx, "abc")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "https://yoga.org", revisions[0].OriginalURL)
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy — политика повторов запросов с экспоненциальной задержкой.
+// Повторяются сетевые ошибки и ответы 429, 502, 503 и 504.
+type RetryPolicy struct {
+	// MaxAttempts — максимальное число попыток, включая первую; 0 и 1 отключают повторы
+	MaxAttempts int
+	// BaseDelay — задержка перед первым повтором, далее удваивается
+	BaseDelay time.Duration
+	// MaxDelay ограничивает задержку, в том числе из заголовка Retry-After
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy — три попытки с задержками около 100 и 200 мс
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// WithRetry задаёт политику повторов; по умолчанию запросы не повторяются
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// next решает, нужен ли повтор после попытки attempt, и возвращает задержку перед ним
+func (p RetryPolicy) next(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if err != nil {
+		return p.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return p.limit(time.Duration(seconds) * time.Second), true
+	}
+
+	return p.backoff(attempt), true
+}
+
+// backoff возвращает удвоенную для каждой попытки задержку со случайным разбросом до половины
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+
+	return p.limit(delay)
+}
+
+func (p RetryPolicy) limit(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
@@ -6,7 +6,12 @@ import (
 )
 
 func GenerateID() string {
-	b := make([]byte, 4)
+	return GenerateIDLength(8)
+}
+
+// GenerateIDLength возвращает случайный шестнадцатеричный идентификатор длиной length символов
+func GenerateIDLength(length int) string {
+	b := make([]byte, (length+1)/2)
 	rand.Read(b)
-	return hex.EncodeToString(b)
+	return hex.EncodeToString(b)[:length]
 }